@@ -2,14 +2,21 @@
 // SPDX-License-Identifier: MIT-0
 
 const https = require('http');
+const fs = require('fs');
+
+// Written by the extension at INIT, only the user of the function can read it. It is read on the
+// first invocation, the extension is ready by then
+let token;
 
 exports.handler = function(event, context, callback) {
+    token = token || fs.readFileSync('/tmp/cache-extension.token', 'utf8');
 
     const options = {
         hostname: 'localhost',
         port: 4000,
         path: '/dynamodb?name=DynamoDbTable-pKey1-sKey1',
-        method: 'GET'
+        method: 'GET',
+        headers: { 'X-Extension-Token': token }
     };
 
     const req = https.request(options, res => {
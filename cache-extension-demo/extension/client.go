@@ -34,6 +34,11 @@ type Tracing struct {
 	Value string `json:"value"`
 }
 
+// StatusResponse is the body of the response for /init/error and /exit/error
+type StatusResponse struct {
+	Status string `json:"status"`
+}
+
 // EventType represents the type of events recieved from /event/next
 type EventType string
 
@@ -46,6 +51,7 @@ const (
 
 	extensionNameHeader      = "Lambda-Extension-Name"
 	extensionIdentiferHeader = "Lambda-Extension-Identifier"
+	extensionErrorType       = "Lambda-Extension-Function-Error-Type"
 )
 
 // Client is a simple client for the Lambda Extensions API
@@ -130,3 +136,41 @@ func (e *Client) NextEvent(ctx context.Context) (*NextEventResponse, error) {
 	}
 	return &res, nil
 }
+
+// InitError reports an initialization error to the platform. Call it when you registered but failed to initialize
+func (e *Client) InitError(ctx context.Context, errorType string, errorMessage string) (*StatusResponse, error) {
+	const action = "/init/error"
+	url := e.baseURL + action
+
+	reqBody, err := json.Marshal(map[string]string{
+		"errorType":    errorType,
+		"errorMessage": errorMessage,
+	})
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set(extensionIdentiferHeader, e.extensionID)
+	httpReq.Header.Set(extensionErrorType, errorType)
+	httpRes, err := e.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	if httpRes.StatusCode != 200 {
+		return nil, fmt.Errorf("request failed with status %s", httpRes.Status)
+	}
+	defer httpRes.Body.Close()
+	body, err := ioutil.ReadAll(httpRes.Body)
+	if err != nil {
+		return nil, err
+	}
+	res := StatusResponse{}
+	err = json.Unmarshal(body, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
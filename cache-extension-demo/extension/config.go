@@ -0,0 +1,284 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package extension
+
+import (
+	"aws-lambda-extensions/cache-extension-demo/plugins"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/appconfigdata"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Lambda environment variables for defining where the configuration is read from and how often it is reloaded
+const (
+	ConfigPath                  = "CACHE_EXTENSION_CONFIG_PATH"
+	ConfigParameter             = "CACHE_EXTENSION_CONFIG_PARAMETER"
+	ConfigAppConfig             = "CACHE_EXTENSION_CONFIG_APPCONFIG"
+	ConfigReloadInterval        = "CACHE_EXTENSION_CONFIG_RELOAD_INTERVAL"
+	defaultConfigReloadInterval = "60s"
+	// Shortest interval AppConfig accepts between two reads of a session
+	appConfigPollInterval = 15
+)
+
+var (
+	// configLock guards the loaded configuration and the AppConfig session, and is held for the
+	// whole reload so that two reloads never interleave
+	configLock      sync.Mutex
+	configData      string
+	configLoadedAt  time.Time
+	appConfigToken  string
+	appConfigReadAt time.Time
+	appConfigClient *appconfigdata.AppConfigData
+)
+
+// Read the configuration from AppConfig ("CACHE_EXTENSION_CONFIG_APPCONFIG"), from an SSM parameter
+// ("CACHE_EXTENSION_CONFIG_PARAMETER") or from a file ("CACHE_EXTENSION_CONFIG_PATH", defaults to
+// /var/task/config.yaml), in that order of precedence
+func LoadConfig() (string, error) {
+	if profile := os.Getenv(ConfigAppConfig); profile != "" {
+		return loadAppConfig(profile)
+	}
+	if name := os.Getenv(ConfigParameter); name != "" {
+		return loadConfigParameter(name)
+	}
+	return LoadConfigFile()
+}
+
+// Load the config file
+func LoadConfigFile() (string, error) {
+	var fileName = os.Getenv(ConfigPath)
+	if fileName == "" {
+		fileName = FileName
+	}
+
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return "", fmt.Errorf("cannot read config file: %v", err)
+	}
+	return string(data), nil
+}
+
+// Read the config from an SSM parameter in the function region
+func loadConfigParameter(name string) (string, error) {
+	param, err := plugins.GetSsmClient(os.Getenv("AWS_REGION")).GetParameter(&ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return "", fmt.Errorf("cannot read config parameter %s: %v", name, err)
+	}
+	return aws.StringValue(param.Parameter.Value), nil
+}
+
+// Read the config from an AppConfig profile defined as "<application>/<environment>/<profile>".
+// A configuration session is started on the first read, AppConfig then only returns the content
+// when it has changed. The session is started again after an error, ex: when its token expired
+func loadAppConfig(profile string) (string, error) {
+	var identifiers = strings.Split(profile, "/")
+	if len(identifiers) != 3 {
+		return "", fmt.Errorf("invalid %s env variable %q, expected <application>/<environment>/<profile>", ConfigAppConfig, profile)
+	}
+
+	if appConfigClient == nil {
+		sess, err := session.NewSessionWithOptions(session.Options{
+			SharedConfigState: session.SharedConfigEnable,
+		})
+		if err != nil {
+			return "", err
+		}
+		appConfigClient = appconfigdata.New(sess)
+	}
+
+	var isNewSession = appConfigToken == ""
+	if !isNewSession && time.Since(appConfigReadAt) < appConfigPollInterval*time.Second {
+		return configData, nil
+	}
+	if isNewSession {
+		started, err := appConfigClient.StartConfigurationSession(&appconfigdata.StartConfigurationSessionInput{
+			ApplicationIdentifier:                aws.String(identifiers[0]),
+			EnvironmentIdentifier:                aws.String(identifiers[1]),
+			ConfigurationProfileIdentifier:       aws.String(identifiers[2]),
+			RequiredMinimumPollIntervalInSeconds: aws.Int64(appConfigPollInterval),
+		})
+		if err != nil {
+			return "", fmt.Errorf("cannot start AppConfig session for profile %s: %v", profile, err)
+		}
+		appConfigToken = aws.StringValue(started.InitialConfigurationToken)
+	}
+
+	result, err := appConfigClient.GetLatestConfiguration(&appconfigdata.GetLatestConfigurationInput{
+		ConfigurationToken: aws.String(appConfigToken),
+	})
+	if err != nil {
+		appConfigToken = ""
+		return "", fmt.Errorf("cannot read AppConfig profile %s: %v", profile, err)
+	}
+	appConfigToken = aws.StringValue(result.NextPollConfigurationToken)
+	appConfigReadAt = time.Now()
+	if len(result.Configuration) == 0 && !isNewSession {
+		return configData, nil
+	}
+	return string(result.Configuration), nil
+}
+
+// Unmarshal the configuration and validate it, unknown fields are rejected
+func ParseConfig(data string) (CacheConfig, error) {
+	var config = CacheConfig{}
+	err := yaml.UnmarshalStrict([]byte(data), &config)
+	if err != nil {
+		return config, fmt.Errorf("invalid config: %v", err)
+	}
+	return config, ValidateConfig(config)
+}
+
+// Check that every cached item is fully defined
+func ValidateConfig(config CacheConfig) error {
+	var problems []string
+	for idx, parameter := range config.Parameters {
+		if parameter.Region == "" {
+			problems = append(problems, fmt.Sprintf("parameters[%d]: region is required", idx))
+		}
+		if len(parameter.Names) == 0 && len(parameter.Paths) == 0 {
+			problems = append(problems, fmt.Sprintf("parameters[%d]: names or paths are required", idx))
+		}
+		for _, path := range parameter.Paths {
+			if !strings.HasPrefix(path, "/") {
+				problems = append(problems, fmt.Sprintf("parameters[%d]: path %q must start with /", idx, path))
+			}
+		}
+	}
+	for idx, item := range config.Dynamodb {
+		if item.Table == "" {
+			problems = append(problems, fmt.Sprintf("dynamodb[%d]: table is required", idx))
+		}
+		if item.HashKey == "" || item.HashKeyValue == "" {
+			problems = append(problems, fmt.Sprintf("dynamodb[%d]: hashkey and hashkeyvalue are required", idx))
+		}
+		if !isKeyType(item.HashKeyType) {
+			problems = append(problems, fmt.Sprintf("dynamodb[%d]: hashkeytype must be S, N or B", idx))
+		}
+		if item.SortKey != "" && !isKeyType(item.SortKeyType) {
+			problems = append(problems, fmt.Sprintf("dynamodb[%d]: sortkeytype must be S, N or B", idx))
+		}
+		if item.HashKeyType == "B" && !isBase64(item.HashKeyValue) {
+			problems = append(problems, fmt.Sprintf("dynamodb[%d]: hashkeyvalue must be base64 encoded", idx))
+		}
+		if item.SortKey != "" && item.SortKeyType == "B" && !isBase64(item.SortKeyValue) {
+			problems = append(problems, fmt.Sprintf("dynamodb[%d]: sortkeyvalue must be base64 encoded", idx))
+		}
+		if item.Mode != "" && strings.ToLower(item.Mode) != plugins.ModeGetItem && strings.ToLower(item.Mode) != plugins.ModeQuery {
+			problems = append(problems, fmt.Sprintf("dynamodb[%d]: mode must be %s or %s", idx, plugins.ModeGetItem, plugins.ModeQuery))
+		}
+		if item.Limit < 0 {
+			problems = append(problems, fmt.Sprintf("dynamodb[%d]: limit must not be negative", idx))
+		}
+		// DynamoDB rejects attribute names that no expression uses, they are only used by the projection
+		if len(item.ExpressionAttributeNames) > 0 && item.ProjectionExpression == "" {
+			problems = append(problems, fmt.Sprintf("dynamodb[%d]: expressionattributenames requires projectionexpression", idx))
+		}
+	}
+	if config.Memory.MaxBytes < 0 || config.Memory.MaxEntryBytes < 0 {
+		problems = append(problems, "memory: maxbytes and maxentrybytes must not be negative")
+	}
+	problems = append(problems, validateTokens(config.Tokens)...)
+
+	if len(problems) > 0 {
+		return errors.New("invalid config: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Reload the configuration once "CACHE_EXTENSION_CONFIG_RELOAD_INTERVAL" has elapsed since the last load.
+// Items that are no longer configured are dropped, new ones are initialized. An invalid configuration
+// is logged and the current one is kept
+func ReloadConfigIfDue() {
+	configLock.Lock()
+	defer configLock.Unlock()
+
+	interval, err := getConfigReloadInterval()
+	if err != nil || interval <= 0 || time.Since(configLoadedAt) < interval {
+		return
+	}
+	configLoadedAt = time.Now()
+
+	data, err := LoadConfig()
+	if err != nil {
+		println(plugins.PrintPrefix, "Error while reloading config, keeping the current one:", err.Error())
+		return
+	}
+	if data == configData {
+		return
+	}
+	config, err := ParseConfig(data)
+	if err != nil {
+		println(plugins.PrintPrefix, "Error while reloading config, keeping the current one:", err.Error())
+		return
+	}
+
+	configData = data
+	cacheConfig = config
+	plugins.InitMemory(cacheConfig.Memory)
+	plugins.ReloadParameters(cacheConfig.Parameters, initializeCache)
+	plugins.ReloadDynamodb(cacheConfig.Dynamodb, initializeCache)
+	if err := reloadTokens(cacheConfig.Tokens); err != nil {
+		println(plugins.PrintPrefix, "Error while reloading tokens:", err.Error())
+	}
+	println(plugins.PrintPrefix, "Config successfully reloaded")
+}
+
+// Reload the configuration every "CACHE_EXTENSION_CONFIG_RELOAD_INTERVAL" until ctx is cancelled. The
+// reload runs in the background, while the execution environment is not frozen, so that it also
+// happens during long invocations and between the events
+func ReloadConfigPeriodically(ctx context.Context) {
+	interval, err := getConfigReloadInterval()
+	if err != nil || interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			ReloadConfigIfDue()
+		}
+	}
+}
+
+// Read "CACHE_EXTENSION_CONFIG_RELOAD_INTERVAL", a value of 0 disables the reload
+func getConfigReloadInterval() (time.Duration, error) {
+	interval := os.Getenv(ConfigReloadInterval)
+	if interval == "" {
+		interval = defaultConfigReloadInterval
+	}
+
+	duration, err := time.ParseDuration(interval)
+	if err != nil || duration < 0 {
+		return 0, fmt.Errorf("invalid %s env variable %q, expected a Go duration, ex: 30s, 3m", ConfigReloadInterval, interval)
+	}
+	return duration, nil
+}
+
+// Supported Dynamodb key types
+func isKeyType(keyType string) bool {
+	return keyType == "S" || keyType == "N" || keyType == "B"
+}
+
+// Binary key values are base64 encoded in the configuration
+func isBase64(value string) bool {
+	_, err := base64.StdEncoding.DecodeString(value)
+	return err == nil
+}
@@ -0,0 +1,124 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package extension
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Loads the config file written to a temporary directory, with the tokens next to it
+func withConfigFile(t *testing.T, data string) string {
+	t.Helper()
+	directory := t.TempDir()
+	fileName := filepath.Join(directory, "config.yaml")
+	if err := ioutil.WriteFile(fileName, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(ConfigPath, fileName)
+	t.Setenv(TokenFile, filepath.Join(directory, "cache-extension.token"))
+	if err := InitCacheExtensions(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { reloadTokens(nil) })
+	return fileName
+}
+
+func TestConcurrentReloads(t *testing.T) {
+	t.Setenv(ConfigReloadInterval, "1ns")
+	fileName := withConfigFile(t, "memory:\n  maxbytes: 1000\n")
+
+	var wait sync.WaitGroup
+	for idx := 0; idx < 8; idx++ {
+		wait.Add(1)
+		go func(idx int) {
+			defer wait.Done()
+			for reload := 0; reload < 20; reload++ {
+				ReloadConfigIfDue()
+			}
+		}(idx)
+	}
+	for idx := 0; idx < 20; idx++ {
+		data := "memory:\n  maxbytes: 1000\n"
+		if idx%2 == 1 {
+			data = "memory:\n  maxbytes: 2000\ntokens:\n  - name: orders\n"
+		}
+		if err := ioutil.WriteFile(fileName, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wait.Wait()
+
+	ReloadConfigIfDue()
+	configLock.Lock()
+	defer configLock.Unlock()
+	if cacheConfig.Memory.MaxBytes != 2000 || len(cacheConfig.Tokens) != 1 {
+		t.Fatalf("loaded %+v, expected the last config", cacheConfig)
+	}
+}
+
+func TestReloadConfigPeriodically(t *testing.T) {
+	t.Setenv(ConfigReloadInterval, "10ms")
+	fileName := withConfigFile(t, "memory:\n  maxbytes: 1000\n")
+	if err := ioutil.WriteFile(fileName, []byte("memory:\n  maxbytes: 2000\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		ReloadConfigPeriodically(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// Reloaded without any event
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		configLock.Lock()
+		maxBytes := cacheConfig.Memory.MaxBytes
+		configLock.Unlock()
+		if maxBytes == 2000 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("config not reloaded, maxbytes is %d", maxBytes)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestValidateBinaryKeys(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		config  string
+		problem string
+	}{
+		{"valid keys", "dynamodb:\n  - table: t\n    hashkey: id\n    hashkeytype: B\n    hashkeyvalue: aWQtMQ==\n    sortkey: sk\n    sortkeytype: B\n    sortkeyvalue: c2s=\n", ""},
+		{"string keys", "dynamodb:\n  - table: t\n    hashkey: id\n    hashkeytype: S\n    hashkeyvalue: id-1?\n", ""},
+		{"invalid hash key", "dynamodb:\n  - table: t\n    hashkey: id\n    hashkeytype: B\n    hashkeyvalue: id-1?\n", "dynamodb[0]: hashkeyvalue must be base64 encoded"},
+		{"invalid sort key", "dynamodb:\n  - table: t\n    hashkey: id\n    hashkeytype: S\n    hashkeyvalue: id-1\n    sortkey: sk\n    sortkeytype: B\n    sortkeyvalue: c2s\n", "dynamodb[0]: sortkeyvalue must be base64 encoded"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseConfig(test.config)
+			if test.problem == "" {
+				if err != nil {
+					t.Fatalf("config rejected: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.problem) {
+				t.Fatalf("config accepted with error %v, expected %q", err, test.problem)
+			}
+		})
+	}
+}
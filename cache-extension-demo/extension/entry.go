@@ -5,11 +5,10 @@ package extension
 
 import (
 	"aws-lambda-extensions/cache-extension-demo/plugins"
-	"gopkg.in/yaml.v2"
-	"io/ioutil"
-	"log"
+	"fmt"
 	"os"
 	"strconv"
+	"time"
 )
 
 // Constants definition
@@ -24,45 +23,81 @@ const (
 type CacheConfig struct {
 	Parameters []plugins.ParameterConfiguration
 	Dynamodb   []plugins.DynamodbConfiguration
+	Memory     plugins.MemoryConfiguration
+	Tokens     []TokenConfiguration
 }
 
 var cacheConfig = CacheConfig{}
+var initializeCache = false
 
-// Initialize cache and start the background process to refresh cache
-func InitCacheExtensions() {
-	// Read the cache config file
-	data := LoadConfigFile()
+// Initialize cache and start the background process to refresh cache.
+// Returns an error if the env variables or the configuration are invalid
+func InitCacheExtensions() error {
+	// Validate the Lambda env variables
+	err := plugins.InitCacheTimeOut()
+	if err != nil {
+		return err
+	}
+	_, err = getConfigReloadInterval()
+	if err != nil {
+		return err
+	}
+	initializeCache, err = getInitializeCacheOnStartup()
+	if err != nil {
+		return err
+	}
+
+	configLock.Lock()
+	defer configLock.Unlock()
+
+	// Read the cache config
+	data, err := LoadConfig()
+	if err != nil {
+		return err
+	}
 
 	// Unmarshal the configuration to struct
-	err := yaml.Unmarshal([]byte(data), &cacheConfig)
+	cacheConfig, err = ParseConfig(data)
 	if err != nil {
-		log.Fatalf(plugins.PrintPrefix, "error: %v", err)
+		return err
+	}
+	configData = data
+	configLoadedAt = time.Now()
+
+	// Issue the tokens before the servers start, so that the function finds their files
+	err = InitTokens()
+	if err != nil {
+		return err
 	}
 
 	// Initialize Cache
 	InitCache()
 	println(plugins.PrintPrefix, "Cache successfully loaded")
+	return nil
 }
 
-// Initialize individual cache
+// Initialize individual cache. Expects configLock to be held
 func InitCache() {
+	// Set the memory budget before anything gets cached
+	plugins.InitMemory(cacheConfig.Memory)
+
+	// Initialize map and load data from individual services if "CACHE_EXTENSION_INIT_STARTUP" = true
+	plugins.InitParameters(cacheConfig.Parameters, initializeCache)
+	plugins.InitDynamodb(cacheConfig.Dynamodb, initializeCache)
+}
 
-	// Read Lambda env variable
+// Read Lambda env variable "CACHE_EXTENSION_INIT_STARTUP", defaults to false
+func getInitializeCacheOnStartup() (bool, error) {
 	var initCache = os.Getenv(InitializeCacheOnStartup)
-	var initCacheInBool = false
-	if initCache != "" {
-		cacheInBool, err := strconv.ParseBool(initCache)
-		if err != nil {
-			panic(plugins.PrintPrefix + "Error while converting CACHE_EXTENSION_INIT_STARTUP env variable " +
-				initCache)
-		} else {
-			initCacheInBool = cacheInBool
-		}
+	if initCache == "" {
+		return false, nil
 	}
 
-	// Initialize map and load data from individual services if "CACHE_EXTENSION_INIT_STARTUP" = true
-	plugins.InitParameters(cacheConfig.Parameters, initCacheInBool)
-	plugins.InitDynamodb(cacheConfig.Dynamodb, initCacheInBool)
+	initCacheInBool, err := strconv.ParseBool(initCache)
+	if err != nil {
+		return false, fmt.Errorf("invalid CACHE_EXTENSION_INIT_STARTUP env variable %q, expected true or false", initCache)
+	}
+	return initCacheInBool, nil
 }
 
 // Route request to corresponding cache handlers
@@ -77,12 +112,34 @@ func RouteCache(cacheType string, name string) string {
 	}
 }
 
-// Load the config file
-func LoadConfigFile() string {
-	data, err := ioutil.ReadFile(FileName)
-	if err != nil {
-		panic(err)
+// Route invalidation request to corresponding cache, an empty cacheType invalidates every cache.
+// An empty name and prefix drops every entry of the cache. Returns the number of entries dropped
+func InvalidateCache(cacheType string, name string, prefix string) int {
+	switch cacheType {
+	case Parameters:
+		if name != "" {
+			return plugins.InvalidateParameter(name)
+		} else if prefix != "" {
+			return plugins.InvalidateParameterPrefix(prefix)
+		}
+		return plugins.InvalidateAllParameters()
+	case Dynamodb:
+		if name != "" {
+			return plugins.InvalidateDynamodb(name)
+		} else if prefix != "" {
+			return plugins.InvalidateDynamodbPrefix(prefix)
+		}
+		return plugins.InvalidateAllDynamodb()
+	case "":
+		return InvalidateCache(Parameters, name, prefix) + InvalidateCache(Dynamodb, name, prefix)
+	default:
+		return 0
 	}
+}
 
-	return string(data)
+// Reload every configured item into the cache
+func WarmCache() {
+	plugins.RefreshParameters()
+	plugins.RefreshDynamodb()
+	println(plugins.PrintPrefix, "Cache successfully warmed")
 }
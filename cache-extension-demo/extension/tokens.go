@@ -0,0 +1,141 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package extension
+
+import (
+	"aws-lambda-extensions/cache-extension-demo/plugins"
+	"aws-lambda-extensions/go-example-ipc-transport/transport"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Lambda environment variable for the file of the default token, and name of that token
+const (
+	TokenFile        = "CACHE_EXTENSION_TOKEN_FILE"
+	defaultTokenFile = "/tmp/cache-extension.token"
+	DefaultToken     = "default"
+)
+
+// Struct for storing the configuration of a token restricted to some cache keys. A key ending with *
+// allows every key starting with the rest of it
+type TokenConfiguration struct {
+	Name       string
+	Parameters []string
+	Dynamodb   []string
+}
+
+var (
+	// Authenticator holds the tokens accepted by the HTTP and gRPC servers
+	Authenticator = transport.NewAuthenticator()
+
+	tokensLock sync.RWMutex
+	tokens     = make(map[string]TokenConfiguration)
+	tokenName  = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+)
+
+// Issue the default token, which has access to every key and to the admin endpoints, and a token per
+// configured name. Every token is written to its own file. Expects configLock to be held
+func InitTokens() error {
+	if _, err := Authenticator.Issue(DefaultToken, getTokenFile(DefaultToken)); err != nil {
+		return fmt.Errorf("cannot write token file: %v", err)
+	}
+	return reloadTokens(cacheConfig.Tokens)
+}
+
+// Issue the tokens of new names and revoke the tokens of removed names, existing tokens are kept so
+// that the function does not need to read their files again
+func reloadTokens(configs []TokenConfiguration) error {
+	tokensLock.Lock()
+	defer tokensLock.Unlock()
+
+	configured := make(map[string]TokenConfiguration)
+	for _, config := range configs {
+		configured[config.Name] = config
+		if _, ok := tokens[config.Name]; ok {
+			continue
+		}
+		if _, err := Authenticator.Issue(config.Name, getTokenFile(config.Name)); err != nil {
+			return fmt.Errorf("cannot write token file of %s: %v", config.Name, err)
+		}
+		println(plugins.PrintPrefix, "Issued token", config.Name)
+	}
+	for name := range tokens {
+		if _, ok := configured[name]; !ok {
+			Authenticator.Revoke(name)
+			os.Remove(getTokenFile(name))
+			println(plugins.PrintPrefix, "Revoked token", name)
+		}
+	}
+	tokens = configured
+	return nil
+}
+
+// Check whether the token may read the item of the cache
+func IsAllowed(token string, cacheType string, name string) bool {
+	if token == DefaultToken {
+		return true
+	}
+	tokensLock.RLock()
+	defer tokensLock.RUnlock()
+	config, ok := tokens[token]
+	if !ok {
+		return false
+	}
+	switch cacheType {
+	case Parameters:
+		return matchesAllowlist(name, config.Parameters)
+	case Dynamodb:
+		return matchesAllowlist(name, config.Dynamodb)
+	default:
+		return false
+	}
+}
+
+// Check whether the token may call the admin endpoints
+func IsAdmin(token string) bool {
+	return token == DefaultToken
+}
+
+func matchesAllowlist(name string, allowlist []string) bool {
+	for _, allowed := range allowlist {
+		if strings.HasSuffix(allowed, "*") && strings.HasPrefix(name, strings.TrimSuffix(allowed, "*")) {
+			return true
+		}
+		if allowed == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Read "CACHE_EXTENSION_TOKEN_FILE", the file of a named token is next to it, ex:
+// /tmp/cache-extension.<name>.token
+func getTokenFile(name string) string {
+	var file = os.Getenv(TokenFile)
+	if file == "" {
+		file = defaultTokenFile
+	}
+	if name == DefaultToken {
+		return file
+	}
+	return strings.TrimSuffix(file, ".token") + "." + name + ".token"
+}
+
+// Check that every token has a unique name, usable in a file name
+func validateTokens(configs []TokenConfiguration) []string {
+	var problems []string
+	seen := make(map[string]bool)
+	for idx, config := range configs {
+		if !tokenName.MatchString(config.Name) || config.Name == DefaultToken {
+			problems = append(problems, fmt.Sprintf("tokens[%d]: name must only contain letters, digits, _ and - and not be %s", idx, DefaultToken))
+		} else if seen[config.Name] {
+			problems = append(problems, fmt.Sprintf("tokens[%d]: name %s is already used", idx, config.Name))
+		}
+		seen[config.Name] = true
+	}
+	return problems
+}
@@ -0,0 +1,90 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package extension
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Issues the tokens of the configs to files of a temporary directory, revoked at the end of the test
+func withTokens(t *testing.T, configs []TokenConfiguration) string {
+	t.Helper()
+	directory := t.TempDir()
+	t.Setenv(TokenFile, filepath.Join(directory, "cache-extension.token"))
+	if err := reloadTokens(configs); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { reloadTokens(nil) })
+	return directory
+}
+
+func TestIsAllowed(t *testing.T) {
+	withTokens(t, []TokenConfiguration{
+		{Name: "orders", Parameters: []string{"/orders/*", "CacheExtensionDemo"}, Dynamodb: []string{"orders-table-*"}},
+		{Name: "empty"},
+	})
+
+	for _, test := range []struct {
+		token     string
+		cacheType string
+		name      string
+		allowed   bool
+	}{
+		{DefaultToken, Parameters, "/anything", true},
+		{DefaultToken, Dynamodb, "any-table-key", true},
+		{"orders", Parameters, "/orders/db/url", true},
+		{"orders", Parameters, "/orders/", true},
+		{"orders", Parameters, "/orders", false},
+		{"orders", Parameters, "/payments/db/url", false},
+		{"orders", Parameters, "CacheExtensionDemo", true},
+		{"orders", Parameters, "CacheExtensionDemo2", false},
+		{"orders", Dynamodb, "orders-table-42", true},
+		{"orders", Dynamodb, "/orders/db/url", false},
+		{"orders", "unknown", "/orders/db/url", false},
+		{"empty", Parameters, "CacheExtensionDemo", false},
+		{"unknown", Parameters, "CacheExtensionDemo", false},
+		{"", Parameters, "CacheExtensionDemo", false},
+	} {
+		if allowed := IsAllowed(test.token, test.cacheType, test.name); allowed != test.allowed {
+			t.Errorf("IsAllowed(%q, %q, %q) = %v, expected %v", test.token, test.cacheType, test.name, allowed, test.allowed)
+		}
+	}
+}
+
+func TestIsAdmin(t *testing.T) {
+	withTokens(t, []TokenConfiguration{{Name: "orders", Parameters: []string{"*"}}})
+	for token, admin := range map[string]bool{DefaultToken: true, "orders": false, "": false, "unknown": false} {
+		if IsAdmin(token) != admin {
+			t.Errorf("IsAdmin(%q) = %v, expected %v", token, !admin, admin)
+		}
+	}
+}
+
+func TestReloadTokens(t *testing.T) {
+	directory := withTokens(t, []TokenConfiguration{{Name: "orders"}, {Name: "payments"}})
+	ordersFile := filepath.Join(directory, "cache-extension.orders.token")
+	token, err := os.ReadFile(ordersFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name, ok := Authenticator.Authenticate(string(token)); !ok || name != "orders" {
+		t.Fatalf("token of orders authenticated as %q, %v", name, ok)
+	}
+
+	if err := reloadTokens([]TokenConfiguration{{Name: "orders"}}); err != nil {
+		t.Fatal(err)
+	}
+	// Kept tokens are not reissued, removed ones are revoked
+	if reloaded, _ := os.ReadFile(ordersFile); string(reloaded) != string(token) {
+		t.Fatal("token of orders was reissued")
+	}
+	if _, err := os.Stat(filepath.Join(directory, "cache-extension.payments.token")); !os.IsNotExist(err) {
+		t.Fatalf("token file of payments was not removed: %v", err)
+	}
+	if IsAllowed("payments", Parameters, "CacheExtensionDemo") {
+		t.Fatal("revoked token is still allowed")
+	}
+}
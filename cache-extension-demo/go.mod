@@ -1,9 +1,30 @@
 module aws-lambda-extensions/cache-extension-demo
 
-go 1.14
+go 1.25.0
 
 require (
-	github.com/aws/aws-sdk-go v1.36.12
+	github.com/aws/aws-sdk-go v1.55.8
 	github.com/gorilla/mux v1.8.0
 	gopkg.in/yaml.v2 v2.4.0
-)
\ No newline at end of file
+)
+
+require (
+	aws-lambda-extensions/go-example-ipc-transport v0.0.0
+	google.golang.org/grpc v1.84.0
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.2-0.20180830191138-d8f796af33cc // indirect
+	github.com/jmespath/go-jmespath v0.4.0 // indirect
+	github.com/kr/pretty v0.3.1 // indirect
+	github.com/pmezard/go-difflib v1.0.1-0.20181226105442-5d4384ee4fb2 // indirect
+	github.com/rogpeppe/go-internal v1.14.1 // indirect
+	golang.org/x/net v0.57.0 // indirect
+	golang.org/x/sys v0.47.0 // indirect
+	golang.org/x/text v0.40.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20260706201446-f0a921348800 // indirect
+	google.golang.org/protobuf v1.36.11 // indirect
+	gopkg.in/check.v1 v1.0.0-20201130134442-10cb98267c6c // indirect
+)
+
+replace aws-lambda-extensions/go-example-ipc-transport => ../go-example-ipc-transport
@@ -0,0 +1,70 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package ipc
+
+import (
+	"aws-lambda-extensions/cache-extension-demo/extension"
+	"aws-lambda-extensions/cache-extension-demo/plugins"
+	"aws-lambda-extensions/go-example-ipc-transport/ipcpb"
+	"context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var errNotAdmin = status.Error(codes.PermissionDenied, "token not allowed to call admin methods")
+
+// Implementation of the Cache gRPC service, equivalent to the HTTP endpoints
+type cacheServer struct {
+	ipcpb.UnimplementedCacheServer
+}
+
+func (s *cacheServer) Get(ctx context.Context, req *ipcpb.CacheGetRequest) (*ipcpb.CacheGetResponse, error) {
+	if !isAllowed(ctx, req.CacheType, req.Name) {
+		return nil, status.Error(codes.PermissionDenied, "token not allowed to read "+req.Name)
+	}
+	value := extension.RouteCache(req.CacheType, req.Name)
+	return &ipcpb.CacheGetResponse{Value: value, Found: len(value) != 0}, nil
+}
+
+func (s *cacheServer) Invalidate(ctx context.Context, req *ipcpb.InvalidateRequest) (*ipcpb.InvalidateResponse, error) {
+	if !isAdmin(ctx) {
+		return nil, errNotAdmin
+	}
+	count := extension.InvalidateCache(req.CacheType, req.Name, req.Prefix)
+	println(plugins.PrintPrefix, "Invalidated", count, "cache entries")
+	return &ipcpb.InvalidateResponse{Invalidated: int64(count)}, nil
+}
+
+func (s *cacheServer) Warmup(ctx context.Context, req *ipcpb.WarmupRequest) (*ipcpb.WarmupResponse, error) {
+	if !isAdmin(ctx) {
+		return nil, errNotAdmin
+	}
+	extension.WarmCache()
+	return &ipcpb.WarmupResponse{}, nil
+}
+
+func (s *cacheServer) Stats(ctx context.Context, req *ipcpb.CacheStatsRequest) (*ipcpb.CacheStats, error) {
+	if !isAdmin(ctx) {
+		return nil, errNotAdmin
+	}
+	providers := make(map[string]*ipcpb.ProviderStats)
+	for provider, stats := range plugins.GetStats() {
+		providers[provider] = &ipcpb.ProviderStats{
+			Hits:              stats.Hits,
+			Misses:            stats.Misses,
+			Errors:            stats.Errors,
+			Fetches:           stats.Fetches,
+			FetchLatencyMs:    stats.FetchLatencyMs,
+			MaxFetchLatencyMs: stats.MaxFetchLatencyMs,
+			Invalidations:     stats.Invalidations,
+			LastInvalidation:  stats.LastInvalidation,
+			Evictions:         stats.Evictions,
+			EvictedBytes:      stats.EvictedBytes,
+			Rejections:        stats.Rejections,
+			Entries:           stats.Entries,
+			Bytes:             stats.Bytes,
+		}
+	}
+	return &ipcpb.CacheStats{Providers: providers}, nil
+}
@@ -6,21 +6,50 @@ package ipc
 import (
 	"aws-lambda-extensions/cache-extension-demo/extension"
 	"aws-lambda-extensions/cache-extension-demo/plugins"
+	"aws-lambda-extensions/go-example-ipc-transport/ipcpb"
+	"aws-lambda-extensions/go-example-ipc-transport/transport"
+	"context"
+	"encoding/json"
 	"github.com/gorilla/mux"
+	"google.golang.org/grpc"
 	"net/http"
+	"os"
 )
 
-// Start begins running the sidecar
-func Start(port string) {
-	go startHTTPServer(port)
+// Constants definition
+const (
+	SocketPath            = "CACHE_EXTENSION_SOCKET_PATH"
+	defaultSocketPath     = "/tmp/cache-extension.sock"
+	GrpcSocketPath        = "CACHE_EXTENSION_GRPC_SOCKET_PATH"
+	defaultGrpcSocketPath = "/tmp/cache-extension.grpc.sock"
+)
+
+// Start begins running the sidecar, serving the cache over HTTP on the port and on a Unix socket,
+// and over gRPC on another Unix socket
+func Start(port string) (*transport.Server, error) {
+	config := transport.Config{
+		HTTPAddress: "localhost:" + port,
+		HTTPSocket:  getEnvOrDefault(SocketPath, defaultSocketPath),
+		GRPCSocket:  getEnvOrDefault(GrpcSocketPath, defaultGrpcSocketPath),
+		Auth:        extension.Authenticator,
+	}
+	println(plugins.PrintPrefix, "Starting Httpserver on port ", port, "and socket", config.HTTPSocket)
+	println(plugins.PrintPrefix, "Starting gRPC server on socket", config.GRPCSocket)
+	return transport.Serve(config, newRouter(), func(server *grpc.Server) {
+		ipcpb.RegisterCacheServer(server, &cacheServer{})
+	})
 }
 
-// Method that responds back with the cached values
-func startHTTPServer(port string) {
+// Router of the HTTP endpoints that respond back with the cached values
+func newRouter() *mux.Router {
 	router := mux.NewRouter()
 	router.Path("/{cacheType}").Queries("name", "{name}").HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
 			vars := mux.Vars(r)
+			if !isAllowed(r.Context(), vars["cacheType"], vars["name"]) {
+				http.Error(w, "Token not allowed to read "+vars["name"], http.StatusForbidden)
+				return
+			}
 			value := extension.RouteCache(vars["cacheType"], vars["name"])
 
 			if len(value) != 0 {
@@ -30,9 +59,63 @@ func startHTTPServer(port string) {
 			}
 		})
 
-	println(plugins.PrintPrefix, "Starting Httpserver on port ", port)
-	err := http.ListenAndServe(":"+port, router)
+	// Admin endpoints used by the function to control the cache
+	router.Path("/admin/invalidate").Methods("POST").HandlerFunc(adminOnly(
+		func(w http.ResponseWriter, r *http.Request) {
+			query := r.URL.Query()
+			count := extension.InvalidateCache(query.Get("cacheType"), query.Get("name"), query.Get("prefix"))
+			println(plugins.PrintPrefix, "Invalidated", count, "cache entries")
+			writeJSON(w, map[string]int{"invalidated": count})
+		}))
+	router.Path("/admin/warmup").Methods("POST").HandlerFunc(adminOnly(
+		func(w http.ResponseWriter, r *http.Request) {
+			extension.WarmCache()
+			writeJSON(w, map[string]string{"status": "OK"})
+		}))
+	router.Path("/admin/stats").Methods("GET").HandlerFunc(adminOnly(
+		func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, plugins.GetStats())
+		}))
+
+	return router
+}
+
+// Restrict the handler to the default token, restricted tokens can only read their keys
+func adminOnly(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(r.Context()) {
+			http.Error(w, "Token not allowed to call admin endpoints", http.StatusForbidden)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// Check the allowlist of the token authenticated by the transport
+func isAllowed(ctx context.Context, cacheType string, name string) bool {
+	token, ok := transport.TokenName(ctx)
+	return ok && extension.IsAllowed(token, cacheType, name)
+}
+
+func isAdmin(ctx context.Context) bool {
+	token, ok := transport.TokenName(ctx)
+	return ok && extension.IsAdmin(token)
+}
+
+func getEnvOrDefault(name string, defaultValue string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// Write the value as a JSON response
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	data, err := json.Marshal(v)
 	if err != nil {
-		panic(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
 }
@@ -0,0 +1,55 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package ipc
+
+import (
+	"aws-lambda-extensions/cache-extension-demo/extension"
+	"aws-lambda-extensions/go-example-ipc-transport/transport"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestAdminOnly(t *testing.T) {
+	directory := t.TempDir()
+	tokens := make(map[string]string)
+	for _, name := range []string{extension.DefaultToken, "reader"} {
+		token, err := extension.Authenticator.Issue(name, filepath.Join(directory, name+".token"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens[name] = token
+		defer extension.Authenticator.Revoke(name)
+	}
+	server := httptest.NewServer(extension.Authenticator.Middleware(newRouter()))
+	defer server.Close()
+
+	for _, test := range []struct {
+		token  string
+		method string
+		path   string
+		status int
+	}{
+		{extension.DefaultToken, "GET", "/admin/stats", http.StatusOK},
+		{extension.DefaultToken, "POST", "/admin/invalidate?cacheType=parameters&prefix=/orders/", http.StatusOK},
+		{"reader", "GET", "/admin/stats", http.StatusForbidden},
+		{"reader", "POST", "/admin/invalidate?cacheType=parameters&prefix=/orders/", http.StatusForbidden},
+		{"reader", "POST", "/admin/warmup", http.StatusForbidden},
+		{"", "GET", "/admin/stats", http.StatusUnauthorized},
+	} {
+		req, _ := http.NewRequest(test.method, server.URL+test.path, nil)
+		if token, ok := tokens[test.token]; ok {
+			req.Header.Set(transport.TokenHeader, token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.status {
+			t.Errorf("%s %s with token %q returned %s, expected %d", test.method, test.path, test.token, resp.Status, test.status)
+		}
+	}
+}
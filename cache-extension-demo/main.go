@@ -11,6 +11,7 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 )
 
 var (
@@ -35,14 +36,32 @@ func main() {
 	}
 	println(plugins.PrintPrefix, "Register response:", plugins.PrettyPrint(res))
 
-	// Initialize all the cache plugins
-	extension.InitCacheExtensions()
+	// Initialize all the cache plugins, an invalid configuration fails the INIT phase
+	err = extension.InitCacheExtensions()
+	if err != nil {
+		println(plugins.PrintPrefix, "Error:", err.Error())
+		_, err = extensionClient.InitError(ctx, "Extension.InvalidConfig", err.Error())
+		if err != nil {
+			println(plugins.PrintPrefix, "Cannot report InitError", err.Error())
+		}
+		println(plugins.PrintPrefix, "Exiting")
+		os.Exit(1)
+	}
 
-	// Start HTTP server
-	ipc.Start("4000")
+	// Pick up configuration changes without a cold start
+	go extension.ReloadConfigPeriodically(ctx)
+
+	// Start HTTP and gRPC servers
+	server, err := ipc.Start("4000")
+	if err != nil {
+		panic(err)
+	}
 
 	// Will block until shutdown event is received or cancelled via the context.
 	processEvents(ctx)
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancelShutdown()
+	_ = server.Shutdown(shutdownCtx)
 }
 
 // Method to process events
@@ -63,9 +82,13 @@ func processEvents(ctx context.Context) {
 			// Exit if we receive a SHUTDOWN event
 			if res.EventType == extension.Shutdown {
 				println(plugins.PrintPrefix, "Received SHUTDOWN event")
+				plugins.EmitStats()
 				println(plugins.PrintPrefix, "Exiting")
 				return
 			}
+
+			// Publish cache stats as EMF once "CACHE_EXTENSION_STATS_INTERVAL" has elapsed
+			plugins.EmitStatsIfDue()
 		}
 	}
 }
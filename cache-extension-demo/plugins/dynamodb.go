@@ -4,23 +4,44 @@
 package plugins
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
-	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Name used for the dynamodb cache in stats
+	dynamodbProvider = "dynamodb"
+	// Lambda environment variable for overriding the Dynamodb endpoint, ex: DynamoDB Local
+	DynamodbEndpoint = "CACHE_EXTENSION_DYNAMODB_ENDPOINT"
+	// Modes for reading data from Dynamodb
+	ModeGetItem = "getitem"
+	ModeQuery   = "query"
 )
 
 // Struct to store Dynamodb cache confirmation
 type DynamodbConfiguration struct {
-	Table        string
-	HashKey      string
-	HashKeyType  string
-	HashKeyValue string
-	SortKey      string
-	SortKeyType  string
-	SortKeyValue string
+	Name                     string
+	Table                    string
+	Mode                     string
+	IndexName                string
+	HashKey                  string
+	HashKeyType              string
+	HashKeyValue             string
+	SortKey                  string
+	SortKeyType              string
+	SortKeyValue             string
+	ProjectionExpression     string
+	ExpressionAttributeNames map[string]string
+	Limit                    int64
 }
 
 // Struct for caching the information
@@ -30,97 +51,283 @@ type Dynamodb struct {
 }
 
 var dynamoDbCache = make(map[string]Dynamodb)
+var dynamoDbLock sync.RWMutex
 var dynamoDbClient = GetDynamoDbClient()
 
 // Initialize map and cache data (only if requested)
 func InitDynamodb(dynamodbConfiguration []DynamodbConfiguration, initializeCache bool) {
+	RegisterEvictCallback(dynamodbProvider, evictDynamodb)
 	for _, dynamodbConfig := range dynamodbConfiguration {
-		if initializeCache {
+		dynamoDbLock.RLock()
+		_, isItemPresent := dynamoDbCache[GetKey(dynamodbConfig)]
+		dynamoDbLock.RUnlock()
+		if isItemPresent {
+			println(PrintPrefix, GetKey(dynamodbConfig)+" already exists so skipping it")
+		} else if initializeCache {
 			// Read data from Dynamodb
 			GetData(dynamodbConfig)
 		} else {
+			dynamoDbLock.Lock()
 			dynamoDbCache[GetKey(dynamodbConfig)] = Dynamodb{
 				CacheData:             CacheData{},
 				DynamodbConfiguration: dynamodbConfig,
 			}
+			dynamoDbLock.Unlock()
+		}
+	}
+}
+
+// Drop the items that are no longer configured, or whose configuration changed, and initialize the new ones
+func ReloadDynamodb(dynamodbConfiguration []DynamodbConfiguration, initializeCache bool) {
+	var configs = make(map[string]DynamodbConfiguration)
+	for _, dynamodbConfig := range dynamodbConfiguration {
+		configs[GetKey(dynamodbConfig)] = dynamodbConfig
+	}
+
+	dynamoDbLock.Lock()
+	for key, dbCache := range dynamoDbCache {
+		if config, isConfigured := configs[key]; !isConfigured || !reflect.DeepEqual(config, dbCache.DynamodbConfiguration) {
+			delete(dynamoDbCache, key)
+			forgetEntry(dynamodbProvider, key)
 		}
 	}
+	dynamoDbLock.Unlock()
+
+	InitDynamodb(dynamodbConfiguration, initializeCache)
 }
 
 // Read data from Dynamodb
 func GetData(dynamodbConfig DynamodbConfiguration) string {
 	if dynamodbConfig.HashKey != "" {
-		// Create attributeValue map based on hash and sort key
-		var attributeMap = map[string]*dynamodb.AttributeValue{}
-		UpdateAttributeMap(attributeMap, dynamodbConfig)
-
-		result, err := dynamoDbClient.GetItem(&dynamodb.GetItemInput{
-			TableName: aws.String(dynamodbConfig.Table),
-			Key:       attributeMap,
-		})
+		var value string
+		var err error
+
+		start := time.Now()
+		if strings.ToLower(dynamodbConfig.Mode) == ModeQuery {
+			value, err = queryItems(dynamodbConfig)
+		} else {
+			value, err = getItem(dynamodbConfig)
+		}
+		RecordFetch(dynamodbProvider, start, err == nil)
 		if err != nil {
-			if aerr, ok := err.(awserr.Error); ok {
-				switch aerr.Code() {
-				case dynamodb.ErrCodeProvisionedThroughputExceededException:
-					println(dynamodb.ErrCodeProvisionedThroughputExceededException, aerr.Error())
-				case dynamodb.ErrCodeResourceNotFoundException:
-					println(dynamodb.ErrCodeResourceNotFoundException, aerr.Error())
-				case dynamodb.ErrCodeRequestLimitExceeded:
-					println(dynamodb.ErrCodeRequestLimitExceeded, aerr.Error())
-				case dynamodb.ErrCodeInternalServerError:
-					println(dynamodb.ErrCodeInternalServerError, aerr.Error())
-				default:
-					println(PrintPrefix, PrettyPrint(aerr.Error()))
-				}
-			} else {
-				println(PrintPrefix, PrettyPrint(err.Error()))
-			}
+			printDynamodbError(err)
 			return ""
 		}
-		if result.Item == nil {
+		if value == "" {
 			println(PrintPrefix, "Could not find '"+dynamodbConfig.HashKeyValue+"'")
 			return ""
 		}
 
-		// Convert data from Map to JSON string
-		var data = make(map[string]string)
-		_ = dynamodbattribute.UnmarshalMap(result.Item, &data)
-
-		// Convert map to JSON string
-		jsonData, err := json.Marshal(data)
-		if err != nil {
-			println(err.Error())
-		}
-
 		// Add it to the cache
-		var value = string(jsonData)
-		dynamoDbCache[GetKey(dynamodbConfig)] = Dynamodb{
-			CacheData: CacheData{
+		var key = GetKey(dynamodbConfig)
+		var cacheData = CacheData{}
+		dynamoDbLock.Lock()
+		isCached, evicted := TrackEntry(dynamodbProvider, key, value)
+		if isCached {
+			cacheData = CacheData{
 				Data:        value,
 				CacheExpiry: GetCacheExpiry(),
-			},
+			}
+		}
+		dynamoDbCache[key] = Dynamodb{
+			CacheData:             cacheData,
 			DynamodbConfiguration: dynamodbConfig,
 		}
+		dynamoDbLock.Unlock()
+		evicted.Release()
 
 		return value
 	} else {
-		println(PrintPrefix, "HashKey not available so caching will not be enabled for %s", dynamodbConfig.HashKey)
+		println(PrintPrefix, "HashKey not available so caching will not be enabled for", GetKey(dynamodbConfig))
 		return ""
 	}
 }
 
-// Generate key to store in map based with a format "tableName+"-"+hashKeyValue+"-"+sortKeyValue"
+// Read a single item with GetItem and convert it to a JSON object, returns "" if the item does not exist
+func getItem(dynamodbConfig DynamodbConfiguration) (string, error) {
+	// Create attributeValue map based on hash and sort key
+	var attributeMap = map[string]*dynamodb.AttributeValue{}
+	UpdateAttributeMap(attributeMap, dynamodbConfig)
+
+	var input = &dynamodb.GetItemInput{
+		TableName: aws.String(dynamodbConfig.Table),
+		Key:       attributeMap,
+	}
+	if dynamodbConfig.ProjectionExpression != "" {
+		input.ProjectionExpression = aws.String(dynamodbConfig.ProjectionExpression)
+	}
+	if len(dynamodbConfig.ExpressionAttributeNames) > 0 {
+		input.ExpressionAttributeNames = aws.StringMap(dynamodbConfig.ExpressionAttributeNames)
+	}
+
+	result, err := dynamoDbClient.GetItem(input)
+	if err != nil {
+		return "", err
+	}
+	if result.Item == nil {
+		return "", nil
+	}
+
+	// Convert map to JSON string
+	jsonData, err := json.Marshal(ItemToJSON(result.Item))
+	if err != nil {
+		return "", err
+	}
+	return string(jsonData), nil
+}
+
+// Query the items of a partition and convert them to a JSON array. With a sort key value, the items
+// whose sort key begins with it are read for S and B keys, and the items whose sort key is equal
+// to it for N keys, since begins_with does not apply to numbers. The query stops once "Limit"
+// items have been read
+func queryItems(dynamodbConfig DynamodbConfiguration) (string, error) {
+	var attributeValues = map[string]*dynamodb.AttributeValue{}
+	GetAttributeValue(attributeValues, ":hashKey", dynamodbConfig.HashKeyValue, dynamodbConfig.HashKeyType)
+	var attributeNames = map[string]*string{"#hashKey": aws.String(dynamodbConfig.HashKey)}
+	var keyCondition = "#hashKey = :hashKey"
+	if dynamodbConfig.SortKey != "" && dynamodbConfig.SortKeyValue != "" {
+		GetAttributeValue(attributeValues, ":sortKey", dynamodbConfig.SortKeyValue, dynamodbConfig.SortKeyType)
+		attributeNames["#sortKey"] = aws.String(dynamodbConfig.SortKey)
+		if dynamodbConfig.SortKeyType == "N" {
+			keyCondition += " AND #sortKey = :sortKey"
+		} else {
+			keyCondition += " AND begins_with(#sortKey, :sortKey)"
+		}
+	}
+	for name, attribute := range dynamodbConfig.ExpressionAttributeNames {
+		attributeNames[name] = aws.String(attribute)
+	}
+
+	var input = &dynamodb.QueryInput{
+		TableName:                 aws.String(dynamodbConfig.Table),
+		KeyConditionExpression:    aws.String(keyCondition),
+		ExpressionAttributeNames:  attributeNames,
+		ExpressionAttributeValues: attributeValues,
+	}
+	if dynamodbConfig.IndexName != "" {
+		input.IndexName = aws.String(dynamodbConfig.IndexName)
+	}
+	if dynamodbConfig.ProjectionExpression != "" {
+		input.ProjectionExpression = aws.String(dynamodbConfig.ProjectionExpression)
+	}
+	if dynamodbConfig.Limit > 0 {
+		input.Limit = aws.Int64(dynamodbConfig.Limit)
+	}
+
+	var items = make([]interface{}, 0)
+	err := dynamoDbClient.QueryPages(input, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			items = append(items, ItemToJSON(item))
+		}
+		return dynamodbConfig.Limit <= 0 || int64(len(items)) < dynamodbConfig.Limit
+	})
+	if err != nil {
+		return "", err
+	}
+	if dynamodbConfig.Limit > 0 && int64(len(items)) > dynamodbConfig.Limit {
+		items = items[:dynamodbConfig.Limit]
+	}
+
+	jsonData, err := json.Marshal(items)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonData), nil
+}
+
+// Print Dynamodb errors
+func printDynamodbError(err error) {
+	if aerr, ok := err.(awserr.Error); ok {
+		switch aerr.Code() {
+		case dynamodb.ErrCodeProvisionedThroughputExceededException:
+			println(dynamodb.ErrCodeProvisionedThroughputExceededException, aerr.Error())
+		case dynamodb.ErrCodeResourceNotFoundException:
+			println(dynamodb.ErrCodeResourceNotFoundException, aerr.Error())
+		case dynamodb.ErrCodeRequestLimitExceeded:
+			println(dynamodb.ErrCodeRequestLimitExceeded, aerr.Error())
+		case dynamodb.ErrCodeInternalServerError:
+			println(dynamodb.ErrCodeInternalServerError, aerr.Error())
+		default:
+			println(PrintPrefix, PrettyPrint(aerr.Error()))
+		}
+	} else {
+		println(PrintPrefix, PrettyPrint(err.Error()))
+	}
+}
+
+// Convert an item to a value that marshals to JSON without losing data
+func ItemToJSON(item map[string]*dynamodb.AttributeValue) map[string]interface{} {
+	var result = make(map[string]interface{}, len(item))
+	for name, attribute := range item {
+		result[name] = AttributeToJSON(attribute)
+	}
+	return result
+}
+
+// Convert an attribute of any type to a value that marshals to JSON. Numbers keep their exact
+// representation, binary values and sets are encoded as base64 strings
+func AttributeToJSON(attribute *dynamodb.AttributeValue) interface{} {
+	switch {
+	case attribute == nil:
+		return nil
+	case attribute.S != nil:
+		return *attribute.S
+	case attribute.N != nil:
+		return json.Number(*attribute.N)
+	case attribute.BOOL != nil:
+		return *attribute.BOOL
+	case attribute.NULL != nil:
+		return nil
+	case attribute.B != nil:
+		return attribute.B
+	case attribute.SS != nil:
+		return aws.StringValueSlice(attribute.SS)
+	case attribute.NS != nil:
+		var numbers = make([]json.Number, 0, len(attribute.NS))
+		for _, number := range attribute.NS {
+			numbers = append(numbers, json.Number(aws.StringValue(number)))
+		}
+		return numbers
+	case attribute.BS != nil:
+		return attribute.BS
+	case attribute.L != nil:
+		var list = make([]interface{}, 0, len(attribute.L))
+		for _, element := range attribute.L {
+			list = append(list, AttributeToJSON(element))
+		}
+		return list
+	case attribute.M != nil:
+		return ItemToJSON(attribute.M)
+	default:
+		return nil
+	}
+}
+
+// Generate key to store in map based with a format "tableName+"-"+hashKeyValue+"-"+sortKeyValue",
+// unless a name is configured
 func GetKey(dynamodbConfig DynamodbConfiguration) string {
+	if dynamodbConfig.Name != "" {
+		return dynamodbConfig.Name
+	}
 	var key = dynamodbConfig.Table + "-" + dynamodbConfig.HashKeyValue
 	if dynamodbConfig.SortKey != "" {
 		key += "-" + dynamodbConfig.SortKeyValue
 	}
+	// A query and a getitem of the same keys cache different values
+	if strings.ToLower(dynamodbConfig.Mode) == ModeQuery {
+		key += "-" + ModeQuery
+	}
 	return key
 }
 
 // Get Dynamodb to read data
 func GetDynamoDbClient() *dynamodb.DynamoDB {
+	var config = aws.Config{}
+	if endpoint := os.Getenv(DynamodbEndpoint); endpoint != "" {
+		config.Endpoint = aws.String(endpoint)
+	}
 	sess := session.Must(session.NewSessionWithOptions(session.Options{
+		Config:            config,
 		SharedConfigState: session.SharedConfigEnable,
 	}))
 
@@ -136,24 +343,98 @@ func UpdateAttributeMap(attributeMap map[string]*dynamodb.AttributeValue, dynamo
 	}
 }
 
-// Supports attributeValue with data types "S" and "N"
+// Supports attributeValue with data types "S", "N" and "B" (base64 encoded value)
 func GetAttributeValue(attributeMap map[string]*dynamodb.AttributeValue, key string, value string, keyType string) {
 	switch keyType {
 	case "S":
 		attributeMap[key] = &dynamodb.AttributeValue{S: aws.String(value)}
 	case "N":
 		attributeMap[key] = &dynamodb.AttributeValue{N: aws.String(value)}
+	case "B":
+		data, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			println(PrintPrefix, "Error while decoding binary key value", key, err.Error())
+			return
+		}
+		attributeMap[key] = &dynamodb.AttributeValue{B: data}
 	}
 }
 
 // Fetch Dynamodb cache
 func GetDynamodbCache(name string) string {
+	dynamoDbLock.RLock()
 	var dbCache = dynamoDbCache[name]
+	dynamoDbLock.RUnlock()
 
 	// If expired or not available in cache then read it from Dynamodb, else return from cache
 	if dbCache.CacheData.Data == "" || IsExpired(dbCache.CacheData.CacheExpiry) {
-		return GetData(dynamoDbCache[name].DynamodbConfiguration)
+		RecordMiss(dynamodbProvider)
+		return GetData(dbCache.DynamodbConfiguration)
 	} else {
-		return dynamoDbCache[name].CacheData.Data
+		RecordHit(dynamodbProvider)
+		TouchEntry(dynamodbProvider, name)
+		return dbCache.CacheData.Data
+	}
+}
+
+// Drop the cached item stored under the key so that the next read goes to Dynamodb
+func InvalidateDynamodb(name string) int {
+	return invalidateDynamodb(func(key string) bool { return key == name })
+}
+
+// Drop every cached item whose key starts with the prefix, ex: "<table>-" for a whole table
+func InvalidateDynamodbPrefix(prefix string) int {
+	return invalidateDynamodb(func(key string) bool { return strings.HasPrefix(key, prefix) })
+}
+
+// Drop every cached item
+func InvalidateAllDynamodb() int {
+	return invalidateDynamodb(func(key string) bool { return true })
+}
+
+// Reset the cache data of matching items while keeping their configuration
+func invalidateDynamodb(matches func(string) bool) int {
+	dynamoDbLock.Lock()
+	defer dynamoDbLock.Unlock()
+
+	var count = 0
+	for key, dbCache := range dynamoDbCache {
+		if matches(key) && dbCache.CacheData.Data != "" {
+			dynamoDbCache[key] = Dynamodb{
+				CacheData:             CacheData{},
+				DynamodbConfiguration: dbCache.DynamodbConfiguration,
+			}
+			forgetEntry(dynamodbProvider, key)
+			count++
+		}
+	}
+	RecordInvalidation(dynamodbProvider, count)
+	return count
+}
+
+// Drop an item evicted from the memory budget while keeping its configuration
+func evictDynamodb(key string) {
+	dynamoDbLock.Lock()
+	defer dynamoDbLock.Unlock()
+
+	if dbCache, isPresent := dynamoDbCache[key]; isPresent && !isTracked(dynamodbProvider, key) {
+		dynamoDbCache[key] = Dynamodb{
+			CacheData:             CacheData{},
+			DynamodbConfiguration: dbCache.DynamodbConfiguration,
+		}
+	}
+}
+
+// Read every configured item from Dynamodb and update the cache
+func RefreshDynamodb() {
+	dynamoDbLock.RLock()
+	var configs = make([]DynamodbConfiguration, 0, len(dynamoDbCache))
+	for _, dbCache := range dynamoDbCache {
+		configs = append(configs, dbCache.DynamodbConfiguration)
+	}
+	dynamoDbLock.RUnlock()
+
+	for _, dynamodbConfig := range configs {
+		GetData(dynamodbConfig)
 	}
 }
@@ -0,0 +1,232 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package plugins
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Points the client to DynamoDB Local and creates a table with a string hash key and a sort key of
+// the type, deleted at the end of the test. Start DynamoDB Local and set the endpoint to run them, ex:
+//
+//	docker run -p 8000:8000 amazon/dynamodb-local
+//	CACHE_EXTENSION_DYNAMODB_ENDPOINT=http://localhost:8000 go test ./plugins/
+func dynamodbLocalTable(t *testing.T, sortKeyType string) string {
+	endpoint := os.Getenv(DynamodbEndpoint)
+	if endpoint == "" {
+		t.Skipf("%s is not set, start DynamoDB Local to run this test", DynamodbEndpoint)
+	}
+	client := dynamoDbClient
+	dynamoDbClient = dynamodb.New(session.Must(session.NewSession(&aws.Config{
+		Endpoint:    aws.String(endpoint),
+		Region:      aws.String("us-east-1"),
+		Credentials: credentials.NewStaticCredentials("local", "local", ""),
+	})))
+
+	table := fmt.Sprintf("cache-extension-test-%d", time.Now().UnixNano())
+	_, err := dynamoDbClient.CreateTable(&dynamodb.CreateTableInput{
+		TableName: aws.String(table),
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{AttributeName: aws.String("pk"), AttributeType: aws.String("S")},
+			{AttributeName: aws.String("sk"), AttributeType: aws.String(sortKeyType)},
+		},
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{AttributeName: aws.String("pk"), KeyType: aws.String("HASH")},
+			{AttributeName: aws.String("sk"), KeyType: aws.String("RANGE")},
+		},
+		BillingMode: aws.String(dynamodb.BillingModePayPerRequest),
+	})
+	if err != nil {
+		t.Fatalf("cannot create the table in DynamoDB Local: %v", err)
+	}
+	t.Cleanup(func() {
+		dynamoDbClient.DeleteTable(&dynamodb.DeleteTableInput{TableName: aws.String(table)})
+		dynamoDbClient = client
+	})
+	return table
+}
+
+func putItem(t *testing.T, table string, item map[string]*dynamodb.AttributeValue) {
+	t.Helper()
+	if _, err := dynamoDbClient.PutItem(&dynamodb.PutItemInput{TableName: aws.String(table), Item: item}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func putOrder(t *testing.T, table string, customer string, order string, total string) {
+	t.Helper()
+	putItem(t, table, map[string]*dynamodb.AttributeValue{
+		"pk":    {S: aws.String(customer)},
+		"sk":    {S: aws.String(order)},
+		"total": {N: aws.String(total)},
+		"tags":  {SS: aws.StringSlice([]string{"express"})},
+	})
+}
+
+func decode(t *testing.T, value string) interface{} {
+	t.Helper()
+	var document interface{}
+	if err := json.Unmarshal([]byte(value), &document); err != nil {
+		t.Fatalf("%q is not JSON: %v", value, err)
+	}
+	return document
+}
+
+func TestDynamodbGetItem(t *testing.T) {
+	table := dynamodbLocalTable(t, "S")
+	putOrder(t, table, "alice", "2024-01#1", "10.5")
+
+	config := DynamodbConfiguration{
+		Table: table, HashKey: "pk", HashKeyType: "S", HashKeyValue: "alice",
+		SortKey: "sk", SortKeyType: "S", SortKeyValue: "2024-01#1",
+	}
+	item, err := getItem(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item != `{"pk":"alice","sk":"2024-01#1","tags":["express"],"total":10.5}` {
+		t.Fatalf("unexpected item %s", item)
+	}
+
+	config.ProjectionExpression = "#total"
+	config.ExpressionAttributeNames = map[string]string{"#total": "total"}
+	if item, err := getItem(config); err != nil || item != `{"total":10.5}` {
+		t.Fatalf("unexpected projected item %s, %v", item, err)
+	}
+
+	config.SortKeyValue = "2024-01#2"
+	if item, err := getItem(config); err != nil || item != "" {
+		t.Fatalf("unexpected missing item %q, %v", item, err)
+	}
+}
+
+func TestDynamodbQueryBeginsWith(t *testing.T) {
+	table := dynamodbLocalTable(t, "S")
+	putOrder(t, table, "alice", "2024-01#1", "10")
+	putOrder(t, table, "alice", "2024-01#2", "20")
+	putOrder(t, table, "alice", "2024-02#1", "30")
+	putOrder(t, table, "bob", "2024-01#1", "40")
+
+	config := DynamodbConfiguration{
+		Table: table, Mode: ModeQuery, HashKey: "pk", HashKeyType: "S", HashKeyValue: "alice",
+		SortKey: "sk", SortKeyType: "S", SortKeyValue: "2024-01",
+	}
+	items, err := queryItems(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := len(decode(t, items).([]interface{})); count != 2 {
+		t.Fatalf("queried %d orders starting with 2024-01, expected 2: %s", count, items)
+	}
+
+	config.SortKeyValue = ""
+	items, err = queryItems(config)
+	if err != nil || len(decode(t, items).([]interface{})) != 3 {
+		t.Fatalf("unexpected orders of the partition %s, %v", items, err)
+	}
+
+	config.Limit = 2
+	config.ProjectionExpression = "#sk"
+	config.ExpressionAttributeNames = map[string]string{"#sk": "sk"}
+	items, err = queryItems(config)
+	if err != nil || items != `[{"sk":"2024-01#1"},{"sk":"2024-01#2"}]` {
+		t.Fatalf("unexpected limited orders %s, %v", items, err)
+	}
+}
+
+func TestDynamodbQueryNumericSortKey(t *testing.T) {
+	table := dynamodbLocalTable(t, "N")
+	for _, timestamp := range []string{"1", "2", "20"} {
+		putItem(t, table, map[string]*dynamodb.AttributeValue{
+			"pk": {S: aws.String("sensor")},
+			"sk": {N: aws.String(timestamp)},
+		})
+	}
+
+	// Numeric sort keys match exactly, 2 does not match 20
+	config := DynamodbConfiguration{
+		Table: table, Mode: ModeQuery, HashKey: "pk", HashKeyType: "S", HashKeyValue: "sensor",
+		SortKey: "sk", SortKeyType: "N", SortKeyValue: "2",
+	}
+	items, err := queryItems(config)
+	if err != nil || items != `[{"pk":"sensor","sk":2}]` {
+		t.Fatalf("unexpected readings %s, %v", items, err)
+	}
+}
+
+func TestDynamodbCache(t *testing.T) {
+	table := dynamodbLocalTable(t, "S")
+	putOrder(t, table, "alice", "2024-01#1", "10")
+
+	config := DynamodbConfiguration{
+		Name: "order", Table: table, HashKey: "pk", HashKeyType: "S", HashKeyValue: "alice",
+		SortKey: "sk", SortKeyType: "S", SortKeyValue: "2024-01#1", ProjectionExpression: "#total",
+		ExpressionAttributeNames: map[string]string{"#total": "total"},
+	}
+	InitDynamodb([]DynamodbConfiguration{config}, true)
+	t.Cleanup(func() {
+		ReloadDynamodb(nil, false)
+	})
+	if value := GetDynamodbCache("order"); value != `{"total":10}` {
+		t.Fatalf("unexpected cached order %s", value)
+	}
+
+	// Served from the cache until invalidated
+	putOrder(t, table, "alice", "2024-01#1", "15")
+	if value := GetDynamodbCache("order"); value != `{"total":10}` {
+		t.Fatalf("order %s was not served from the cache", value)
+	}
+	if count := InvalidateDynamodb("order"); count != 1 {
+		t.Fatalf("invalidated %d items", count)
+	}
+	if value := GetDynamodbCache("order"); value != `{"total":15}` {
+		t.Fatalf("order %s was not read again once invalidated", value)
+	}
+}
+
+func TestDynamodbKey(t *testing.T) {
+	config := DynamodbConfiguration{Table: "orders", HashKey: "pk", HashKeyValue: "alice", SortKey: "sk", SortKeyValue: "2024-01"}
+	if key := GetKey(config); key != "orders-alice-2024-01" {
+		t.Fatalf("unexpected getitem key %s", key)
+	}
+	config.Mode = "Query"
+	if key := GetKey(config); key != "orders-alice-2024-01-query" {
+		t.Fatalf("unexpected query key %s, expected it to differ from the getitem one", key)
+	}
+	config.Name = "order"
+	if key := GetKey(config); key != "order" {
+		t.Fatalf("unexpected named key %s", key)
+	}
+}
+
+func TestItemToJSON(t *testing.T) {
+	item := map[string]*dynamodb.AttributeValue{
+		"name":    {S: aws.String("alice")},
+		"balance": {N: aws.String("12345678901234567890.01")},
+		"active":  {BOOL: aws.Bool(true)},
+		"missing": {NULL: aws.Bool(true)},
+		"avatar":  {B: []byte("png")},
+		"scores":  {NS: aws.StringSlice([]string{"1", "2.5"})},
+		"address": {M: map[string]*dynamodb.AttributeValue{
+			"lines": {L: []*dynamodb.AttributeValue{{S: aws.String("1 Main St")}, {N: aws.String("42")}}},
+		}},
+	}
+	data, err := json.Marshal(ItemToJSON(item))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"active":true,"address":{"lines":["1 Main St",42]},"avatar":"cG5n","balance":12345678901234567890.01,"missing":null,"name":"alice","scores":[1,2.5]}`
+	if string(data) != expected {
+		t.Fatalf("converted to %s, expected %s", data, expected)
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package plugins
+
+import (
+	"container/list"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// Lambda environment variable with the memory size of the function in MB
+const (
+	FunctionMemorySize   = "AWS_LAMBDA_FUNCTION_MEMORY_SIZE"
+	defaultMaxBytes      = 16 * 1024 * 1024
+	defaultBudgetPercent = 10
+)
+
+// Struct for storing the memory budget of the cache, sizes are in bytes
+type MemoryConfiguration struct {
+	MaxBytes      int64
+	MaxEntryBytes int64
+}
+
+// Struct for tracking a cached value in the LRU list
+type memoryEntry struct {
+	provider string
+	key      string
+	size     int64
+}
+
+// Entries evicted from the LRU list whose values are still to be dropped from their provider cache
+type Evictions []*memoryEntry
+
+var (
+	memoryLock     sync.Mutex
+	memoryConfig   = MemoryConfiguration{MaxBytes: defaultMaxBytes, MaxEntryBytes: defaultMaxBytes / 4}
+	lruList        = list.New()
+	lruEntries     = make(map[string]*list.Element)
+	usedBytes      int64
+	evictCallbacks = make(map[string]func(string))
+)
+
+// Initialize the memory budget, missing values default to 10% of the function memory
+// and a quarter of the budget for a single entry. On reload, entries are evicted until the cache
+// fits in a smaller budget
+func InitMemory(config MemoryConfiguration) {
+	memoryLock.Lock()
+
+	if config.MaxBytes <= 0 {
+		config.MaxBytes = defaultMaxBytes
+		memorySize, err := strconv.ParseInt(os.Getenv(FunctionMemorySize), 10, 64)
+		if err == nil && memorySize > 0 {
+			config.MaxBytes = memorySize * 1024 * 1024 * defaultBudgetPercent / 100
+		}
+	}
+	if config.MaxEntryBytes <= 0 || config.MaxEntryBytes > config.MaxBytes {
+		config.MaxEntryBytes = config.MaxBytes / 4
+	}
+	memoryConfig = config
+	evicted := evictLeastRecent(0)
+	memoryLock.Unlock()
+
+	println(PrintPrefix, "Cache memory budget:", config.MaxBytes, "bytes, max entry size:", config.MaxEntryBytes, "bytes")
+	evicted.Release()
+}
+
+// Register the function used to drop an evicted entry from the cache of a provider
+func RegisterEvictCallback(provider string, evict func(key string)) {
+	memoryLock.Lock()
+	defer memoryLock.Unlock()
+	evictCallbacks[provider] = evict
+}
+
+// Account for a value stored in the cache and evict the least recently used entries until
+// the cache fits in the budget. Must be called with the lock of the provider cache held, and the
+// value stored before it is released, so that an eviction never leaves a value cached but not
+// tracked. Returns false if the value is larger than the per-entry limit, in which case it must
+// not be cached, and the evicted entries to release once the provider lock is released
+func TrackEntry(provider string, key string, value string) (bool, Evictions) {
+	size := int64(len(key) + len(value))
+
+	memoryLock.Lock()
+	if size > memoryConfig.MaxEntryBytes {
+		memoryLock.Unlock()
+		forgetEntry(provider, key)
+		RecordRejection(provider)
+		println(PrintPrefix, "Not caching", key, "as its size", size, "exceeds the max entry size")
+		return false, nil
+	}
+
+	lruKey := provider + ":" + key
+	if element, isPresent := lruEntries[lruKey]; isPresent {
+		entry := element.Value.(*memoryEntry)
+		usedBytes += size - entry.size
+		recordMemory(provider, 0, size-entry.size)
+		entry.size = size
+		lruList.MoveToFront(element)
+	} else {
+		lruEntries[lruKey] = lruList.PushFront(&memoryEntry{provider: provider, key: key, size: size})
+		usedBytes += size
+		recordMemory(provider, 1, size)
+	}
+
+	// The value just tracked is never evicted
+	evicted := evictLeastRecent(1)
+	memoryLock.Unlock()
+	return true, evicted
+}
+
+// Remove the least recently used entries from the LRU list until the cache fits in the budget,
+// keeping at least the given number of entries. Expects the LRU lock to be held
+func evictLeastRecent(keep int) Evictions {
+	var evicted Evictions
+	for usedBytes > memoryConfig.MaxBytes && lruList.Len() > keep {
+		entry := lruList.Remove(lruList.Back()).(*memoryEntry)
+		delete(lruEntries, entry.provider+":"+entry.key)
+		usedBytes -= entry.size
+		recordMemory(entry.provider, -1, -entry.size)
+		evicted = append(evicted, entry)
+	}
+	return evicted
+}
+
+// Drop the evicted values from their provider cache. Callbacks take the provider lock, so they
+// must run once the LRU lock and the provider lock are released
+func (evicted Evictions) Release() {
+	for _, entry := range evicted {
+		memoryLock.Lock()
+		callback := evictCallbacks[entry.provider]
+		memoryLock.Unlock()
+		if callback != nil {
+			callback(entry.key)
+		}
+		RecordEviction(entry.provider, entry.size)
+	}
+}
+
+// Tell if a value is accounted for in the budget. Eviction callbacks check it with the provider
+// lock held, since the value may have been stored again once evicted
+func isTracked(provider string, key string) bool {
+	memoryLock.Lock()
+	defer memoryLock.Unlock()
+	_, isPresent := lruEntries[provider+":"+key]
+	return isPresent
+}
+
+// Mark a cached value as recently used
+func TouchEntry(provider string, key string) {
+	memoryLock.Lock()
+	defer memoryLock.Unlock()
+
+	if element, isPresent := lruEntries[provider+":"+key]; isPresent {
+		lruList.MoveToFront(element)
+	}
+}
+
+// Release the memory accounted for a value dropped from the cache
+func forgetEntry(provider string, key string) {
+	memoryLock.Lock()
+	defer memoryLock.Unlock()
+
+	lruKey := provider + ":" + key
+	if element, isPresent := lruEntries[lruKey]; isPresent {
+		entry := lruList.Remove(element).(*memoryEntry)
+		delete(lruEntries, lruKey)
+		usedBytes -= entry.size
+		recordMemory(provider, -1, -entry.size)
+	}
+}
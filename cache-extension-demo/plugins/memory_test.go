@@ -0,0 +1,124 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package plugins
+
+import (
+	"sync"
+	"testing"
+)
+
+// Cache of a test provider, stored and evicted the way the providers do
+type testCache struct {
+	lock   sync.Mutex
+	values map[string]string
+}
+
+func newTestCache(t *testing.T, provider string, config MemoryConfiguration) *testCache {
+	cache := &testCache{values: make(map[string]string)}
+	InitMemory(config)
+	RegisterEvictCallback(provider, func(key string) {
+		cache.lock.Lock()
+		defer cache.lock.Unlock()
+		if !isTracked(provider, key) {
+			delete(cache.values, key)
+		}
+	})
+	t.Cleanup(func() {
+		for key := range cache.values {
+			forgetEntry(provider, key)
+		}
+		memoryLock.Lock()
+		delete(evictCallbacks, provider)
+		memoryLock.Unlock()
+		InitMemory(MemoryConfiguration{MaxBytes: defaultMaxBytes})
+	})
+	return cache
+}
+
+func (c *testCache) store(provider string, key string, value string) {
+	c.lock.Lock()
+	isCached, evicted := TrackEntry(provider, key, value)
+	if isCached {
+		c.values[key] = value
+	}
+	c.lock.Unlock()
+	evicted.Release()
+}
+
+func (c *testCache) keys() map[string]bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	keys := make(map[string]bool)
+	for key := range c.values {
+		keys[key] = true
+	}
+	return keys
+}
+
+func TestMemoryEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := newTestCache(t, "test-lru", MemoryConfiguration{MaxBytes: 25, MaxEntryBytes: 20})
+	cache.store("test-lru", "a", "123456789")
+	cache.store("test-lru", "b", "123456789")
+	TouchEntry("test-lru", "a")
+	cache.store("test-lru", "c", "123456789")
+
+	if keys := cache.keys(); !keys["a"] || keys["b"] || !keys["c"] {
+		t.Fatalf("cached %v, expected b to be evicted", keys)
+	}
+	cache.store("test-lru", "d", "123456789012345678901")
+	if keys := cache.keys(); keys["d"] || len(keys) != 2 {
+		t.Fatalf("cached %v, expected d to exceed the max entry size", keys)
+	}
+}
+
+func TestMemoryEvictsWhenBudgetShrinks(t *testing.T) {
+	cache := newTestCache(t, "test-shrink", MemoryConfiguration{MaxBytes: 100})
+	for _, key := range []string{"a", "b", "c", "d"} {
+		cache.store("test-shrink", key, "123456789")
+	}
+
+	InitMemory(MemoryConfiguration{MaxBytes: 20})
+	if keys := cache.keys(); len(keys) != 2 || !keys["c"] || !keys["d"] {
+		t.Fatalf("cached %v, expected the 2 most recent values to fit in the new budget", keys)
+	}
+	memoryLock.Lock()
+	used := usedBytes
+	memoryLock.Unlock()
+	if used != 20 {
+		t.Fatalf("%d bytes tracked for the remaining values", used)
+	}
+}
+
+func TestMemoryTracksConcurrentStores(t *testing.T) {
+	cache := newTestCache(t, "test-concurrent", MemoryConfiguration{MaxBytes: 50, MaxEntryBytes: 10})
+	var wait sync.WaitGroup
+	for worker := 0; worker < 8; worker++ {
+		wait.Add(1)
+		go func(worker int) {
+			defer wait.Done()
+			for idx := 0; idx < 500; idx++ {
+				cache.store("test-concurrent", string(rune('a'+(worker+idx)%20)), "12345678")
+			}
+		}(worker)
+	}
+	wait.Wait()
+
+	// Every cached value is tracked, and every tracked value is cached
+	for key := range cache.keys() {
+		if !isTracked("test-concurrent", key) {
+			t.Fatalf("%s is cached but not tracked", key)
+		}
+	}
+	memoryLock.Lock()
+	tracked := 0
+	for _, element := range lruEntries {
+		if element.Value.(*memoryEntry).provider == "test-concurrent" {
+			tracked++
+		}
+	}
+	memoryLock.Unlock()
+	if cached := len(cache.keys()); tracked != cached {
+		t.Fatalf("%d values tracked, %d cached", tracked, cached)
+	}
+}
@@ -4,55 +4,141 @@
 package plugins
 
 import (
+	"encoding/json"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/private/util"
 	"github.com/aws/aws-sdk-go/service/ssm"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Name used for the parameter cache in stats
+	parametersProvider = "parameters"
+	// Maximum number of names accepted by a single GetParameters call
+	maxGetParametersBatch = 10
 )
 
 // Struct for storing parameter cache configurations
 type ParameterConfiguration struct {
-	Region string
-	Names  []string
+	Region    string
+	Names     []string
+	Paths     []string
+	Recursive bool
 }
 
-// Struct for caching the information
+// Struct for caching the information, Path is set for parameters loaded from a path
 type Parameter struct {
 	CacheData CacheData
 	Region    string
+	Path      string
+}
+
+// Struct for caching the configuration of a path and when its children need to be reloaded
+type ParameterPath struct {
+	Region      string
+	Recursive   bool
+	CacheExpiry time.Time
 }
 
 var parameterCache = make(map[string]Parameter)
+var parameterPaths = make(map[string]ParameterPath)
+var parameterLock sync.RWMutex
 var regionCache = make(map[string]*ssm.SSM)
+var regionLock sync.Mutex
 
 // Initialize map and cache objects (if requested)
 func InitParameters(parameters []ParameterConfiguration, initializeCache bool) {
+	RegisterEvictCallback(parametersProvider, evictParameter)
 	for _, config := range parameters {
+		var names []string
+		parameterLock.Lock()
 		for _, parameter := range config.Names {
 			_, isParameterPresent := parameterCache[parameter]
 			if !isParameterPresent {
-				if initializeCache {
-					// Read from SSM and add it to the cache
-					GetParameter(parameter, config.Region, GetSsmClient(config.Region))
-				} else {
-					parameterCache[parameter] = Parameter{
-						CacheData: CacheData{},
-						Region:    config.Region,
-					}
+				parameterCache[parameter] = Parameter{
+					CacheData: CacheData{},
+					Region:    config.Region,
 				}
+				names = append(names, parameter)
 			} else {
 				println(PrintPrefix, parameter+" already exists so skipping it")
 			}
 		}
+		var paths []string
+		for _, path := range config.Paths {
+			path = normalizePath(path)
+			_, isPathPresent := parameterPaths[path]
+			if !isPathPresent {
+				parameterPaths[path] = ParameterPath{
+					Region:    config.Region,
+					Recursive: config.Recursive,
+				}
+				paths = append(paths, path)
+			} else {
+				println(PrintPrefix, path+" already exists so skipping it")
+			}
+		}
+		parameterLock.Unlock()
+
+		if initializeCache {
+			// Read from SSM in batches and add them to the cache
+			GetParameters(names, config.Region, GetSsmClient(config.Region))
+			for _, path := range paths {
+				GetParametersByPath(path)
+			}
+		}
 	}
 }
 
+// Drop the parameters and paths that are no longer configured and initialize the new ones
+func ReloadParameters(parameters []ParameterConfiguration, initializeCache bool) {
+	var regions = make(map[string]string)
+	var paths = make(map[string]ParameterPath)
+	for _, config := range parameters {
+		for _, parameter := range config.Names {
+			regions[parameter] = config.Region
+		}
+		for _, path := range config.Paths {
+			paths[normalizePath(path)] = ParameterPath{Region: config.Region, Recursive: config.Recursive}
+		}
+	}
+
+	parameterLock.Lock()
+	for path, parameterPath := range parameterPaths {
+		if config, isConfigured := paths[path]; !isConfigured ||
+			config.Region != parameterPath.Region || config.Recursive != parameterPath.Recursive {
+			delete(parameterPaths, path)
+		}
+	}
+	for name, parameter := range parameterCache {
+		var isConfigured bool
+		if parameter.Path != "" {
+			_, isConfigured = parameterPaths[parameter.Path]
+		} else {
+			region, isPresent := regions[name]
+			isConfigured = isPresent && region == parameter.Region
+		}
+		if !isConfigured {
+			delete(parameterCache, name)
+			forgetEntry(parametersProvider, name)
+		}
+	}
+	parameterLock.Unlock()
+
+	InitParameters(parameters, initializeCache)
+}
+
 // Initialize parameter cache
 func GetParameter(name string, region string, ssmsvc *ssm.SSM) string {
+	start := time.Now()
 	param, err := ssmsvc.GetParameter(&ssm.GetParameterInput{
 		Name:           aws.String(name),
 		WithDecryption: aws.Bool(true),
 	})
+	RecordFetch(parametersProvider, start, err == nil)
 	if err != nil {
 		println(PrintPrefix, "Error while fetching parameter ", name, util.PrettyPrint(err))
 		return ""
@@ -60,20 +146,124 @@ func GetParameter(name string, region string, ssmsvc *ssm.SSM) string {
 
 		// Read Parameter value from SSM and update cache
 		var value = *param.Parameter.Value
-		parameterCache[name] = Parameter{
-			CacheData: CacheData{
-				Data:        value,
-				CacheExpiry: GetCacheExpiry(),
-			},
-			Region: region,
+		storeParameter(name, value, region, "")
+		return value
+	}
+}
+
+// Read parameters from SSM in batches of 10 and update cache
+func GetParameters(names []string, region string, ssmsvc *ssm.SSM) {
+	for idx := 0; idx < len(names); idx += maxGetParametersBatch {
+		var batch = names[idx:]
+		if len(batch) > maxGetParametersBatch {
+			batch = batch[:maxGetParametersBatch]
 		}
 
-		return value
+		start := time.Now()
+		result, err := ssmsvc.GetParameters(&ssm.GetParametersInput{
+			Names:          aws.StringSlice(batch),
+			WithDecryption: aws.Bool(true),
+		})
+		RecordFetch(parametersProvider, start, err == nil)
+		if err != nil {
+			println(PrintPrefix, "Error while fetching parameters ", util.PrettyPrint(err))
+			continue
+		}
+
+		for _, param := range result.Parameters {
+			// Names requested with a version or label are returned without it
+			var name = aws.StringValue(param.Name) + aws.StringValue(param.Selector)
+			storeParameter(name, aws.StringValue(param.Value), region, "")
+		}
+		for _, name := range result.InvalidParameters {
+			println(PrintPrefix, "Parameter not found ", aws.StringValue(name))
+		}
+	}
+}
+
+// Read every parameter under a configured path from SSM, update cache and return them as a JSON object
+func GetParametersByPath(path string) string {
+	values := loadParameterPath(path)
+	if len(values) == 0 {
+		return ""
+	}
+	return marshalParameters(values)
+}
+
+// Read every parameter under a configured path from SSM and update cache
+func loadParameterPath(path string) map[string]string {
+	parameterLock.RLock()
+	parameterPath, isPathPresent := parameterPaths[path]
+	parameterLock.RUnlock()
+	if !isPathPresent {
+		return nil
+	}
+
+	var values = make(map[string]string)
+	start := time.Now()
+	err := GetSsmClient(parameterPath.Region).GetParametersByPathPages(&ssm.GetParametersByPathInput{
+		Path:           aws.String(path),
+		Recursive:      aws.Bool(parameterPath.Recursive),
+		WithDecryption: aws.Bool(true),
+	}, func(page *ssm.GetParametersByPathOutput, lastPage bool) bool {
+		for _, param := range page.Parameters {
+			values[aws.StringValue(param.Name)] = aws.StringValue(param.Value)
+		}
+		return true
+	})
+	RecordFetch(parametersProvider, start, err == nil)
+	if err != nil {
+		println(PrintPrefix, "Error while fetching parameters under path ", path, util.PrettyPrint(err))
+		return nil
+	}
+
+	// Drop the children that were deleted from SSM since the last load
+	parameterLock.Lock()
+	for name, parameter := range parameterCache {
+		if _, isFound := values[name]; parameter.Path == path && !isFound {
+			delete(parameterCache, name)
+			forgetEntry(parametersProvider, name)
+		}
+	}
+	parameterPath.CacheExpiry = GetCacheExpiry()
+	parameterPaths[path] = parameterPath
+	parameterLock.Unlock()
+
+	for name, value := range values {
+		storeParameter(name, value, parameterPath.Region, path)
+	}
+	return values
+}
+
+// Add a parameter value to the cache if it fits in the memory budget
+func storeParameter(name string, value string, region string, path string) {
+	var cacheData = CacheData{}
+	parameterLock.Lock()
+	isCached, evicted := TrackEntry(parametersProvider, name, value)
+	if isCached {
+		cacheData = CacheData{
+			Data:        value,
+			CacheExpiry: GetCacheExpiry(),
+		}
+	}
+	// A child of a cached path refetched on its own stays part of the path
+	if existing, isPresent := parameterCache[name]; path == "" && isPresent {
+		path = existing.Path
 	}
+	parameterCache[name] = Parameter{
+		CacheData: cacheData,
+		Region:    region,
+		Path:      path,
+	}
+	parameterLock.Unlock()
+	evicted.Release()
 }
 
 // Get SSM Client and cache it based on region
 func GetSsmClient(region string) *ssm.SSM {
+	regionLock.Lock()
+	defer regionLock.Unlock()
+
 	ssmClient, isCachePresent := regionCache[region]
 	if !isCachePresent {
 		sess, err := session.NewSessionWithOptions(session.Options{
@@ -92,12 +282,177 @@ func GetSsmClient(region string) *ssm.SSM {
 
 // Fetch Parameter cache
 func GetParameterCache(name string) string {
-	var parameter = parameterCache[name]
+	parameterLock.RLock()
+	parameter, isParameterPresent := parameterCache[name]
+	path, isPath := findParameterPath(normalizePath(name))
+	parameterLock.RUnlock()
+
+	// Names under a configured path that are not parameters themselves return all their children
+	if !isParameterPresent && isPath {
+		return getParameterPathCache(normalizePath(name), path)
+	}
 
 	// If expired or not available in cache then read it from SSM, else return from cache
 	if parameter.CacheData.Data == "" || IsExpired(parameter.CacheData.CacheExpiry) {
+		RecordMiss(parametersProvider)
 		return GetParameter(name, parameter.Region, GetSsmClient(parameter.Region))
 	} else {
-		return parameterCache[name].CacheData.Data
+		RecordHit(parametersProvider)
+		TouchEntry(parametersProvider, name)
+		return parameter.CacheData.Data
+	}
+}
+
+// Fetch the children of a path as a JSON object, the whole path is read again from SSM
+// if it has expired or if any of its children is no longer cached
+func getParameterPathCache(name string, path string) string {
+	var prefix = name + "/"
+	if name == "/" {
+		prefix = name
+	}
+
+	parameterLock.RLock()
+	var values = make(map[string]string)
+	var isComplete = !IsExpired(parameterPaths[path].CacheExpiry)
+	for childName, parameter := range parameterCache {
+		if parameter.Path == path && strings.HasPrefix(childName, prefix) {
+			values[childName] = parameter.CacheData.Data
+			isComplete = isComplete && parameter.CacheData.Data != ""
+		}
+	}
+	parameterLock.RUnlock()
+
+	if isComplete && len(values) > 0 {
+		RecordHit(parametersProvider)
+		for childName := range values {
+			TouchEntry(parametersProvider, childName)
+		}
+	} else {
+		RecordMiss(parametersProvider)
+		values = make(map[string]string)
+		for childName, value := range loadParameterPath(path) {
+			if strings.HasPrefix(childName, prefix) {
+				values[childName] = value
+			}
+		}
+	}
+
+	if len(values) == 0 {
+		return ""
+	}
+	return marshalParameters(values)
+}
+
+// Find the configured path that contains the name, must be called with parameterLock held
+func findParameterPath(name string) (string, bool) {
+	for path, parameterPath := range parameterPaths {
+		if name == path {
+			return path, true
+		}
+		var prefix = path + "/"
+		if path == "/" {
+			prefix = path
+		}
+		if parameterPath.Recursive && strings.HasPrefix(name, prefix) {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// Remove the trailing slash of a path, SSM rejects it in GetParametersByPath
+func normalizePath(path string) string {
+	if len(path) > 1 {
+		return strings.TrimSuffix(path, "/")
+	}
+	return path
+}
+
+// Convert the parameters of a path to a JSON object keyed by parameter name
+func marshalParameters(values map[string]string) string {
+	jsonData, err := json.Marshal(values)
+	if err != nil {
+		println(PrintPrefix, "Error while converting parameters to JSON", err.Error())
+		return ""
+	}
+	return string(jsonData)
+}
+
+// Drop the cached value of a parameter so that the next read goes to SSM
+func InvalidateParameter(name string) int {
+	return invalidateParameters(func(key string) bool { return key == name })
+}
+
+// Drop the cached value of every parameter whose name starts with the prefix
+func InvalidateParameterPrefix(prefix string) int {
+	return invalidateParameters(func(key string) bool { return strings.HasPrefix(key, prefix) })
+}
+
+// Drop the cached value of every parameter
+func InvalidateAllParameters() int {
+	return invalidateParameters(func(key string) bool { return true })
+}
+
+// Reset the cache data of matching parameters while keeping their configuration
+func invalidateParameters(matches func(string) bool) int {
+	parameterLock.Lock()
+	defer parameterLock.Unlock()
+
+	var count = 0
+	for path, parameterPath := range parameterPaths {
+		if matches(path) {
+			parameterPath.CacheExpiry = time.Time{}
+			parameterPaths[path] = parameterPath
+		}
+	}
+	for name, parameter := range parameterCache {
+		if matches(name) && parameter.CacheData.Data != "" {
+			parameterCache[name] = Parameter{
+				CacheData: CacheData{},
+				Region:    parameter.Region,
+				Path:      parameter.Path,
+			}
+			forgetEntry(parametersProvider, name)
+			count++
+		}
+	}
+	RecordInvalidation(parametersProvider, count)
+	return count
+}
+
+// Drop a parameter evicted from the memory budget while keeping its configuration
+func evictParameter(name string) {
+	parameterLock.Lock()
+	defer parameterLock.Unlock()
+
+	if parameter, isPresent := parameterCache[name]; isPresent && !isTracked(parametersProvider, name) {
+		parameterCache[name] = Parameter{
+			CacheData: CacheData{},
+			Region:    parameter.Region,
+			Path:      parameter.Path,
+		}
+	}
+}
+
+// Read every configured parameter and path from SSM and update the cache
+func RefreshParameters() {
+	parameterLock.RLock()
+	var namesByRegion = make(map[string][]string)
+	for name, parameter := range parameterCache {
+		if parameter.Path == "" {
+			namesByRegion[parameter.Region] = append(namesByRegion[parameter.Region], name)
+		}
+	}
+	var paths []string
+	for path := range parameterPaths {
+		paths = append(paths, path)
+	}
+	parameterLock.RUnlock()
+
+	for region, names := range namesByRegion {
+		GetParameters(names, region, GetSsmClient(region))
+	}
+	for _, path := range paths {
+		loadParameterPath(path)
 	}
 }
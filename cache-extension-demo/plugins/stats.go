@@ -0,0 +1,216 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package plugins
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Lambda environment variable for defining how often stats are emitted as EMF
+const (
+	StatsInterval        = "CACHE_EXTENSION_STATS_INTERVAL"
+	defaultStatsInterval = "60s"
+	metricsNamespace     = "CacheExtension"
+)
+
+// Struct for storing the counters of a single cache provider
+type ProviderStats struct {
+	Hits              int64   `json:"hits"`
+	Misses            int64   `json:"misses"`
+	Errors            int64   `json:"errors"`
+	Fetches           int64   `json:"fetches"`
+	FetchLatencyMs    float64 `json:"fetchLatencyMs"`
+	MaxFetchLatencyMs float64 `json:"maxFetchLatencyMs"`
+	Invalidations     int64   `json:"invalidations"`
+	LastInvalidation  string  `json:"lastInvalidation,omitempty"`
+	Evictions         int64   `json:"evictions"`
+	EvictedBytes      int64   `json:"evictedBytes"`
+	Rejections        int64   `json:"rejections"`
+	Entries           int64   `json:"entries"`
+	Bytes             int64   `json:"bytes"`
+}
+
+var (
+	statsLock     sync.Mutex
+	stats         = make(map[string]*ProviderStats)
+	emittedStats  = make(map[string]ProviderStats)
+	lastEmittedAt = time.Now()
+)
+
+// Count a request served from the cache
+func RecordHit(provider string) {
+	statsLock.Lock()
+	defer statsLock.Unlock()
+	getProviderStats(provider).Hits++
+}
+
+// Count a request that had to be read from the backing service
+func RecordMiss(provider string) {
+	statsLock.Lock()
+	defer statsLock.Unlock()
+	getProviderStats(provider).Misses++
+}
+
+// Count a fetch from the backing service along with its latency and outcome
+func RecordFetch(provider string, start time.Time, success bool) {
+	latency := float64(time.Since(start).Microseconds()) / 1000
+
+	statsLock.Lock()
+	defer statsLock.Unlock()
+	providerStats := getProviderStats(provider)
+	providerStats.Fetches++
+	providerStats.FetchLatencyMs += latency
+	if latency > providerStats.MaxFetchLatencyMs {
+		providerStats.MaxFetchLatencyMs = latency
+	}
+	if !success {
+		providerStats.Errors++
+	}
+}
+
+// Count the number of entries dropped from the cache by an invalidation
+func RecordInvalidation(provider string, count int) {
+	statsLock.Lock()
+	defer statsLock.Unlock()
+	providerStats := getProviderStats(provider)
+	providerStats.Invalidations += int64(count)
+	providerStats.LastInvalidation = time.Now().UTC().Format(time.RFC3339)
+}
+
+// Count an entry evicted from the cache to stay within the memory budget
+func RecordEviction(provider string, size int64) {
+	statsLock.Lock()
+	defer statsLock.Unlock()
+	providerStats := getProviderStats(provider)
+	providerStats.Evictions++
+	providerStats.EvictedBytes += size
+}
+
+// Count a value that was not cached because it exceeds the max entry size
+func RecordRejection(provider string) {
+	statsLock.Lock()
+	defer statsLock.Unlock()
+	getProviderStats(provider).Rejections++
+}
+
+// Update the number of entries and bytes held by the cache of a provider
+func recordMemory(provider string, entries int64, size int64) {
+	statsLock.Lock()
+	defer statsLock.Unlock()
+	providerStats := getProviderStats(provider)
+	providerStats.Entries += entries
+	providerStats.Bytes += size
+}
+
+// Return a copy of the cumulative stats of every provider
+func GetStats() map[string]ProviderStats {
+	statsLock.Lock()
+	defer statsLock.Unlock()
+
+	var result = make(map[string]ProviderStats)
+	for provider, providerStats := range stats {
+		result[provider] = *providerStats
+	}
+	return result
+}
+
+// Emit the stats as CloudWatch EMF lines if "CACHE_EXTENSION_STATS_INTERVAL" has elapsed since the last emit
+func EmitStatsIfDue() {
+	interval := getStatsInterval()
+
+	statsLock.Lock()
+	defer statsLock.Unlock()
+	if interval <= 0 || time.Since(lastEmittedAt) < interval {
+		return
+	}
+	emitStats()
+}
+
+// Emit one CloudWatch EMF line per provider with the counters accumulated since the last emit
+func EmitStats() {
+	statsLock.Lock()
+	defer statsLock.Unlock()
+	emitStats()
+}
+
+// Must be called with statsLock held
+func emitStats() {
+	now := time.Now()
+	for provider, providerStats := range stats {
+		previous := emittedStats[provider]
+		line, err := json.Marshal(map[string]interface{}{
+			"_aws": map[string]interface{}{
+				"Timestamp": now.UnixNano() / int64(time.Millisecond),
+				"CloudWatchMetrics": []map[string]interface{}{{
+					"Namespace":  metricsNamespace,
+					"Dimensions": [][]string{{"Provider"}},
+					"Metrics": []map[string]string{
+						{"Name": "Hits", "Unit": "Count"},
+						{"Name": "Misses", "Unit": "Count"},
+						{"Name": "Errors", "Unit": "Count"},
+						{"Name": "Invalidations", "Unit": "Count"},
+						{"Name": "Evictions", "Unit": "Count"},
+						{"Name": "Rejections", "Unit": "Count"},
+						{"Name": "CachedBytes", "Unit": "Bytes"},
+						{"Name": "FetchLatency", "Unit": "Milliseconds"},
+					},
+				}},
+			},
+			"Provider":      provider,
+			"Hits":          providerStats.Hits - previous.Hits,
+			"Misses":        providerStats.Misses - previous.Misses,
+			"Errors":        providerStats.Errors - previous.Errors,
+			"Invalidations": providerStats.Invalidations - previous.Invalidations,
+			"Evictions":     providerStats.Evictions - previous.Evictions,
+			"Rejections":    providerStats.Rejections - previous.Rejections,
+			"CachedBytes":   providerStats.Bytes,
+			"FetchLatency":  averageLatency(*providerStats, previous),
+		})
+		if err != nil {
+			println(PrintPrefix, "Error while marshalling stats", err.Error())
+			continue
+		}
+		fmt.Println(string(line))
+		emittedStats[provider] = *providerStats
+	}
+	lastEmittedAt = now
+}
+
+// Average fetch latency of the fetches made between two snapshots
+func averageLatency(current ProviderStats, previous ProviderStats) float64 {
+	fetches := current.Fetches - previous.Fetches
+	if fetches == 0 {
+		return 0
+	}
+	return (current.FetchLatencyMs - previous.FetchLatencyMs) / float64(fetches)
+}
+
+// Must be called with statsLock held
+func getProviderStats(provider string) *ProviderStats {
+	providerStats, isPresent := stats[provider]
+	if !isPresent {
+		providerStats = &ProviderStats{}
+		stats[provider] = providerStats
+	}
+	return providerStats
+}
+
+// Read "CACHE_EXTENSION_STATS_INTERVAL", a value of 0 disables the EMF output
+func getStatsInterval() time.Duration {
+	interval := os.Getenv(StatsInterval)
+	if interval == "" {
+		interval = defaultStatsInterval
+	}
+
+	duration, err := time.ParseDuration(interval)
+	if err != nil {
+		println(PrintPrefix, "Error while converting CACHE_EXTENSION_STATS_INTERVAL env variable", interval)
+		return 0
+	}
+	return duration
+}
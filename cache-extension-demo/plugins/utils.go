@@ -10,12 +10,14 @@ import (
 
 // Lambda environment variable for defining TTL
 const (
-	CacheTimeOut = "CACHE_EXTENSION_TTL"
+	CacheTimeOut        = "CACHE_EXTENSION_TTL"
+	defaultCacheTimeOut = 60 * time.Minute
 )
 
 var (
 	ExtensionName = filepath.Base(os.Args[0]) // extension name has to match the filename
 	PrintPrefix   = fmt.Sprintf("[%s] ", ExtensionName)
+	cacheTimeOut  = defaultCacheTimeOut
 )
 
 // Struct for storing cache data with expiry timestamp [time.Now() + CACHE_EXTENSION_TTL]
@@ -29,20 +31,26 @@ func IsExpired(cacheExpiry time.Time) bool {
 	return cacheExpiry.Before(time.Now())
 }
 
-// Return cache expiry timestamp based on "time.Now() + CACHE_EXTENSION_TTL"
-func GetCacheExpiry() time.Time {
+// Read and validate the "CACHE_EXTENSION_TTL" env variable, defaults to 60m
+func InitCacheTimeOut() error {
 	// Refresh cache is required via environment variable
 	timeOut := os.Getenv(CacheTimeOut)
 	if timeOut == "" {
-		timeOut = "60m"
+		cacheTimeOut = defaultCacheTimeOut
+		return nil
 	}
 
 	timeOutInMinutes, err := time.ParseDuration(timeOut)
-	if err != nil {
-		panic("Error while converting CACHE_EXTENSION_TTL env variable " + timeOut)
+	if err != nil || timeOutInMinutes <= 0 {
+		return fmt.Errorf("invalid CACHE_EXTENSION_TTL env variable %q, expected a positive Go duration, ex: 30s, 3m", timeOut)
 	}
+	cacheTimeOut = timeOutInMinutes
+	return nil
+}
 
-	return time.Now().Add(timeOutInMinutes)
+// Return cache expiry timestamp based on "time.Now() + CACHE_EXTENSION_TTL"
+func GetCacheExpiry() time.Time {
+	return time.Now().Add(cacheTimeOut)
 }
 
 // Method for pretty printing objects in logs
@@ -0,0 +1,534 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package main
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// Notes and layout of the Linux core files, the offsets of elf_prstatus are the same on x86_64 and arm64
+const (
+	ntPrstatus = 1
+	ntFile     = 0x46494c45
+
+	prstatusSignalOffset = 12
+	prstatusPidOffset    = 32
+	prstatusRegsOffset   = 112
+
+	maxFrames      = 64
+	stackScanBytes = 16 * 1024
+)
+
+var errNotCore = errors.New("not an ELF core file")
+
+// Names of the registers in the order of the NT_PRSTATUS notes
+var registerNames = map[elf.Machine][]string{
+	elf.EM_X86_64: {"r15", "r14", "r13", "r12", "rbp", "rbx", "r11", "r10", "r9", "r8", "rax", "rcx", "rdx",
+		"rsi", "rdi", "orig_rax", "rip", "cs", "eflags", "rsp", "ss", "fs_base", "gs_base", "ds", "es", "fs", "gs"},
+	elf.EM_AARCH64: {"x0", "x1", "x2", "x3", "x4", "x5", "x6", "x7", "x8", "x9", "x10", "x11", "x12", "x13", "x14",
+		"x15", "x16", "x17", "x18", "x19", "x20", "x21", "x22", "x23", "x24", "x25", "x26", "x27", "x28", "x29", "x30",
+		"sp", "pc", "pstate"},
+}
+
+// backtrace is extracted from a core file and uploaded next to it, as JSON and as text
+type backtrace struct {
+	Signal       int               `json:"signal"`
+	SignalName   string            `json:"signalName"`
+	Architecture string            `json:"architecture"`
+	Threads      []threadBacktrace `json:"threads"`
+	Mappings     []coreMapping     `json:"mappings"`
+}
+
+type threadBacktrace struct {
+	Pid       int               `json:"pid"`
+	Registers map[string]string `json:"registers"`
+	Frames    []stackFrame      `json:"frames"`
+}
+
+// stackFrame is a return address of the stack. Method is how it was found: pc and lr are read from
+// the registers, fp by walking the frame pointers and scan by scanning the stack for code addresses
+type stackFrame struct {
+	Index    int    `json:"index"`
+	Pc       string `json:"pc"`
+	Method   string `json:"method"`
+	Module   string `json:"module,omitempty"`
+	Offset   string `json:"offset,omitempty"`
+	Function string `json:"function,omitempty"`
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+}
+
+// coreMapping is a file mapped in the crashed process, from the NT_FILE note
+type coreMapping struct {
+	Start      string `json:"start"`
+	End        string `json:"end"`
+	FileOffset string `json:"fileOffset"`
+	Path       string `json:"path"`
+
+	start, end, offset uint64
+}
+
+// coreFile reads the memory of the crashed process from the PT_LOAD segments
+type coreFile struct {
+	file     *elf.File
+	mappings []coreMapping
+	// Mapped files by path, opened once for the whole stack scan. Nil when they cannot be opened
+	mapped map[string]*os.File
+}
+
+// Parses the core file, unwinds the stack of every thread and symbolizes the frames against the
+// binaries under the roots. Returns errNotCore for other files
+func extractBacktrace(path string, roots []string) (*backtrace, error) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return nil, errNotCore
+	}
+	defer f.Close()
+	if f.Type != elf.ET_CORE {
+		return nil, errNotCore
+	}
+	names, ok := registerNames[f.Machine]
+	if !ok || f.Class != elf.ELFCLASS64 {
+		return nil, fmt.Errorf("unsupported core architecture %s", f.Machine)
+	}
+
+	core := &coreFile{file: f, mapped: make(map[string]*os.File)}
+	defer core.close()
+	result := &backtrace{Architecture: architectureName(f.Machine)}
+	var threadRegisters [][]uint64
+	for _, prog := range f.Progs {
+		if prog.Type != elf.PT_NOTE {
+			continue
+		}
+		data := make([]byte, prog.Filesz)
+		if _, err := prog.ReadAt(data, 0); err != nil {
+			return nil, err
+		}
+		for _, note := range parseNotes(data, f.ByteOrder) {
+			switch {
+			case note.kind == ntPrstatus && len(note.desc) >= prstatusRegsOffset+8*len(names):
+				if len(result.Threads) == 0 {
+					result.Signal = int(f.ByteOrder.Uint16(note.desc[prstatusSignalOffset:]))
+					result.SignalName = syscall.Signal(result.Signal).String()
+				}
+				registers := make([]uint64, len(names))
+				for i := range registers {
+					registers[i] = f.ByteOrder.Uint64(note.desc[prstatusRegsOffset+8*i:])
+				}
+				thread := threadBacktrace{
+					Pid:       int(int32(f.ByteOrder.Uint32(note.desc[prstatusPidOffset:]))),
+					Registers: make(map[string]string),
+				}
+				for i, name := range names {
+					thread.Registers[name] = fmt.Sprintf("0x%x", registers[i])
+				}
+				result.Threads = append(result.Threads, thread)
+				threadRegisters = append(threadRegisters, registers)
+			case note.kind == ntFile:
+				core.mappings = parseFileNote(note.desc, f.ByteOrder)
+			}
+		}
+	}
+	if len(result.Threads) == 0 {
+		return nil, errors.New("no NT_PRSTATUS note in the core file")
+	}
+	result.Mappings = core.mappings
+	// The mappings are read first, the stack scan reads the code of the mapped files
+	for t, registers := range threadRegisters {
+		result.Threads[t].Frames = core.unwind(f.Machine, registers)
+	}
+
+	symbols := newSymbolizer(roots)
+	defer symbols.close()
+	for t := range result.Threads {
+		for i := range result.Threads[t].Frames {
+			symbols.symbolize(&result.Threads[t].Frames[i], core.mappings)
+		}
+	}
+	return result, nil
+}
+
+type elfNote struct {
+	kind uint32
+	desc []byte
+}
+
+// Splits a PT_NOTE segment, names and descriptors are padded to 4 bytes
+func parseNotes(data []byte, order binary.ByteOrder) []elfNote {
+	var notes []elfNote
+	for len(data) >= 12 {
+		nameSize, descSize, kind := order.Uint32(data), order.Uint32(data[4:]), order.Uint32(data[8:])
+		descStart := 12 + align4(uint64(nameSize))
+		descEnd := descStart + uint64(descSize)
+		if descEnd > uint64(len(data)) {
+			break
+		}
+		notes = append(notes, elfNote{kind: kind, desc: data[descStart:descEnd]})
+		next := descStart + align4(uint64(descSize))
+		if next > uint64(len(data)) {
+			break
+		}
+		data = data[next:]
+	}
+	return notes
+}
+
+func align4(n uint64) uint64 {
+	return (n + 3) &^ 3
+}
+
+// Parses NT_FILE: count, page size, count (start, end, offset in pages) and count paths
+func parseFileNote(desc []byte, order binary.ByteOrder) []coreMapping {
+	if len(desc) < 16 {
+		return nil
+	}
+	count, pageSize := order.Uint64(desc), order.Uint64(desc[8:])
+	// Checks the division first so that 16+24*count cannot overflow
+	if count > uint64(len(desc))/24 || 16+24*count > uint64(len(desc)) {
+		return nil
+	}
+	paths := bytes.Split(desc[16+24*count:], []byte{0})
+	var mappings []coreMapping
+	for i := uint64(0); i < count && i < uint64(len(paths)); i++ {
+		entry := desc[16+24*i:]
+		m := coreMapping{
+			start:  order.Uint64(entry),
+			end:    order.Uint64(entry[8:]),
+			offset: order.Uint64(entry[16:]) * pageSize,
+			Path:   string(paths[i]),
+		}
+		m.Start, m.End, m.FileOffset = fmt.Sprintf("0x%x", m.start), fmt.Sprintf("0x%x", m.end), fmt.Sprintf("0x%x", m.offset)
+		mappings = append(mappings, m)
+	}
+	return mappings
+}
+
+// Reads a word of the process memory
+func (c *coreFile) word(address uint64) (uint64, bool) {
+	buffer, ok := c.read(address, 8)
+	if !ok {
+		return 0, false
+	}
+	return c.file.ByteOrder.Uint64(buffer), true
+}
+
+// Reads the process memory dumped in the core file. The code of mapped files is usually not dumped,
+// it is read from the files themselves
+func (c *coreFile) read(address uint64, size uint64) ([]byte, bool) {
+	buffer := make([]byte, size)
+	for _, prog := range c.file.Progs {
+		if prog.Type == elf.PT_LOAD && address >= prog.Vaddr && address+size <= prog.Vaddr+prog.Filesz {
+			_, err := prog.ReadAt(buffer, int64(address-prog.Vaddr))
+			return buffer, err == nil
+		}
+	}
+	for _, mapping := range c.mappings {
+		if address >= mapping.start && address+size <= mapping.end {
+			f := c.open(mapping.Path)
+			if f == nil {
+				return nil, false
+			}
+			_, err := f.ReadAt(buffer, int64(address-mapping.start+mapping.offset))
+			return buffer, err == nil
+		}
+	}
+	return nil, false
+}
+
+// Returns the mapped file, opened on the first read
+func (c *coreFile) open(path string) *os.File {
+	if f, ok := c.mapped[path]; ok {
+		return f
+	}
+	// Nil on error, so that the file is not opened again
+	f, _ := os.Open(path)
+	c.mapped[path] = f
+	return f
+}
+
+func (c *coreFile) close() {
+	for _, f := range c.mapped {
+		if f != nil {
+			f.Close()
+		}
+	}
+}
+
+// Returns whether the instruction before the address is a call, so that it is a return address
+func (c *coreFile) afterCall(machine elf.Machine, address uint64) bool {
+	switch machine {
+	case elf.EM_X86_64:
+		code, ok := c.read(address-7, 7)
+		if !ok {
+			return false
+		}
+		// call rel32, call r/m64 with its 2, 3, 6 and 7 bytes encodings
+		return code[2] == 0xe8 ||
+			code[5] == 0xff && code[6]&0x38 == 0x10 ||
+			code[4] == 0xff && code[5]&0x38 == 0x10 ||
+			code[1] == 0xff && code[2]&0x38 == 0x10 ||
+			code[0] == 0xff && code[1]&0x38 == 0x10
+	case elf.EM_AARCH64:
+		code, ok := c.read(address-4, 4)
+		if !ok {
+			return false
+		}
+		instruction := c.file.ByteOrder.Uint32(code)
+		// bl and blr
+		return instruction&0xfc000000 == 0x94000000 || instruction&0xfffffc1f == 0xd63f0000
+	}
+	return false
+}
+
+// Returns whether the address is in an executable segment
+func (c *coreFile) executable(address uint64) bool {
+	for _, prog := range c.file.Progs {
+		if prog.Type == elf.PT_LOAD && prog.Flags&elf.PF_X != 0 && address >= prog.Vaddr && address < prog.Vaddr+prog.Memsz {
+			return true
+		}
+	}
+	return false
+}
+
+// Best effort unwind: follows the frame pointers, and falls back to scanning the stack for return
+// addresses when the code was built without them
+func (c *coreFile) unwind(machine elf.Machine, registers []uint64) []stackFrame {
+	var pc, sp, fp, lr uint64
+	switch machine {
+	case elf.EM_X86_64:
+		pc, sp, fp = registers[16], registers[19], registers[4]
+	case elf.EM_AARCH64:
+		pc, sp, fp, lr = registers[32], registers[31], registers[29], registers[30]
+	}
+
+	frames := []stackFrame{{Pc: fmt.Sprintf("0x%x", pc), Method: "pc"}}
+	last := pc
+	add := func(address uint64, method string) {
+		frames = append(frames, stackFrame{Index: len(frames), Pc: fmt.Sprintf("0x%x", address), Method: method})
+		last = address
+	}
+	if lr != 0 && lr != pc && c.executable(lr) {
+		// The return address of leaf functions is only in the link register
+		add(lr, "lr")
+	}
+
+	for fp != 0 && len(frames) < maxFrames {
+		next, ok := c.word(fp)
+		if !ok {
+			break
+		}
+		ret, ok := c.word(fp + 8)
+		if !ok || ret == 0 || !c.executable(ret) {
+			break
+		}
+		if !(len(frames) == 2 && frames[1].Method == "lr" && ret == last) {
+			add(ret, "fp")
+		}
+		if next <= fp {
+			break
+		}
+		fp = next
+	}
+
+	if len(frames) <= 2 {
+		for offset := uint64(0); offset < stackScanBytes && len(frames) < maxFrames; offset += 8 {
+			value, ok := c.word(sp + offset)
+			if !ok {
+				break
+			}
+			if value != last && c.executable(value) && c.afterCall(machine, value) {
+				add(value, "scan")
+			}
+		}
+	}
+	return frames
+}
+
+// symbolizer resolves addresses to the functions and lines of the binaries under the roots
+type symbolizer struct {
+	roots   []string
+	modules map[string]*symbolModule
+}
+
+type symbolModule struct {
+	file    *elf.File
+	symbols []elf.Symbol
+	dwarf   *dwarf.Data
+}
+
+func newSymbolizer(roots []string) *symbolizer {
+	return &symbolizer{roots: roots, modules: make(map[string]*symbolModule)}
+}
+
+func (s *symbolizer) close() {
+	for _, module := range s.modules {
+		if module != nil {
+			module.file.Close()
+		}
+	}
+}
+
+// Fills the module, offset, function and line of the frame. Return addresses are looked up one byte
+// before, inside the call instruction
+func (s *symbolizer) symbolize(frame *stackFrame, mappings []coreMapping) {
+	var pc uint64
+	fmt.Sscanf(frame.Pc, "0x%x", &pc)
+	lookup := pc
+	if frame.Method != "pc" && lookup > 0 {
+		lookup--
+	}
+
+	var mapping *coreMapping
+	for i := range mappings {
+		if lookup >= mappings[i].start && lookup < mappings[i].end {
+			mapping = &mappings[i]
+			break
+		}
+	}
+	if mapping == nil {
+		return
+	}
+	fileOffset := lookup - mapping.start + mapping.offset
+	frame.Module = mapping.Path
+	frame.Offset = fmt.Sprintf("0x%x", fileOffset+pc-lookup)
+
+	module := s.module(mapping.Path)
+	if module == nil {
+		return
+	}
+	var address uint64
+	found := false
+	for _, prog := range module.file.Progs {
+		if prog.Type == elf.PT_LOAD && fileOffset >= prog.Off && fileOffset < prog.Off+prog.Filesz {
+			address, found = prog.Vaddr+fileOffset-prog.Off, true
+			break
+		}
+	}
+	if !found {
+		return
+	}
+
+	idx := sort.Search(len(module.symbols), func(i int) bool { return module.symbols[i].Value > address }) - 1
+	if idx >= 0 {
+		symbol := module.symbols[idx]
+		if symbol.Size == 0 || address < symbol.Value+symbol.Size {
+			frame.Function = fmt.Sprintf("%s+0x%x", symbol.Name, address+pc-lookup-symbol.Value)
+		}
+	}
+	if module.dwarf != nil {
+		frame.File, frame.Line = lineFor(module.dwarf, address)
+	}
+}
+
+// Opens the binary once, only under the roots
+func (s *symbolizer) module(path string) *symbolModule {
+	if module, ok := s.modules[path]; ok {
+		return module
+	}
+	s.modules[path] = nil
+	allowed := false
+	for _, root := range s.roots {
+		if relative, err := filepath.Rel(root, path); err == nil && !strings.HasPrefix(relative, "..") {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return nil
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+	f, err := elf.Open(path)
+	if err != nil {
+		return nil
+	}
+
+	module := &symbolModule{file: f}
+	symbols, _ := f.Symbols()
+	dynamic, _ := f.DynamicSymbols()
+	for _, symbol := range append(symbols, dynamic...) {
+		if elf.ST_TYPE(symbol.Info) == elf.STT_FUNC && symbol.Value != 0 {
+			module.symbols = append(module.symbols, symbol)
+		}
+	}
+	sort.Slice(module.symbols, func(i, j int) bool { return module.symbols[i].Value < module.symbols[j].Value })
+	module.dwarf, _ = f.DWARF()
+	s.modules[path] = module
+	return module
+}
+
+// Returns the source file and line of the address from the DWARF line tables
+func lineFor(data *dwarf.Data, address uint64) (string, int) {
+	reader := data.Reader()
+	for {
+		entry, err := reader.Next()
+		if err != nil || entry == nil {
+			return "", 0
+		}
+		if entry.Tag != dwarf.TagCompileUnit {
+			reader.SkipChildren()
+			continue
+		}
+		ranges, _ := data.Ranges(entry)
+		for _, r := range ranges {
+			if address < r[0] || address >= r[1] {
+				continue
+			}
+			lines, err := data.LineReader(entry)
+			if err != nil || lines == nil {
+				return "", 0
+			}
+			var line dwarf.LineEntry
+			if lines.SeekPC(address, &line) != nil {
+				return "", 0
+			}
+			return line.File.Name, line.Line
+		}
+		reader.SkipChildren()
+	}
+}
+
+func architectureName(machine elf.Machine) string {
+	if machine == elf.EM_AARCH64 {
+		return "arm64"
+	}
+	return "x86_64"
+}
+
+// Renders the backtrace like a debugger
+func (b *backtrace) text() string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "Signal %d (%s), %d threads, %s\n", b.Signal, b.SignalName, len(b.Threads), b.Architecture)
+	for t, thread := range b.Threads {
+		fmt.Fprintf(&out, "\nThread %d (pid %d)\n", t+1, thread.Pid)
+		for _, frame := range thread.Frames {
+			fmt.Fprintf(&out, "  #%-2d %18s", frame.Index, frame.Pc)
+			if frame.Function != "" {
+				fmt.Fprintf(&out, " in %s", frame.Function)
+			}
+			if frame.File != "" {
+				fmt.Fprintf(&out, " at %s:%d", frame.File, frame.Line)
+			}
+			if frame.Module != "" {
+				fmt.Fprintf(&out, " (%s+%s)", frame.Module, frame.Offset)
+			}
+			if frame.Method == "scan" {
+				out.WriteString(" [scanned]")
+			}
+			out.WriteString("\n")
+		}
+	}
+	return out.String()
+}
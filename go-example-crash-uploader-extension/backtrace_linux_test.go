@@ -0,0 +1,169 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// Allows core files and crashes with SIGABRT. Built with go build, since the binaries of go test
+// have no symbol table
+const crasherSource = `package main
+
+import (
+	"runtime/debug"
+	"syscall"
+)
+
+func main() {
+	var limit syscall.Rlimit
+	syscall.Getrlimit(syscall.RLIMIT_CORE, &limit)
+	limit.Cur = limit.Max
+	syscall.Setrlimit(syscall.RLIMIT_CORE, &limit)
+	debug.SetTraceback("crash")
+	crash()
+}
+
+//go:noinline
+func crash() {
+	panic("deliberate crash")
+}
+`
+
+// Builds the crasher in a temporary directory and returns the path of the binary and of its core file
+func crashHelperBinary(t *testing.T) (string, string) {
+	pattern, err := ioutil.ReadFile("/proc/sys/kernel/core_pattern")
+	if err != nil || !strings.HasPrefix(string(pattern), "core") {
+		t.Skipf("core files are not written to the working directory, core_pattern: %q", pattern)
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("the go tool is needed to build the crasher")
+	}
+
+	directory := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(directory, "main.go"), []byte(crasherSource), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(directory, "go.mod"), []byte("module crasher\n\ngo 1.14\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	build := exec.Command(goTool, "build", "-o", "crasher", ".")
+	build.Dir = directory
+	build.Env = append(os.Environ(), "GOFLAGS=", "CGO_ENABLED=0")
+	if output, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("cannot build the crasher: %v\n%s", err, output)
+	}
+
+	binary := filepath.Join(directory, "crasher")
+	crasher := exec.Command(binary)
+	crasher.Dir = directory
+	if err := crasher.Run(); err == nil {
+		t.Fatal("the crasher did not crash")
+	}
+	cores, _ := filepath.Glob(filepath.Join(directory, "core*"))
+	if len(cores) != 1 {
+		t.Skip("the crasher did not dump a core file, the hard core size limit may be 0")
+	}
+	return binary, cores[0]
+}
+
+func TestBacktraceOfCrashedBinary(t *testing.T) {
+	binary, core := crashHelperBinary(t)
+
+	trace, err := extractBacktrace(core, []string{filepath.Dir(binary)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trace.Signal != int(syscall.SIGABRT) || trace.SignalName != syscall.SIGABRT.String() {
+		t.Fatalf("signal %d (%s), expected SIGABRT", trace.Signal, trace.SignalName)
+	}
+	if len(trace.Threads) == 0 || len(trace.Threads[0].Frames) < 2 {
+		t.Fatalf("expected the frames of the crashed thread, got %+v", trace.Threads)
+	}
+	mapped := false
+	for _, mapping := range trace.Mappings {
+		mapped = mapped || mapping.Path == binary
+	}
+	if !mapped {
+		t.Fatalf("the crasher %s is not in the mappings", binary)
+	}
+
+	// The crashed thread raises the signal from the Go runtime, the frame pointers lead back to the
+	// panicking function
+	var runtimeFrame, crashFrame *stackFrame
+	for i, frame := range trace.Threads[0].Frames {
+		if frame.Module != binary {
+			continue
+		}
+		if runtimeFrame == nil && strings.HasPrefix(frame.Function, "runtime.") {
+			runtimeFrame = &trace.Threads[0].Frames[i]
+		}
+		if crashFrame == nil && strings.HasPrefix(frame.Function, "main.crash+") {
+			crashFrame = &trace.Threads[0].Frames[i]
+		}
+	}
+	if runtimeFrame == nil || crashFrame == nil {
+		t.Fatalf("the crashed thread is not symbolized in the runtime and main.crash:\n%s", trace.text())
+	}
+	if filepath.Base(crashFrame.File) != "main.go" || crashFrame.Line != 19 {
+		t.Fatalf("main.crash is at %s:%d, expected the line of the panic in main.go", crashFrame.File, crashFrame.Line)
+	}
+	if !strings.HasPrefix(trace.text(), "Signal 6 (aborted)") {
+		t.Fatalf("unexpected text backtrace:\n%s", trace.text())
+	}
+}
+
+func TestBacktraceOfOtherFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dump.upload.1")
+	if err := ioutil.WriteFile(path, []byte("not a core file"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := extractBacktrace(path, nil); err != errNotCore {
+		t.Fatalf("extracted a backtrace from a text file: %v", err)
+	}
+	if executable, err := os.Executable(); err == nil {
+		if _, err := extractBacktrace(executable, nil); err != errNotCore {
+			t.Fatalf("extracted a backtrace from an executable: %v", err)
+		}
+	}
+}
+
+func TestParseFileNote(t *testing.T) {
+	order := binary.LittleEndian
+	desc := make([]byte, 16+24+len("/var/task/bootstrap\x00"))
+	order.PutUint64(desc, 1)
+	order.PutUint64(desc[8:], 4096)
+	order.PutUint64(desc[16:], 0x400000)
+	order.PutUint64(desc[24:], 0x401000)
+	order.PutUint64(desc[32:], 2)
+	copy(desc[40:], "/var/task/bootstrap\x00")
+
+	mappings := parseFileNote(desc, order)
+	if len(mappings) != 1 || mappings[0].Path != "/var/task/bootstrap" || mappings[0].start != 0x400000 ||
+		mappings[0].end != 0x401000 || mappings[0].offset != 2*4096 {
+		t.Fatalf("parsed %+v", mappings)
+	}
+
+	// The entries of the count do not fit after the header
+	for _, size := range []int{16, 30, 39} {
+		if mappings := parseFileNote(desc[:size], order); mappings != nil {
+			t.Fatalf("parsed %+v from a note truncated to %d bytes", mappings, size)
+		}
+	}
+	order.PutUint64(desc, 1<<62)
+	if mappings := parseFileNote(desc, order); mappings != nil {
+		t.Fatalf("parsed %+v from a note with an overflowing count", mappings)
+	}
+}
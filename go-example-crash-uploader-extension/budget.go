@@ -0,0 +1,142 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package main
+
+import (
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Reasons a crash file was not uploaded
+const (
+	duplicateReason = "duplicate"
+	budgetReason    = "budget"
+
+	// Suppressed crashes listed in the summary, the others are only counted
+	maxSuppressedListed = 100
+)
+
+// suppressedCrash is a crash file deleted without being uploaded
+type suppressedCrash struct {
+	Path        string    `json:"path"`
+	Size        int64     `json:"size"`
+	Sha256      string    `json:"sha256"`
+	Reason      string    `json:"reason"`
+	DuplicateOf string    `json:"duplicateOf,omitempty"`
+	RequestID   string    `json:"requestId,omitempty"`
+	CrashedAt   time.Time `json:"crashedAt"`
+}
+
+// suppressionSummary is uploaded on shutdown when crash files were suppressed
+type suppressionSummary struct {
+	SchemaVersion   string            `json:"schemaVersion"`
+	FunctionName    string            `json:"functionName"`
+	FunctionVersion string            `json:"functionVersion"`
+	LogStream       string            `json:"logStream"`
+	Uploads         int               `json:"uploads"`
+	UploadedBytes   int64             `json:"uploadedBytes"`
+	MaxUploads      int               `json:"maxUploads"`
+	MaxUploadBytes  int64             `json:"maxUploadBytes"`
+	SuppressedCount int               `json:"suppressedCount"`
+	SuppressedBytes int64             `json:"suppressedBytes"`
+	Suppressed      []suppressedCrash `json:"suppressed"`
+}
+
+// crashBudget deduplicates crash files by content and bounds the uploads of the execution
+// environment, so that a crash looping function does not flood the bucket
+type crashBudget struct {
+	maxUploads int
+	maxBytes   int64
+
+	uploads       int
+	uploadedBytes int64
+	// Uploads in progress count against the budget, by SHA-256
+	reserved      map[string]int64
+	reservedBytes int64
+	// Keys of the uploaded files by SHA-256
+	seen       map[string]string
+	suppressed []suppressedCrash
+	count      int
+	bytes      int64
+}
+
+func newCrashBudget(maxUploads int, maxBytes int64) *crashBudget {
+	return &crashBudget{maxUploads: maxUploads, maxBytes: maxBytes, reserved: make(map[string]int64), seen: make(map[string]string)}
+}
+
+// Returns the reason the file must be suppressed, and the key of the file it duplicates, or an
+// empty reason when it can be uploaded
+func (b *crashBudget) check(checksum string, size int64) (string, string) {
+	if key, ok := b.seen[checksum]; ok {
+		return duplicateReason, key
+	}
+	if b.uploads+len(b.reserved) >= b.maxUploads || b.uploadedBytes+b.reservedBytes+size > b.maxBytes {
+		return budgetReason, ""
+	}
+	return "", ""
+}
+
+// Tells if a file with the same content is being uploaded
+func (b *crashBudget) uploading(checksum string) bool {
+	_, ok := b.reserved[checksum]
+	return ok
+}
+
+// Counts an upload in progress against the budget until it is released
+func (b *crashBudget) reserve(checksum string, size int64) {
+	b.reserved[checksum] = size
+	b.reservedBytes += size
+}
+
+func (b *crashBudget) release(checksum string) {
+	b.reservedBytes -= b.reserved[checksum]
+	delete(b.reserved, checksum)
+}
+
+func (b *crashBudget) uploaded(checksum string, size int64, key string) {
+	b.uploads++
+	b.uploadedBytes += size
+	b.seen[checksum] = key
+}
+
+func (b *crashBudget) suppress(crash suppressedCrash) {
+	b.count++
+	b.bytes += crash.Size
+	if len(b.suppressed) < maxSuppressedListed {
+		b.suppressed = append(b.suppressed, crash)
+	}
+}
+
+// Returns a copy of the summary of the suppressed files, or nil when none was
+func (b *crashBudget) summary(functionName string, functionVersion string) *suppressionSummary {
+	if b.count == 0 {
+		return nil
+	}
+	return &suppressionSummary{
+		SchemaVersion:   manifestSchemaVersion,
+		FunctionName:    functionName,
+		FunctionVersion: functionVersion,
+		LogStream:       os.Getenv("AWS_LAMBDA_LOG_STREAM_NAME"),
+		Uploads:         b.uploads,
+		UploadedBytes:   b.uploadedBytes,
+		MaxUploads:      b.maxUploads,
+		MaxUploadBytes:  b.maxBytes,
+		SuppressedCount: b.count,
+		SuppressedBytes: b.bytes,
+		Suppressed:      append([]suppressedCrash(nil), b.suppressed...),
+	}
+}
+
+// Returns the key of the summary, "<prefix>/<function>/<version>/suppressed/<log stream>.json". The
+// log stream identifies the execution environment
+func summaryKey(functionName string, functionVersion string) string {
+	environment := os.Getenv("AWS_LAMBDA_LOG_STREAM_NAME")
+	if environment == "" {
+		environment = "local"
+	}
+	environment = strings.NewReplacer("/", "-", "[", "", "]", "-").Replace(environment)
+	return path.Join(keyPrefix, functionName, functionVersion, "suppressed", environment+".json")
+}
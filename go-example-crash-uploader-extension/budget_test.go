@@ -0,0 +1,118 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDuplicateIsSuppressed(t *testing.T) {
+	directory, err := ioutil.TempDir("", "crash-uploader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+	file := filepath.Join(directory, "core.2")
+	if err := ioutil.WriteFile(file, []byte("crash"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	checksum, size, err := hashFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	invocations := newInvocationHistory(10)
+	invocations.add(invocation{RequestID: "request-1", StartedAt: time.Now().Add(-time.Minute)})
+	budget := newCrashBudget(10, 1<<20)
+	budget.uploaded(checksum, size, "crashes/fn/1/core.1")
+	// Without the S3 client, the file fails the test if it is uploaded
+	u := newUploader("bucket", nil, "fn", "1", invocations, nil, budget, loadUploadState(filepath.Join(directory, ".upload-state")))
+
+	uploaded, err := u.uploadAndDelete(context.Background(), file)
+	if uploaded || err != nil {
+		t.Fatalf("duplicate uploaded %v, %v, expected it to be suppressed", uploaded, err)
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Fatal("suppressed duplicate was not deleted")
+	}
+	summary := budget.summary("fn", "1")
+	if summary == nil || summary.SuppressedCount != 1 || len(summary.Suppressed) != 1 {
+		t.Fatalf("summary %+v, expected the suppressed duplicate", summary)
+	}
+	crash := summary.Suppressed[0]
+	if crash.Reason != duplicateReason || crash.DuplicateOf != "crashes/fn/1/core.1" || crash.Sha256 != checksum || crash.Size != size || crash.RequestID != "request-1" {
+		t.Fatalf("suppressed %+v, expected a duplicate of crashes/fn/1/core.1 during request-1", crash)
+	}
+}
+
+func TestBudgetCountsReservations(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		maxUploads int
+		maxBytes   int64
+	}{
+		{"count", 2, 1000},
+		{"bytes", 10, 250},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			budget := newCrashBudget(test.maxUploads, test.maxBytes)
+			budget.uploaded("uploaded", 100, "key")
+			budget.reserve("in-flight", 100)
+			if reason, _ := budget.check("new", 100); reason != budgetReason {
+				t.Fatalf("check returned %q with an upload in flight, expected the budget to be exhausted", reason)
+			}
+
+			// The failed upload frees its share of the budget
+			budget.release("in-flight")
+			if reason, _ := budget.check("new", 100); reason != "" {
+				t.Fatalf("check returned %q once the upload is released, expected the file to fit", reason)
+			}
+			if budget.uploading("in-flight") {
+				t.Fatal("released upload is still in flight")
+			}
+		})
+	}
+}
+
+func TestDuplicateBeforeBudget(t *testing.T) {
+	budget := newCrashBudget(1, 100)
+	budget.uploaded("abc", 100, "key")
+	if reason, key := budget.check("abc", 100); reason != duplicateReason || key != "key" {
+		t.Fatalf("check returned %q, %q, expected a duplicate of key", reason, key)
+	}
+	if reason, key := budget.check("def", 1); reason != budgetReason || key != "" {
+		t.Fatalf("check returned %q, %q, expected the budget to be exhausted", reason, key)
+	}
+}
+
+func TestSummaryIsCapped(t *testing.T) {
+	budget := newCrashBudget(1, 100)
+	if summary := budget.summary("fn", "1"); summary != nil {
+		t.Fatalf("summary %+v without suppressed files, expected none", summary)
+	}
+
+	suppressed := maxSuppressedListed + 5
+	for i := 0; i < suppressed; i++ {
+		budget.suppress(suppressedCrash{Path: fmt.Sprintf("/tmp/core.%d", i), Size: 10, Reason: budgetReason})
+	}
+	summary := budget.summary("fn", "1")
+	if summary.SuppressedCount != suppressed || summary.SuppressedBytes != int64(suppressed*10) {
+		t.Fatalf("summary counts %d files and %d bytes, expected %d and %d", summary.SuppressedCount, summary.SuppressedBytes, suppressed, suppressed*10)
+	}
+	if len(summary.Suppressed) != maxSuppressedListed || summary.Suppressed[0].Path != "/tmp/core.0" {
+		t.Fatalf("summary lists %d files, expected the first %d", len(summary.Suppressed), maxSuppressedListed)
+	}
+
+	// The summary is a copy, uploading it does not race with later suppressions
+	summary.Suppressed[0].Path = "changed"
+	if budget.suppressed[0].Path != "/tmp/core.0" {
+		t.Fatal("summary shares the suppressed files of the budget")
+	}
+}
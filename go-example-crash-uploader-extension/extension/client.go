@@ -108,6 +108,11 @@ func (e *Client) Register(ctx context.Context, filename string) (*RegisterRespon
 	return &res, nil
 }
 
+// ExtensionID returns the identifier received on registration, ex: to subscribe to the Logs API
+func (e *Client) ExtensionID() string {
+	return e.extensionID
+}
+
 // NextEvent blocks while long polling for the next lambda invoke or shutdown
 func (e *Client) NextEvent(ctx context.Context) (*NextEventResponse, error) {
 	const action = "/event/next"
@@ -10,34 +10,44 @@ import (
 	"strings"
 )
 
-func renameFilesWithSubstring(rootDirectory string, substring string, newName string) (int, error) {
-	files, err := getFilesWithSubstring(rootDirectory, substring)
+// Renames the regular files whose name starts with the prefix to the name returned for each of
+// them. A "(n)" suffix is added when the name is already taken
+func renameFilesWithPrefix(rootDirectory string, prefix string, newName func(file string, info os.FileInfo) string) (int, error) {
+	files, err := getFilesWithPrefix(rootDirectory, prefix)
 	if err != nil {
 		return 0, err
 	}
 
 	for idx, file := range files {
-
-		if idx == 0 {
-			err = os.Rename(file, fmt.Sprintf("%s/%s", filepath.Dir(file), newName))
-			if err != nil {
-				return idx, err
-			}
-		} else {
-			err = os.Rename(file, fmt.Sprintf("%s/%s(%d)", filepath.Dir(file), newName, idx))
-			if err != nil {
-				return idx, err
+		info, err := os.Stat(file)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		name := newName(file, info)
+		target := fmt.Sprintf("%s/%s", filepath.Dir(file), name)
+		for n := 1; ; n++ {
+			if _, err := os.Stat(target); os.IsNotExist(err) {
+				break
 			}
+			target = fmt.Sprintf("%s/%s(%d)", filepath.Dir(file), name, n)
+		}
+		err = os.Rename(file, target)
+		if err != nil {
+			return idx, err
 		}
 	}
 	return len(files), nil
 }
 
-func getFilesWithSubstring(rootDirectory string, substring string) ([]string, error) {
+// Lists the regular files whose name starts with the prefix. Only the name is matched, so that
+// files under a directory named after the prefix, ex: /tmp/cores/app.log, are left alone
+func getFilesWithPrefix(rootDirectory string, prefix string) ([]string, error) {
 	var files []string
 	err := filepath.Walk(rootDirectory, func(path string, info os.FileInfo, err error) error {
-		substringFound := strings.Contains(path, substring)
-		if substringFound {
+		if err != nil || !info.Mode().IsRegular() {
+			return nil
+		}
+		if strings.HasPrefix(filepath.Base(path), prefix) {
 			files = append(files, path)
 		}
 		return nil
@@ -0,0 +1,51 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestRenameFilesWithPrefix(t *testing.T) {
+	directory, err := ioutil.TempDir("", "crash-uploader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+	for _, name := range []string{"core.123", "app.core", "cores/app.log", "cores/core", "sub/core.456", "dump.upload.1"} {
+		file := filepath.Join(directory, name)
+		os.MkdirAll(filepath.Dir(file), 0755)
+		if err := ioutil.WriteFile(file, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A directory named like a core file is not renamed
+	os.Mkdir(filepath.Join(directory, "core.dir"), 0755)
+
+	renamed, err := renameFilesWithPrefix(directory, "core", func(file string, info os.FileInfo) string {
+		return "dump.upload.1"
+	})
+	if err != nil || renamed != 3 {
+		t.Fatalf("renamed %d files, %v, expected the 3 core files", renamed, err)
+	}
+
+	var files []string
+	filepath.Walk(directory, func(path string, info os.FileInfo, err error) error {
+		if err == nil && path != directory {
+			relative, _ := filepath.Rel(directory, path)
+			files = append(files, filepath.ToSlash(relative))
+		}
+		return nil
+	})
+	sort.Strings(files)
+	expected := []string{"app.core", "core.dir", "cores", "cores/app.log", "cores/dump.upload.1", "dump.upload.1", "dump.upload.1(1)", "sub", "sub/dump.upload.1"}
+	if !reflect.DeepEqual(files, expected) {
+		t.Fatalf("files after the rename %v, expected %v", files, expected)
+	}
+}
@@ -1,5 +1,8 @@
 module aws-lambda-extensions/go-example-crash-uploader-extension
 
-require github.com/aws/aws-sdk-go v1.34.31
+require (
+	github.com/aws/aws-sdk-go v1.34.31
+	github.com/klauspost/compress v1.11.13
+)
 
 go 1.14
@@ -0,0 +1,119 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package logsapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const (
+	extensionIdentiferHeader = "Lambda-Extension-Identifier"
+	schemaVersion            = "2021-03-18"
+)
+
+// LogBuffer keeps the last lines logged by the function, received from the Logs API
+type LogBuffer struct {
+	lock  sync.Mutex
+	size  int
+	lines []string
+}
+
+// NewLogBuffer returns a buffer keeping the last size lines
+func NewLogBuffer(size int) *LogBuffer {
+	return &LogBuffer{size: size}
+}
+
+// Lines returns a copy of the buffered lines, oldest first
+func (b *LogBuffer) Lines() []string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return append([]string(nil), b.lines...)
+}
+
+func (b *LogBuffer) add(line string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.lines = append(b.lines, line)
+	if len(b.lines) > b.size {
+		b.lines = b.lines[len(b.lines)-b.size:]
+	}
+}
+
+// logEvent is an item of the batches posted by the Logs API
+type logEvent struct {
+	Time   string          `json:"time"`
+	Type   string          `json:"type"`
+	Record json.RawMessage `json:"record"`
+}
+
+// ServeHTTP receives the batches posted by the Logs API. Nothing is printed here, printed lines
+// would be sent back as extension logs
+func (b *LogBuffer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var events []logEvent
+	if err := json.Unmarshal(body, &events); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	for _, event := range events {
+		if event.Type != "function" {
+			continue
+		}
+		// Records are strings, or JSON objects with the JSON log format
+		var line string
+		if json.Unmarshal(event.Record, &line) != nil {
+			line = string(event.Record)
+		}
+		b.add(event.Time + " " + strings.TrimRight(line, "\n"))
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Subscribe starts listening on the port and subscribes to the function logs
+func (b *LogBuffer) Subscribe(runtimeAPI string, extensionID string, port int) error {
+	address := fmt.Sprintf("sandbox.localdomain:%d", port)
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	go http.Serve(listener, b)
+
+	body, err := json.Marshal(map[string]interface{}{
+		"schemaVersion": schemaVersion,
+		"types":         []string{"function"},
+		"buffering":     map[string]int{"maxItems": 1000, "maxBytes": 262144, "timeoutMs": 100},
+		"destination":   map[string]string{"protocol": "HTTP", "URI": "http://" + address, "method": "POST", "encoding": "JSON"},
+	})
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("http://%s/2020-08-15/logs", runtimeAPI)
+	req, err := http.NewRequest("PUT", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(extensionIdentiferHeader, extensionID)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("request failed with status %s %s", res.Status, string(message))
+	}
+	return nil
+}
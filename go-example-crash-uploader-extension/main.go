@@ -11,19 +11,47 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"syscall"
-
-	"github.com/aws/aws-sdk-go/aws/credentials"
+	"time"
 
 	"aws-lambda-extensions/go-example-crash-uploader-extension/extension"
+	"aws-lambda-extensions/go-example-crash-uploader-extension/logsapi"
 )
 
 var (
-	extensionName        = filepath.Base(os.Args[0]) // extension name has to match the filename
-	extensionClient      = extension.NewClient(os.Getenv("AWS_LAMBDA_RUNTIME_API"))
-	printPrefix          = fmt.Sprintf("[%s]", extensionName)
-	directoryToSearch    = "/tmp"
-	substringToSearchFor = "dump.upload"
+	extensionName   = filepath.Base(os.Args[0]) // extension name has to match the filename
+	extensionClient = extension.NewClient(os.Getenv("AWS_LAMBDA_RUNTIME_API"))
+	printPrefix     = fmt.Sprintf("[%s]", extensionName)
+	// Comma separated directories watched for crash files, with their subdirectories
+	directoriesToWatch = getListFromEnv("CRASH_DIRECTORIES", "/tmp")
+	// Comma separated glob patterns matched against the file names
+	patternsToUpload = getListFromEnv("CRASH_PATTERNS", "dump.upload*")
+	// zstd, gzip or none
+	compression = strings.ToLower(getListFromEnv("CRASH_COMPRESSION", zstdCompression)[0])
+	// Prefix of the S3 keys, crash files go to "<prefix>/<function>/<version>/<request ID>/"
+	keyPrefix = strings.Trim(getListFromEnv("CRASH_KEY_PREFIX", "crashes")[0], "/")
+	// Number of function log lines added to the manifests, 0 disables the Logs API subscription
+	logLinesToKeep = getListFromEnv("CRASH_LOG_LINES", "50")[0]
+	// Upload budget of the execution environment, crash files over it are only listed in a summary
+	maxUploads     = getListFromEnv("CRASH_MAX_UPLOADS", "5")[0]
+	maxUploadBytes = getListFromEnv("CRASH_MAX_UPLOAD_BYTES", "10737418240")[0]
+	invocations    = newInvocationHistory(20)
+	// Set to true to upload the backtraces of core files, symbolized against the binaries in
+	// the comma separated directories of CRASH_SYMBOL_PATHS
+	extractBacktraces = getListFromEnv("CRASH_BACKTRACE", "false")[0]
+	symbolPaths       = getListFromEnv("CRASH_SYMBOL_PATHS", "/var/task,/opt")
+	// Upload state of the crash files, kept until they are deleted
+	stateFile = getListFromEnv("CRASH_STATE_FILE", "/tmp/.crash-uploader-state.json")[0]
+)
+
+const (
+	// Time kept from the SHUTDOWN deadline to exit cleanly
+	shutdownMargin = 100 * time.Millisecond
+	// Port receiving the function logs from the Logs API
+	logsListenerPort = 4243
 )
 
 func main() {
@@ -35,7 +63,6 @@ func main() {
 		s := <-sigs
 		cancel()
 		println(printPrefix, "Received", s)
-		println(printPrefix, "Exiting")
 	}()
 
 	res, err := extensionClient.Register(ctx, extensionName)
@@ -44,59 +71,159 @@ func main() {
 	}
 	println(printPrefix, "Register response:", prettyPrint(res))
 
-	// Get the required credentials
-	creds := credentials.NewEnvCredentials()
-	credsValue, err := creds.Get()
-	if err != nil {
-		extensionClient.InitError(ctx, err.Error())
-	}
-
 	// Get the name of the S3 bucket
 	bucket, bucketFound := os.LookupEnv("BUCKET")
 	if !bucketFound {
 		extensionClient.InitError(ctx, errors.New("BUCKET_NOT_FOUND").Error())
+		panic("BUCKET is not set")
 	}
 
-	go searchForFilesAndUploadAndDelete(ctx, bucket, directoryToSearch, substringToSearchFor, credsValue)
+	// Credentials are read from the default chain on every request
+	svc, err := createS3Client()
+	if err != nil {
+		extensionClient.InitError(ctx, "S3_CLIENT_ERROR")
+		panic(err)
+	}
+
+	for _, pattern := range patternsToUpload {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			extensionClient.InitError(ctx, "CRASH_PATTERNS_INVALID")
+			panic(err)
+		}
+	}
+
+	if _, ok := compressionExtensions[compression]; !ok {
+		extensionClient.InitError(ctx, "CRASH_COMPRESSION_INVALID")
+		panic(fmt.Errorf("invalid CRASH_COMPRESSION %q, expected zstd, gzip or none", compression))
+	}
+
+	var logs *logsapi.LogBuffer
+	lines, err := strconv.Atoi(logLinesToKeep)
+	if err != nil || lines < 0 {
+		extensionClient.InitError(ctx, "CRASH_LOG_LINES_INVALID")
+		panic(fmt.Errorf("invalid CRASH_LOG_LINES %q, expected a number of lines", logLinesToKeep))
+	}
+	if lines > 0 {
+		logs = logsapi.NewLogBuffer(lines)
+		if err := logs.Subscribe(os.Getenv("AWS_LAMBDA_RUNTIME_API"), extensionClient.ExtensionID(), logsListenerPort); err != nil {
+			println(printPrefix, "Cannot subscribe to the Logs API, manifests will not contain logs:", err.Error())
+			logs = nil
+		}
+	}
+
+	uploadsLimit, err := strconv.Atoi(maxUploads)
+	if err != nil || uploadsLimit < 0 {
+		extensionClient.InitError(ctx, "CRASH_MAX_UPLOADS_INVALID")
+		panic(fmt.Errorf("invalid CRASH_MAX_UPLOADS %q, expected a number of files", maxUploads))
+	}
+	bytesLimit, err := strconv.ParseInt(maxUploadBytes, 10, 64)
+	if err != nil || bytesLimit < 0 {
+		extensionClient.InitError(ctx, "CRASH_MAX_UPLOAD_BYTES_INVALID")
+		panic(fmt.Errorf("invalid CRASH_MAX_UPLOAD_BYTES %q, expected a number of bytes", maxUploadBytes))
+	}
+
+	state := loadUploadState(stateFile)
+	u := newUploader(bucket, svc, res.FunctionName, res.FunctionVersion, invocations, logs, newCrashBudget(uploadsLimit, bytesLimit), state)
+	if enabled, err := strconv.ParseBool(extractBacktraces); err != nil {
+		extensionClient.InitError(ctx, "CRASH_BACKTRACE_INVALID")
+		panic(fmt.Errorf("invalid CRASH_BACKTRACE %q, expected true or false", extractBacktraces))
+	} else if enabled {
+		u.backtraceRoots = symbolPaths
+	}
+	watchCtx, stopWatching := context.WithCancel(ctx)
+	var workers sync.WaitGroup
+	workers.Add(2)
+	go func() {
+		defer workers.Done()
+		if err := watchAndUpload(watchCtx, u, directoriesToWatch, patternsToUpload); err != nil {
+			println(printPrefix, "Cannot watch for crash files", err.Error())
+		}
+	}()
+	go func() {
+		defer workers.Done()
+		u.retryPending(watchCtx)
+	}()
 
 	// Will block until shutdown event is received or cancelled via the context.
-	processEvents(ctx)
+	deadline := processEvents(ctx)
+
+	// Stop the watcher and the retries, interrupting their upload, and upload the remaining files
+	// synchronously within the shutdown budget
+	stopWatching()
+	workers.Wait()
+	if deadline.IsZero() {
+		deadline = time.Now().Add(time.Second)
+	}
+	sweepCtx, cancelSweep := context.WithDeadline(context.Background(), deadline.Add(-shutdownMargin))
+	defer cancelSweep()
+	println(printPrefix, "Uploaded", u.sweep(sweepCtx, directoriesToWatch, patternsToUpload), "files on shutdown")
+	if err := u.uploadSummary(sweepCtx); err != nil {
+		println(printPrefix, "Cannot upload the summary of the suppressed files", err.Error())
+	}
+	println(printPrefix, "Exiting")
 }
 
-func processEvents(ctx context.Context) {
-	var requestID string
+// Returns the deadline of the SHUTDOWN event, or a zero time when cancelled
+func processEvents(ctx context.Context) time.Time {
 	for {
 		select {
 		case <-ctx.Done():
-			return
+			return time.Time{}
 		default:
 			println(printPrefix, "Waiting for event...")
 			res, err := extensionClient.NextEvent(ctx)
 			if err != nil {
 				println(printPrefix, "Error:", err.Error())
-				println(printPrefix, "Exiting")
-				return
+				return time.Time{}
 			}
 			println(printPrefix, "Received event:", prettyPrint(res))
 			// Exit if we receive a SHUTDOWN event
 			if res.EventType == extension.Shutdown {
 				println(printPrefix, "Received SHUTDOWN event")
-				numFiles, err := renameFilesWithSubstring("/tmp", "core", fmt.Sprintf("dump.upload.%s", requestID))
-				if err != nil {
-					extensionClient.InitError(ctx, err.Error())
+				// Core files are named after the invocation they were written during
+				numFiles := 0
+				for _, directory := range directoriesToWatch {
+					renamed, err := renameFilesWithPrefix(directory, "core", func(file string, info os.FileInfo) string {
+						if item := invocations.at(info.ModTime()); item != nil {
+							return fmt.Sprintf("dump.upload.%s", item.RequestID)
+						}
+						return "dump.upload.init"
+					})
+					if err != nil {
+						println(printPrefix, "Cannot rename core files in", directory, err.Error())
+					}
+					numFiles += renamed
 				}
 				println(printPrefix, "Renamed", numFiles, "files")
-				println(printPrefix, "Exiting")
-				return
+				return time.Unix(0, res.DeadlineMs*int64(time.Millisecond))
 			} else if res.EventType == extension.Invoke {
-				requestID = res.RequestID
-
-				// trigger scan again
+				invocations.add(invocation{
+					RequestID:   res.RequestID,
+					FunctionArn: res.InvokedFunctionArn,
+					TraceID:     res.Tracing.Value,
+					StartedAt:   time.Now(),
+					Deadline:    time.Unix(0, res.DeadlineMs*int64(time.Millisecond)),
+				})
 			}
 		}
 	}
 }
 
+// Splits a comma separated env variable
+func getListFromEnv(name string, defaultValue string) []string {
+	value, found := os.LookupEnv(name)
+	if !found || strings.TrimSpace(value) == "" {
+		value = defaultValue
+	}
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func prettyPrint(v interface{}) string {
 	data, err := json.MarshalIndent(v, "", "\t")
 	if err != nil {
@@ -0,0 +1,141 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package main
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const manifestSchemaVersion = "2023-10-01"
+
+// invocation is the context of an INVOKE event
+type invocation struct {
+	RequestID   string
+	FunctionArn string
+	TraceID     string
+	StartedAt   time.Time
+	Deadline    time.Time
+}
+
+// invocationHistory keeps the last invocations, to find the one a crash file belongs to
+type invocationHistory struct {
+	lock  sync.Mutex
+	size  int
+	items []invocation
+}
+
+func newInvocationHistory(size int) *invocationHistory {
+	return &invocationHistory{size: size}
+}
+
+func (h *invocationHistory) add(item invocation) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.items = append(h.items, item)
+	if len(h.items) > h.size {
+		h.items = h.items[len(h.items)-h.size:]
+	}
+}
+
+// Returns the last invocation started before t, or nil when there was none
+func (h *invocationHistory) at(t time.Time) *invocation {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for i := len(h.items) - 1; i >= 0; i-- {
+		if !h.items[i].StartedAt.After(t) {
+			item := h.items[i]
+			return &item
+		}
+	}
+	return nil
+}
+
+// manifest is uploaded next to each crash file
+type manifest struct {
+	SchemaVersion   string       `json:"schemaVersion"`
+	FunctionName    string       `json:"functionName"`
+	FunctionVersion string       `json:"functionVersion"`
+	FunctionArn     string       `json:"functionArn,omitempty"`
+	RequestID       string       `json:"requestId,omitempty"`
+	TraceID         string       `json:"traceId,omitempty"`
+	InvokedAt       *time.Time   `json:"invokedAt,omitempty"`
+	InvokeDeadline  *time.Time   `json:"invokeDeadline,omitempty"`
+	CrashedAt       time.Time    `json:"crashedAt"`
+	UploadedAt      time.Time    `json:"uploadedAt"`
+	Runtime         string       `json:"runtime"`
+	Architecture    string       `json:"architecture"`
+	MemorySizeMB    int          `json:"memorySizeMb"`
+	Region          string       `json:"region"`
+	LogGroup        string       `json:"logGroup"`
+	LogStream       string       `json:"logStream"`
+	File            manifestFile `json:"file"`
+	BacktraceKeys   []string     `json:"backtraceKeys,omitempty"`
+	LogLines        []string     `json:"logLines"`
+}
+
+// manifestFile describes the uploaded crash file
+type manifestFile struct {
+	Path        string `json:"path"`
+	Key         string `json:"key"`
+	Size        int64  `json:"size"`
+	Sha256      string `json:"sha256"`
+	Compression string `json:"compression"`
+}
+
+// Returns the key prefix of a crash file, "<prefix>/<function>/<version>/<request ID>/". Crashes
+// that happened outside of an invocation, ex: during init, go to "<version>/init/"
+func crashKeyPrefix(functionName string, functionVersion string, item *invocation) string {
+	requestID := "init"
+	if item != nil {
+		requestID = item.RequestID
+	}
+	return path.Join(keyPrefix, functionName, functionVersion, requestID) + "/"
+}
+
+// Describes the crash file and the invocation it belongs to
+func newManifest(file string, info os.FileInfo, functionName string, functionVersion string, item *invocation, logLines []string) *manifest {
+	memorySize, _ := strconv.Atoi(os.Getenv("AWS_LAMBDA_FUNCTION_MEMORY_SIZE"))
+	m := &manifest{
+		SchemaVersion:   manifestSchemaVersion,
+		FunctionName:    functionName,
+		FunctionVersion: functionVersion,
+		CrashedAt:       info.ModTime().UTC(),
+		UploadedAt:      time.Now().UTC(),
+		Runtime:         os.Getenv("AWS_EXECUTION_ENV"),
+		Architecture:    runtime.GOARCH,
+		MemorySizeMB:    memorySize,
+		Region:          os.Getenv("AWS_REGION"),
+		LogGroup:        os.Getenv("AWS_LAMBDA_LOG_GROUP_NAME"),
+		LogStream:       os.Getenv("AWS_LAMBDA_LOG_STREAM_NAME"),
+		File:            manifestFile{Path: file, Compression: compression},
+		LogLines:        append([]string{}, logLines...),
+	}
+	if item != nil {
+		invokedAt, deadline := item.StartedAt.UTC(), item.Deadline.UTC()
+		m.FunctionArn = item.FunctionArn
+		m.RequestID = item.RequestID
+		m.TraceID = item.TraceID
+		m.InvokedAt = &invokedAt
+		m.InvokeDeadline = &deadline
+	}
+	return m
+}
+
+// Returns the keys of the crash file and its manifest
+func crashKeys(prefix string, file string) (string, string) {
+	name := filepath.Base(file)
+	return prefix + name + compressionExtensions[compression], prefix + name + ".manifest.json"
+}
+
+// Returns the keys of the text and JSON backtraces of a core file
+func backtraceKeys(prefix string, file string) (string, string) {
+	name := filepath.Base(file)
+	return prefix + name + ".backtrace.txt", prefix + name + ".backtrace.json"
+}
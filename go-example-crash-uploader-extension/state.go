@@ -0,0 +1,106 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Status of a crash file in the upload state
+const (
+	pendingStatus  = "pending"
+	uploadedStatus = "uploaded"
+
+	minRetryDelay = 2 * time.Second
+	maxRetryDelay = 5 * time.Minute
+)
+
+// fileState tracks the upload of a crash file until it is deleted
+type fileState struct {
+	Status      string    `json:"status"`
+	Sha256      string    `json:"sha256"`
+	Key         string    `json:"key,omitempty"`
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"nextAttempt,omitempty"`
+	LastError   string    `json:"lastError,omitempty"`
+}
+
+// uploadState is persisted to a file after every change, so that a file uploaded but not deleted
+// is not uploaded twice, and failed uploads are retried with backoff
+type uploadState struct {
+	path  string
+	Files map[string]*fileState `json:"files"`
+}
+
+// Loads the state file, a missing or unreadable file starts an empty state
+func loadUploadState(path string) *uploadState {
+	state := &uploadState{path: path, Files: make(map[string]*fileState)}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return state
+	}
+	if err := json.Unmarshal(data, state); err != nil || state.Files == nil {
+		println(printPrefix, "Ignoring invalid upload state", path)
+		state.Files = make(map[string]*fileState)
+	}
+	return state
+}
+
+// Writes the state to a temporary file renamed over the state file, so that it is never partial
+func (s *uploadState) save() error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	temporary, err := ioutil.TempFile(filepath.Dir(s.path), ".upload-state-")
+	if err != nil {
+		return err
+	}
+	if _, err := temporary.Write(data); err != nil {
+		temporary.Close()
+		os.Remove(temporary.Name())
+		return err
+	}
+	if err := temporary.Close(); err != nil {
+		os.Remove(temporary.Name())
+		return err
+	}
+	return os.Rename(temporary.Name(), s.path)
+}
+
+// Returns the state of the file, reset when its content changed
+func (s *uploadState) get(file string, checksum string) *fileState {
+	state, ok := s.Files[file]
+	if !ok || state.Sha256 != checksum {
+		state = &fileState{Status: pendingStatus, Sha256: checksum}
+		s.Files[file] = state
+	}
+	return state
+}
+
+// Records a failed attempt, the next one is delayed exponentially
+func (s *fileState) failed(err error) {
+	s.Attempts++
+	s.LastError = err.Error()
+	delay := minRetryDelay << uint(s.Attempts-1)
+	if delay > maxRetryDelay || delay <= 0 {
+		delay = maxRetryDelay
+	}
+	s.NextAttempt = time.Now().Add(delay)
+}
+
+// Returns the pending files due for a retry
+func (s *uploadState) due(now time.Time) []string {
+	var files []string
+	for file, state := range s.Files {
+		if state.Status == pendingStatus && !state.NextAttempt.After(now) {
+			files = append(files, file)
+		}
+	}
+	return files
+}
@@ -0,0 +1,103 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestFailedBacksOff(t *testing.T) {
+	state := &fileState{Status: pendingStatus}
+	for attempt, expected := range []time.Duration{2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second} {
+		before := time.Now()
+		state.failed(errors.New("throttled"))
+		if delay := state.NextAttempt.Sub(before); delay < expected || delay > expected+time.Second {
+			t.Fatalf("attempt %d retried after %v, expected %v", attempt+1, delay, expected)
+		}
+	}
+	if state.Attempts != 4 || state.LastError != "throttled" {
+		t.Fatalf("unexpected state %+v", state)
+	}
+
+	// The delay is capped, even once the shift overflows
+	for _, attempts := range []int{8, 64} {
+		state.Attempts = attempts
+		state.failed(errors.New("throttled"))
+		if delay := time.Until(state.NextAttempt); delay > maxRetryDelay || delay < maxRetryDelay-time.Second {
+			t.Fatalf("retried after %v after %d attempts, expected %v", delay, attempts+1, maxRetryDelay)
+		}
+	}
+}
+
+func TestDue(t *testing.T) {
+	now := time.Now()
+	state := &uploadState{Files: map[string]*fileState{
+		"/tmp/new":      {Status: pendingStatus},
+		"/tmp/due":      {Status: pendingStatus, Attempts: 1, NextAttempt: now.Add(-time.Second)},
+		"/tmp/now":      {Status: pendingStatus, Attempts: 1, NextAttempt: now},
+		"/tmp/later":    {Status: pendingStatus, Attempts: 1, NextAttempt: now.Add(time.Minute)},
+		"/tmp/uploaded": {Status: uploadedStatus},
+	}}
+	files := state.due(now)
+	sort.Strings(files)
+	if expected := []string{"/tmp/due", "/tmp/new", "/tmp/now"}; !reflect.DeepEqual(files, expected) {
+		t.Fatalf("due files %v, expected %v", files, expected)
+	}
+}
+
+func TestGetResetsChangedFiles(t *testing.T) {
+	state := &uploadState{Files: make(map[string]*fileState)}
+	first := state.get("/tmp/core.1", "abc")
+	first.failed(errors.New("throttled"))
+	if same := state.get("/tmp/core.1", "abc"); same != first || same.Attempts != 1 {
+		t.Fatalf("state of an unchanged file was reset: %+v", same)
+	}
+
+	// The file was rewritten, ex: by another crash, it is uploaded again
+	first.Status = uploadedStatus
+	changed := state.get("/tmp/core.1", "def")
+	if changed.Status != pendingStatus || changed.Attempts != 0 || changed.Sha256 != "def" || !changed.NextAttempt.IsZero() {
+		t.Fatalf("state of a changed file was kept: %+v", changed)
+	}
+}
+
+func TestSaveAndLoadState(t *testing.T) {
+	directory, err := ioutil.TempDir("", "crash-uploader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+	path := filepath.Join(directory, "state.json")
+
+	if state := loadUploadState(path); len(state.Files) != 0 {
+		t.Fatalf("missing state file loaded %v", state.Files)
+	}
+	state := loadUploadState(path)
+	state.get("/tmp/core.1", "abc").failed(errors.New("throttled"))
+	uploaded := state.get("/tmp/core.2", "def")
+	uploaded.Status, uploaded.Key = uploadedStatus, "crashes/core.2"
+	if err := state.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := loadUploadState(path)
+	if len(loaded.Files) != 2 || loaded.Files["/tmp/core.2"].Key != "crashes/core.2" || loaded.Files["/tmp/core.1"].Attempts != 1 {
+		t.Fatalf("loaded %+v, expected the saved files", loaded.Files)
+	}
+	if !loaded.Files["/tmp/core.1"].NextAttempt.Equal(state.Files["/tmp/core.1"].NextAttempt) {
+		t.Fatal("next attempt was not kept")
+	}
+
+	ioutil.WriteFile(path, []byte("not json"), 0600)
+	if state := loadUploadState(path); state.Files == nil || len(state.Files) != 0 {
+		t.Fatalf("invalid state file loaded %v", state.Files)
+	}
+}
@@ -5,81 +5,474 @@ package main
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
-	"net/http"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/klauspost/compress/zstd"
+
+	"aws-lambda-extensions/go-example-crash-uploader-extension/logsapi"
 )
 
-func searchForFilesAndUploadAndDelete(ctx context.Context, s3bucket string, rootDirectory string, substringToMatch string, creds credentials.Value) {
-	for {
-		time.Sleep(30 * time.Second)
+// Compression of the uploaded files, set with the "CRASH_COMPRESSION" env variable
+const (
+	zstdCompression = "zstd"
+	gzipCompression = "gzip"
+	noCompression   = "none"
 
-		filesToUpload, err := getFilesWithSubstring(rootDirectory, substringToMatch)
-		if err != nil {
-			println(printPrefix, "Cannot list files", err.Error())
-			res, _ := extensionClient.ExitError(ctx, err.Error())
-			println(printPrefix, "Cannot report ExitError", prettyPrint(res))
+	// Memory used by an upload is bounded by the part size times the concurrency
+	uploadPartSize    = 16 * 1024 * 1024
+	uploadConcurrency = 2
+)
+
+var (
+	errSameContentUploading = errors.New("a file with the same content is being uploaded")
+
+	compressionExtensions = map[string]string{
+		zstdCompression: ".zst",
+		gzipCompression: ".gz",
+		noCompression:   "",
+	}
+	compressionContentTypes = map[string]string{
+		zstdCompression: "application/zstd",
+		gzipCompression: "application/gzip",
+		noCompression:   "application/octet-stream",
+	}
+)
+
+// uploader uploads crash files to S3 with their manifest, and deletes them once uploaded
+type uploader struct {
+	bucket          string
+	svc             *s3.S3
+	functionName    string
+	functionVersion string
+	invocations     *invocationHistory
+	logs            *logsapi.LogBuffer
+	// Directories of the binaries the backtraces of core files are symbolized against, nil
+	// disables the backtraces
+	backtraceRoots []string
+
+	// lock guards the budget, the state and the files being uploaded
+	lock      sync.Mutex
+	budget    *crashBudget
+	state     *uploadState
+	uploading map[string]bool
+}
+
+// fileUploader uploads the crash files found by the watchers
+type fileUploader interface {
+	uploadAndDelete(ctx context.Context, file string) (bool, error)
+	sweep(ctx context.Context, directories []string, patterns []string) int
+}
+
+func newUploader(bucket string, svc *s3.S3, functionName string, functionVersion string, invocations *invocationHistory, logs *logsapi.LogBuffer, budget *crashBudget, state *uploadState) *uploader {
+	return &uploader{
+		bucket:          bucket,
+		svc:             svc,
+		functionName:    functionName,
+		functionVersion: functionVersion,
+		invocations:     invocations,
+		logs:            logs,
+		budget:          budget,
+		state:           state,
+		uploading:       make(map[string]bool),
+	}
+}
+
+// Uploads the file and removes it once the upload is verified. Files already uploaded by content,
+// or over the upload budget, are removed without being uploaded and listed in the summary. Files
+// that could not be uploaded are kept and retried with backoff. Returns whether the file was uploaded.
+// The lock is only held while the state is read and updated, the transfer of a large dump can take
+// minutes. A file already being uploaded is skipped
+func (u *uploader) uploadAndDelete(ctx context.Context, file string) (bool, error) {
+	if filepath.Dir(file) == filepath.Dir(u.state.path) && strings.HasPrefix(filepath.Base(file), ".upload-state") || file == u.state.path {
+		return false, nil
+	}
+	if !u.startUpload(file) {
+		return false, nil
+	}
+	defer u.endUpload(file)
+
+	info, err := os.Stat(file)
+	if err != nil {
+		// Already uploaded, or removed by the function
+		u.lock.Lock()
+		u.forget(file)
+		u.lock.Unlock()
+		return false, nil
+	}
+	checksum, size, err := hashFile(file)
+	if err != nil {
+		return false, err
+	}
+	item := u.invocations.at(info.ModTime())
+
+	u.lock.Lock()
+	state := u.state.get(file, checksum)
+	if u.budget.uploading(checksum) {
+		// Retried once the other file is uploaded, and then suppressed as a duplicate
+		defer u.lock.Unlock()
+		state.failed(errSameContentUploading)
+		u.saveState()
+		return false, nil
+	}
+	if state.Status == uploadedStatus {
+		// Uploaded by a previous attempt that could not delete it
+		defer u.lock.Unlock()
+		return false, u.delete(file)
+	}
+	if reason, duplicateOf := u.budget.check(checksum, size); reason != "" {
+		defer u.lock.Unlock()
+		crash := suppressedCrash{
+			Path:        file,
+			Size:        size,
+			Sha256:      checksum,
+			Reason:      reason,
+			DuplicateOf: duplicateOf,
+			CrashedAt:   info.ModTime().UTC(),
 		}
+		if item != nil {
+			crash.RequestID = item.RequestID
+		}
+		u.budget.suppress(crash)
+		println(printPrefix, "Suppressed", file, "reason:", reason)
+		return false, u.delete(file)
+	}
+	u.budget.reserve(checksum, size)
+	u.lock.Unlock()
+
+	key, err := u.upload(ctx, file, info, item, checksum, size)
+
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	u.budget.release(checksum)
+	// The state is replaced when the file was seen with another content during the upload
+	state = u.state.get(file, checksum)
+	if err != nil {
+		state.failed(err)
+		u.saveState()
+		return false, err
+	}
+	state.Status, state.Key = uploadedStatus, key
+	u.saveState()
+	u.budget.uploaded(checksum, size, key)
+	return true, u.delete(file)
+}
+
+// Marks the file as being uploaded, returns false when it already is
+func (u *uploader) startUpload(file string) bool {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	if u.uploading[file] {
+		return false
+	}
+	u.uploading[file] = true
+	return true
+}
+
+func (u *uploader) endUpload(file string) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	delete(u.uploading, file)
+}
 
-		if len(filesToUpload) > 0 {
-			println(printPrefix, "Found", len(filesToUpload), "files to upload")
-			svc, err := createS3Client(creds)
-			if err != nil {
-				println(printPrefix, "Cannot create an S3 client", err.Error())
-				res, _ := extensionClient.ExitError(ctx, err.Error())
-				println(printPrefix, "Cannot report ExitError", prettyPrint(res))
+// Uploads the file and its manifest, returns the key of the file
+func (u *uploader) upload(ctx context.Context, file string, info os.FileInfo, item *invocation, checksum string, size int64) (string, error) {
+	prefix := crashKeyPrefix(u.functionName, u.functionVersion, item)
+	key, manifestKey := crashKeys(prefix, file)
+	if err := uploadFile(ctx, u.svc, u.bucket, key, file, checksum, size); err != nil {
+		return "", err
+	}
+
+	var logLines []string
+	if u.logs != nil {
+		logLines = u.logs.Lines()
+	}
+	m := newManifest(file, info, u.functionName, u.functionVersion, item, logLines)
+	m.File.Key, m.File.Size, m.File.Sha256 = key, size, checksum
+
+	if u.backtraceRoots != nil {
+		textKey, jsonKey := backtraceKeys(prefix, file)
+		trace, err := extractBacktrace(file, u.backtraceRoots)
+		switch {
+		case err == errNotCore:
+		case err != nil:
+			println(printPrefix, "Cannot extract the backtrace of", file, err.Error())
+		default:
+			if err := u.putObject(ctx, textKey, []byte(trace.text()), "text/plain; charset=utf-8"); err != nil {
+				return "", err
 			}
+			if err := u.putJson(ctx, jsonKey, trace); err != nil {
+				return "", err
+			}
+			m.BacktraceKeys = []string{textKey, jsonKey}
+		}
+	}
+
+	if err := u.putJson(ctx, manifestKey, m); err != nil {
+		return "", err
+	}
+	println(printPrefix, "uploaded manifest to s3:", u.bucket, manifestKey)
+	return key, nil
+}
+
+// Removes the file and its state. Expects the lock to be held
+func (u *uploader) delete(file string) error {
+	if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	u.forget(file)
+	return nil
+}
+
+func (u *uploader) forget(file string) {
+	if _, ok := u.state.Files[file]; ok {
+		delete(u.state.Files, file)
+		u.saveState()
+	}
+}
+
+func (u *uploader) saveState() {
+	if err := u.state.save(); err != nil {
+		println(printPrefix, "Cannot save the upload state", err.Error())
+	}
+}
 
-			count := 0
-			for _, file := range filesToUpload {
-				err := uploadFile(svc, s3bucket, file, file)
-				if err != nil {
-					println(printPrefix, "Cannot upload file", err.Error())
-					res, _ := extensionClient.ExitError(ctx, err.Error())
-					println(printPrefix, "Cannot report ExitError", prettyPrint(res))
-				} else {
-					count++
+// Retries the failed uploads once their backoff elapsed, until ctx is cancelled
+func (u *uploader) retryPending(ctx context.Context) {
+	ticker := time.NewTicker(minRetryDelay)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			u.lock.Lock()
+			files := u.state.due(time.Now())
+			u.lock.Unlock()
+			for _, file := range files {
+				if ctx.Err() != nil {
+					return
 				}
-				err = os.Remove(file)
-				if err != nil {
-					println(printPrefix, "Cannot remove uploaded file", err.Error())
-					res, _ := extensionClient.ExitError(ctx, err.Error())
-					println(printPrefix, "Cannot report ExitError", prettyPrint(res))
+				if _, err := u.uploadAndDelete(ctx, file); err != nil {
+					println(printPrefix, "Cannot upload file", file, err.Error())
 				}
 			}
 		}
 	}
 }
 
-func uploadFile(svc *s3.S3, s3bucket string, key string, filename string) error {
+// Uploads the summary of the suppressed crash files, if any
+func (u *uploader) uploadSummary(ctx context.Context) error {
+	// The summary is a copy, the crash files keep being uploaded during its upload
+	u.lock.Lock()
+	summary := u.budget.summary(u.functionName, u.functionVersion)
+	u.lock.Unlock()
+	if summary == nil {
+		return nil
+	}
+	key := summaryKey(u.functionName, u.functionVersion)
+	if err := u.putJson(ctx, key, summary); err != nil {
+		return err
+	}
+	println(printPrefix, "uploaded summary of", summary.SuppressedCount, "suppressed files to s3:", u.bucket, key)
+	return nil
+}
+
+func (u *uploader) putJson(ctx context.Context, key string, document interface{}) error {
+	body, err := json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return err
+	}
+	return u.putObject(ctx, key, body, "application/json")
+}
+
+func (u *uploader) putObject(ctx context.Context, key string, body []byte, contentType string) error {
+	_, err := u.svc.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(u.bucket),
+		Key:         aws.String(key),
+		ACL:         aws.String("private"),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String(contentType),
+	})
+	return err
+}
+
+// Walks the directories and uploads every file matching the patterns. Returns the number of files uploaded
+func (u *uploader) sweep(ctx context.Context, directories []string, patterns []string) int {
+	var files []string
+	for _, directory := range directories {
+		_ = filepath.Walk(directory, func(path string, info os.FileInfo, err error) error {
+			if err == nil && info.Mode().IsRegular() && matchesPatterns(path, patterns) {
+				files = append(files, path)
+			}
+			return nil
+		})
+	}
+
+	count := 0
+	for _, file := range files {
+		if ctx.Err() != nil {
+			println(printPrefix, "Sweep interrupted,", len(files)-count, "files left")
+			break
+		}
+		uploaded, err := u.uploadAndDelete(ctx, file)
+		if err != nil {
+			println(printPrefix, "Cannot upload file", file, err.Error())
+			continue
+		}
+		if uploaded {
+			count++
+		}
+	}
+	return count
+}
+
+// Matches the base name of the file against the glob patterns, ex: "dump.upload*"
+func matchesPatterns(path string, patterns []string) bool {
+	name := filepath.Base(path)
+	for _, pattern := range patterns {
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Streams the file through the compressor into a multipart upload, so that memory stays bounded
+// by the part size whatever the size of the dump. The SHA-256 and the size of the uncompressed file
+// are stored in the object metadata. Returns an error when the file changed since they were computed
+func uploadFile(ctx context.Context, svc *s3.S3, s3bucket string, key string, filename string, checksum string, size int64) error {
 	file, err := os.Open(filename)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
-	fileInfo, _ := file.Stat()
-	size := fileInfo.Size()
-	buffer := make([]byte, size)
-	file.Read(buffer)
 
-	println(printPrefix, "Uploading filename", filename, "with size", size)
+	hash := sha256.New()
+	source := io.TeeReader(file, hash)
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(compress(writer, source))
+	}()
+	// Unblocks the compressor when the upload fails
+	defer reader.Close()
+	body := &countingReader{reader: reader}
+
+	println(printPrefix, "Uploading filename", filename, "with size", size, "to", key)
 
-	_, err = svc.PutObject(&s3.PutObjectInput{
+	uploader := s3manager.NewUploaderWithClient(svc, func(u *s3manager.Uploader) {
+		u.PartSize = uploadPartSize
+		u.Concurrency = uploadConcurrency
+	})
+	_, err = uploader.UploadWithContext(ctx, &s3manager.UploadInput{
 		Bucket:             aws.String(s3bucket),
 		Key:                aws.String(key),
 		ACL:                aws.String("private"),
-		Body:               bytes.NewReader(buffer),
-		ContentLength:      aws.Int64(size),
-		ContentType:        aws.String(http.DetectContentType(buffer)),
+		Body:               body,
+		ContentType:        aws.String(compressionContentTypes[compression]),
 		ContentDisposition: aws.String("attachment"),
+		Metadata: map[string]*string{
+			"sha256":            aws.String(checksum),
+			"uncompressed-size": aws.String(strconv.FormatInt(size, 10)),
+			"compression":       aws.String(compression),
+		},
 	})
+	if err != nil {
+		return err
+	}
+	if streamed := hex.EncodeToString(hash.Sum(nil)); streamed != checksum {
+		return fmt.Errorf("%s changed during the upload", filename)
+	}
+	if err := verifyUpload(ctx, svc, s3bucket, key, checksum, body.count); err != nil {
+		return err
+	}
 
 	println(printPrefix, "uploaded to s3:", s3bucket, key)
 
-	return err
+	return nil
+}
+
+// Checks that the object has the expected size and checksum
+func verifyUpload(ctx context.Context, svc *s3.S3, s3bucket string, key string, checksum string, size int64) error {
+	head, err := svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s3bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return err
+	}
+	if aws.Int64Value(head.ContentLength) != size {
+		return fmt.Errorf("uploaded %s has %d bytes, expected %d", key, aws.Int64Value(head.ContentLength), size)
+	}
+	for name, value := range head.Metadata {
+		if strings.EqualFold(name, "sha256") && aws.StringValue(value) == checksum {
+			return nil
+		}
+	}
+	return fmt.Errorf("uploaded %s does not have the expected sha256 metadata", key)
+}
+
+// countingReader counts the bytes read, ex: the size of the compressed file
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.count += int64(n)
+	return n, err
+}
+
+// Copies the source to the writer with the configured compression
+func compress(writer io.Writer, source io.Reader) error {
+	var compressor io.WriteCloser
+	switch compression {
+	case zstdCompression:
+		encoder, err := zstd.NewWriter(writer, zstd.WithEncoderLevel(zstd.SpeedFastest), zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			return err
+		}
+		compressor = encoder
+	case gzipCompression:
+		compressor = gzip.NewWriter(writer)
+	default:
+		_, err := io.Copy(writer, source)
+		return err
+	}
+	if _, err := io.Copy(compressor, source); err != nil {
+		compressor.Close()
+		return err
+	}
+	return compressor.Close()
+}
+
+// Returns the hex encoded SHA-256 and the size of the file
+func hashFile(filename string) (string, int64, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
 }
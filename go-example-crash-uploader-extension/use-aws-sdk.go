@@ -8,12 +8,12 @@ import (
 	"os"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 )
 
-func createS3Client(creds credentials.Value) (*s3.S3, error) {
+// Credentials are read from the default chain, so that they are refreshed when they expire
+func createS3Client() (*s3.S3, error) {
 	// Create session and S3 client
 	s3region, s3regionFound := os.LookupEnv("AWS_REGION")
 	if !s3regionFound {
@@ -23,11 +23,6 @@ func createS3Client(creds credentials.Value) (*s3.S3, error) {
 	sess, err := session.NewSession(
 		&aws.Config{
 			Region: aws.String(s3region),
-			Credentials: credentials.NewStaticCredentials(
-				creds.AccessKeyID,
-				creds.SecretAccessKey,
-				creds.SessionToken,
-			),
 		})
 	if err != nil {
 		return nil, err
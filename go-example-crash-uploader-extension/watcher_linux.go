@@ -0,0 +1,173 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const watchMask = syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_MODIFY | syscall.IN_CREATE | syscall.IN_ONLYDIR
+
+// Time a completed file must stay unmodified before it is uploaded, so that a file closed and
+// opened again for writing, ex: by a crash handler appending to a dump, is only uploaded once
+var uploadDebounce = 500 * time.Millisecond
+
+// Watches the directories and their subdirectories with inotify, and uploads matching files once
+// they are closed after writing or moved into a watched directory, and left unmodified for the
+// debounce time. Blocks until ctx is cancelled
+func watchAndUpload(ctx context.Context, u fileUploader, directories []string, patterns []string) error {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return os.NewSyscallError("inotify_init1", err)
+	}
+	// A non blocking file is handled by the runtime poller, so closing it unblocks Read
+	events := os.NewFile(uintptr(fd), "inotify")
+	go func() {
+		<-ctx.Done()
+		events.Close()
+	}()
+
+	completed := newDebouncer(ctx, uploadDebounce)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case path := <-completed.ready:
+				if _, err := u.uploadAndDelete(ctx, path); err != nil {
+					println(printPrefix, "Cannot upload file", path, err.Error())
+				}
+			}
+		}
+	}()
+
+	watches := make(map[int32]string)
+	addWatches := func(root string) {
+		_ = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil || !info.IsDir() {
+				return nil
+			}
+			wd, err := syscall.InotifyAddWatch(fd, path, watchMask)
+			if err != nil {
+				println(printPrefix, "Cannot watch", path, err.Error())
+				return nil
+			}
+			watches[int32(wd)] = path
+			return nil
+		})
+	}
+	for _, directory := range directories {
+		addWatches(directory)
+	}
+	println(printPrefix, "Watching", len(watches), "directories for", strings.Join(patterns, ", "))
+
+	buffer := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := events.Read(buffer)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buffer[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			offset = nameStart + int(event.Len)
+			name := strings.TrimRight(string(buffer[nameStart:offset]), "\x00")
+
+			if event.Mask&syscall.IN_Q_OVERFLOW != 0 {
+				println(printPrefix, "Inotify queue overflow, sweeping the watched directories")
+				u.sweep(ctx, directories, patterns)
+				continue
+			}
+			if event.Mask&syscall.IN_IGNORED != 0 {
+				delete(watches, event.Wd)
+				continue
+			}
+			directory, ok := watches[event.Wd]
+			if !ok || name == "" {
+				continue
+			}
+			path := filepath.Join(directory, name)
+
+			if event.Mask&syscall.IN_ISDIR != 0 {
+				if event.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+					// Files may have been completed before the watch was added
+					addWatches(path)
+					u.sweep(ctx, []string{path}, patterns)
+				}
+				continue
+			}
+			if !matchesPatterns(path, patterns) {
+				continue
+			}
+			if event.Mask&(syscall.IN_CLOSE_WRITE|syscall.IN_MOVED_TO) != 0 {
+				completed.schedule(path)
+			} else if event.Mask&syscall.IN_MODIFY != 0 {
+				// Written again, waits for the next close
+				completed.cancel(path)
+			}
+		}
+	}
+}
+
+// debouncer sends a path to ready once it has not been scheduled or cancelled again for the delay
+type debouncer struct {
+	ctx    context.Context
+	delay  time.Duration
+	ready  chan string
+	lock   sync.Mutex
+	timers map[string]*time.Timer
+}
+
+func newDebouncer(ctx context.Context, delay time.Duration) *debouncer {
+	return &debouncer{ctx: ctx, delay: delay, ready: make(chan string), timers: make(map[string]*time.Timer)}
+}
+
+func (d *debouncer) schedule(path string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if timer, ok := d.timers[path]; ok {
+		timer.Stop()
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(d.delay, func() {
+		d.lock.Lock()
+		current := d.timers[path] == timer
+		if current {
+			delete(d.timers, path)
+		}
+		d.lock.Unlock()
+		if !current {
+			// Rescheduled or cancelled after the timer fired
+			return
+		}
+		select {
+		case d.ready <- path:
+		case <-d.ctx.Done():
+		}
+	})
+	d.timers[path] = timer
+}
+
+func (d *debouncer) cancel(path string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if timer, ok := d.timers[path]; ok {
+		timer.Stop()
+		delete(d.timers, path)
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeUploader records the name and the content of the uploaded files, and deletes them
+type fakeUploader struct {
+	uploaded chan string
+}
+
+func (f *fakeUploader) uploadAndDelete(ctx context.Context, file string) (bool, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		// Already uploaded
+		return false, nil
+	}
+	f.uploaded <- filepath.Base(file) + ":" + string(content)
+	return true, os.Remove(file)
+}
+
+func (f *fakeUploader) sweep(ctx context.Context, directories []string, patterns []string) int {
+	count := 0
+	for _, directory := range directories {
+		_ = filepath.Walk(directory, func(path string, info os.FileInfo, err error) error {
+			if err == nil && info.Mode().IsRegular() && matchesPatterns(path, patterns) {
+				if uploaded, _ := f.uploadAndDelete(ctx, path); uploaded {
+					count++
+				}
+			}
+			return nil
+		})
+	}
+	return count
+}
+
+func (f *fakeUploader) expectUpload(t *testing.T, expected string) {
+	t.Helper()
+	select {
+	case upload := <-f.uploaded:
+		if upload != expected {
+			t.Fatalf("uploaded %q, expected %q", upload, expected)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("%q was not uploaded", expected)
+	}
+}
+
+func (f *fakeUploader) expectNoUpload(t *testing.T, wait time.Duration) {
+	t.Helper()
+	select {
+	case upload := <-f.uploaded:
+		t.Fatalf("unexpected upload %q", upload)
+	case <-time.After(wait):
+	}
+}
+
+// Watches the directories for dump.upload* files until the end of the test
+func startWatcher(t *testing.T, directories ...string) *fakeUploader {
+	debounce := uploadDebounce
+	uploadDebounce = 100 * time.Millisecond
+	u := &fakeUploader{uploaded: make(chan string, 10)}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- watchAndUpload(ctx, u, directories, []string{"dump.upload*"})
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("watcher failed: %v", err)
+		}
+		uploadDebounce = debounce
+	})
+	// Lets the watcher add its watches
+	time.Sleep(100 * time.Millisecond)
+	return u
+}
+
+func TestWatcherUploadsClosedFiles(t *testing.T) {
+	directory := t.TempDir()
+	u := startWatcher(t, directory)
+
+	if err := ioutil.WriteFile(filepath.Join(directory, "other.log"), []byte("log"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(directory, "dump.upload.1"), []byte("crash"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	u.expectUpload(t, "dump.upload.1:crash")
+	u.expectNoUpload(t, 3*uploadDebounce)
+	if _, err := os.Stat(filepath.Join(directory, "other.log")); err != nil {
+		t.Fatalf("file not matching the patterns was removed: %v", err)
+	}
+}
+
+func TestWatcherDebouncesRewrittenFiles(t *testing.T) {
+	directory := t.TempDir()
+	u := startWatcher(t, directory)
+
+	path := filepath.Join(directory, "dump.upload.1")
+	if err := ioutil.WriteFile(path, []byte("first,"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString("second")
+	file.Close()
+
+	u.expectUpload(t, "dump.upload.1:first,second")
+	u.expectNoUpload(t, 3*uploadDebounce)
+}
+
+func TestWatcherWaitsForTheWriterToClose(t *testing.T) {
+	directory := t.TempDir()
+	u := startWatcher(t, directory)
+
+	file, err := os.Create(filepath.Join(directory, "dump.upload.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString("partial,")
+	u.expectNoUpload(t, 3*uploadDebounce)
+
+	file.WriteString("complete")
+	file.Close()
+	u.expectUpload(t, "dump.upload.1:partial,complete")
+}
+
+func TestWatcherUploadsMovedFiles(t *testing.T) {
+	directory, staging := t.TempDir(), t.TempDir()
+	u := startWatcher(t, directory)
+
+	staged := filepath.Join(staging, "dump.upload.1")
+	if err := ioutil.WriteFile(staged, []byte("crash"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	u.expectNoUpload(t, 3*uploadDebounce)
+	if err := os.Rename(staged, filepath.Join(directory, "dump.upload.1")); err != nil {
+		t.Fatal(err)
+	}
+	u.expectUpload(t, "dump.upload.1:crash")
+}
+
+func TestWatcherWatchesNewDirectories(t *testing.T) {
+	directory := t.TempDir()
+	u := startWatcher(t, directory)
+
+	subdirectory := filepath.Join(directory, "crashes")
+	if err := os.Mkdir(subdirectory, 0700); err != nil {
+		t.Fatal(err)
+	}
+	// Written before or after the watch is added, the file is found by the sweep or the watch
+	if err := ioutil.WriteFile(filepath.Join(subdirectory, "dump.upload.1"), []byte("crash"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	u.expectUpload(t, "dump.upload.1:crash")
+	u.expectNoUpload(t, 3*uploadDebounce)
+}
+
+func TestCrashDirectories(t *testing.T) {
+	first, second := t.TempDir(), t.TempDir()
+	t.Setenv("CRASH_DIRECTORIES", " "+first+", ,"+second+" ")
+	directories := getListFromEnv("CRASH_DIRECTORIES", "/tmp")
+	if !reflect.DeepEqual(directories, []string{first, second}) {
+		t.Fatalf("CRASH_DIRECTORIES parsed as %q", directories)
+	}
+
+	u := startWatcher(t, directories...)
+	for idx, directory := range directories {
+		name := "dump.upload." + string(rune('1'+idx))
+		if err := ioutil.WriteFile(filepath.Join(directory, name), []byte("crash"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		u.expectUpload(t, name+":crash")
+	}
+
+	t.Setenv("CRASH_DIRECTORIES", " ")
+	if directories := getListFromEnv("CRASH_DIRECTORIES", "/tmp"); !reflect.DeepEqual(directories, []string{"/tmp"}) {
+		t.Fatalf("empty CRASH_DIRECTORIES parsed as %q, expected the default", directories)
+	}
+}
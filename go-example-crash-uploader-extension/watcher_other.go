@@ -0,0 +1,26 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// Polls the directories, inotify is only available on Linux. Lets the extension run locally
+func watchAndUpload(ctx context.Context, u fileUploader, directories []string, patterns []string) error {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			u.sweep(ctx, directories, patterns)
+		}
+	}
+}
@@ -4,7 +4,11 @@
 function handler () {
   EVENT_DATA=$1
   RESPONSE="Echoing request: '$EVENT_DATA'"
-  echo $(curl -XGET -m 5 "http://localhost:2772/")
-  echo $(cat /tmp/test.txt)
+  TOKEN="X-Extension-Token: $(cat /tmp/ipc-extension.token)"
+  echo $(curl -XGET -H "$TOKEN" -m 5 "http://localhost:2772/")
+  echo "Invocations of this environment:" $(curl -XPOST -H "$TOKEN" -s -m 5 "http://localhost:2772/incr/invocations")
+  curl -XPUT -H "$TOKEN" -s -m 5 --unix-socket /tmp/ipc-extension.sock "http://localhost/kv/last-request?ttl=1h" -d "$EVENT_DATA"
+  echo "Last request:" $(curl -XGET -H "$TOKEN" -s -m 5 --unix-socket /tmp/ipc-extension.sock "http://localhost/kv/last-request")
+  echo "Queued job:" $(curl -XPOST -H "$TOKEN" -s -m 5 "http://localhost:2772/jobs" -d '{"url":"https://checkip.amazonaws.com/","method":"GET"}')
   echo $RESPONSE
-}
\ No newline at end of file
+}
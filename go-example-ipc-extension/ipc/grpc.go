@@ -0,0 +1,157 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package ipc
+
+import (
+	"context"
+	"time"
+
+	"aws-lambda-extensions/go-example-ipc-transport/ipcpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RegisterServices registers the gRPC services of the store and of the job queue
+func RegisterServices(server *grpc.Server, store *Store, queue *Queue) {
+	ipcpb.RegisterKeyValueServer(server, &keyValueServer{store: store})
+	ipcpb.RegisterJobsServer(server, &jobsServer{queue: queue})
+}
+
+type keyValueServer struct {
+	ipcpb.UnimplementedKeyValueServer
+	store *Store
+}
+
+func (s *keyValueServer) Get(ctx context.Context, req *ipcpb.GetRequest) (*ipcpb.Entry, error) {
+	entry, err := s.store.Get(req.Key)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return toProtoEntry(entry), nil
+}
+
+func (s *keyValueServer) Set(ctx context.Context, req *ipcpb.SetRequest) (*ipcpb.Entry, error) {
+	if req.Key == "" || req.TtlMs < 0 {
+		return nil, status.Error(codes.InvalidArgument, "invalid key or ttl")
+	}
+	if len(req.Value) > maxValueSize {
+		return nil, status.Error(codes.InvalidArgument, "value larger than 1MB")
+	}
+	ttl := time.Duration(req.TtlMs) * time.Millisecond
+	var entry Entry
+	var err error
+	if req.IfVersion == nil {
+		entry, err = s.store.Set(req.Key, req.Value, ttl)
+	} else {
+		entry, err = s.store.CompareAndSet(req.Key, req.Value, *req.IfVersion, ttl)
+	}
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return toProtoEntry(entry), nil
+}
+
+func (s *keyValueServer) Delete(ctx context.Context, req *ipcpb.DeleteRequest) (*ipcpb.DeleteResponse, error) {
+	var err error
+	if req.IfVersion != nil {
+		err = s.store.CompareAndDelete(req.Key, *req.IfVersion)
+	} else {
+		err = s.store.Delete(req.Key)
+	}
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &ipcpb.DeleteResponse{}, nil
+}
+
+func (s *keyValueServer) Increment(ctx context.Context, req *ipcpb.IncrementRequest) (*ipcpb.IncrementResponse, error) {
+	if req.Key == "" || req.TtlMs < 0 {
+		return nil, status.Error(codes.InvalidArgument, "invalid key or ttl")
+	}
+	value, entry, err := s.store.Increment(req.Key, req.By, time.Duration(req.TtlMs)*time.Millisecond)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &ipcpb.IncrementResponse{Value: value, Version: entry.Version, TtlMs: ttlMs(entry)}, nil
+}
+
+func (s *keyValueServer) Touch(ctx context.Context, req *ipcpb.TouchRequest) (*ipcpb.Entry, error) {
+	if req.TtlMs < 0 {
+		return nil, status.Error(codes.InvalidArgument, "invalid ttl")
+	}
+	entry, err := s.store.Touch(req.Key, time.Duration(req.TtlMs)*time.Millisecond)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return toProtoEntry(entry), nil
+}
+
+func (s *keyValueServer) Keys(ctx context.Context, req *ipcpb.KeysRequest) (*ipcpb.KeysResponse, error) {
+	return &ipcpb.KeysResponse{Keys: s.store.Keys(req.Prefix)}, nil
+}
+
+type jobsServer struct {
+	ipcpb.UnimplementedJobsServer
+	queue *Queue
+}
+
+func (s *jobsServer) Enqueue(ctx context.Context, req *ipcpb.Job) (*ipcpb.EnqueueResponse, error) {
+	job := &Job{
+		Method:      req.Method,
+		URL:         req.Url,
+		Headers:     req.Headers,
+		TimeoutMs:   req.TimeoutMs,
+		MaxAttempts: int(req.MaxAttempts),
+		payload:     req.Body,
+	}
+	id, err := s.queue.Enqueue(job)
+	if err == ErrQueueFull {
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return &ipcpb.EnqueueResponse{Id: id}, nil
+}
+
+func (s *jobsServer) Stats(ctx context.Context, req *ipcpb.JobStatsRequest) (*ipcpb.JobStats, error) {
+	stats := s.queue.Stats()
+	return &ipcpb.JobStats{
+		Pending:   int64(stats.Pending),
+		Succeeded: int64(stats.Succeeded),
+		Failed:    int64(stats.Failed),
+		Retried:   int64(stats.Retried),
+		LastError: stats.LastError,
+	}, nil
+}
+
+func toProtoEntry(entry Entry) *ipcpb.Entry {
+	return &ipcpb.Entry{Value: entry.Value, Version: entry.Version, TtlMs: ttlMs(entry)}
+}
+
+func ttlMs(entry Entry) int64 {
+	if entry.ExpiresAt.IsZero() {
+		return 0
+	}
+	// An expiring key never reports 0, which means no expiration
+	if ttl := int64(time.Until(entry.ExpiresAt) / time.Millisecond); ttl > 0 {
+		return ttl
+	}
+	return 1
+}
+
+// Maps the errors of the store to the status codes of the HTTP API equivalents
+func grpcError(err error) error {
+	switch err {
+	case ErrNotFound:
+		return status.Error(codes.NotFound, err.Error())
+	case ErrVersionMismatch, ErrNotCounter:
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case ErrStoreFull:
+		return status.Error(codes.ResourceExhausted, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
@@ -4,42 +4,263 @@
 package ipc
 
 import (
+	"encoding/json"
 	"fmt"
-	"io"
+	"io/ioutil"
 	"net/http"
-	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"aws-lambda-extensions/go-example-ipc-transport/transport"
+	"google.golang.org/grpc"
 )
 
-// Start begins running the sidecar
-func Start(port string) {
-	writeToFileSystem("/tmp/test.txt", "Hello I'm a temp file")
-	go startHTTPServer(port)
+const (
+	kvPath    = "/kv/"
+	incrPath  = "/incr/"
+	touchPath = "/touch/"
+	jobsPath  = "/jobs"
+
+	// Largest value accepted, the store is kept in the extension memory
+	maxValueSize = 1 << 20
+)
+
+// Start begins running the sidecar, serving the store and the job queue over HTTP and gRPC on the
+// listeners of the config
+func Start(store *Store, queue *Queue, config transport.Config) (*transport.Server, error) {
+	return transport.Serve(config, NewHandler(store, queue), func(server *grpc.Server) {
+		RegisterServices(server, store, queue)
+	})
 }
 
-func writeToFileSystem(filename string, data string) {
-	file, err := os.Create(filename)
+// NewHandler returns the HTTP API of the store and of the job queue:
+//
+//	GET    /kv/{key}                 value, version in ETag
+//	PUT    /kv/{key}?ttl=30s         set, If-Match: "<version>" or If-None-Match: * for compare-and-set
+//	DELETE /kv/{key}                 delete, If-Match: "<version>" for compare-and-delete
+//	GET    /kv/?prefix=session/      keys starting with the prefix
+//	POST   /incr/{key}?by=1&ttl=60s  atomic counter, the TTL applies when the counter is created
+//	POST   /touch/{key}?ttl=30m      reset the TTL
+//	POST   /jobs                     queue a job, it runs in the background
+//	GET    /jobs                     counters of the queue
+func NewHandler(store *Store, queue *Queue) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, "Hello from http server")
+	})
+	mux.HandleFunc(kvPath, func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.URL.Path, kvPath)
+		if key == "" {
+			if r.Method != http.MethodGet {
+				methodNotAllowed(w, http.MethodGet)
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string][]string{"keys": store.Keys(r.URL.Query().Get("prefix"))})
+			return
+		}
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			entry, err := store.Get(key)
+			if err != nil {
+				writeError(w, err)
+				return
+			}
+			writeEntry(w, http.StatusOK, entry)
+		case http.MethodPut:
+			putValue(store, key, w, r)
+		case http.MethodDelete:
+			deleteValue(store, key, w, r)
+		default:
+			methodNotAllowed(w, "GET, HEAD, PUT, DELETE")
+		}
+	})
+	mux.HandleFunc(incrPath, func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.URL.Path, incrPath)
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		delta := int64(1)
+		if by := r.URL.Query().Get("by"); by != "" {
+			var err error
+			if delta, err = strconv.ParseInt(by, 10, 64); err != nil {
+				http.Error(w, "invalid by: "+by, http.StatusBadRequest)
+				return
+			}
+		}
+		ttl, err := parseTTL(r)
+		if key == "" || err != nil {
+			http.Error(w, "invalid key or ttl", http.StatusBadRequest)
+			return
+		}
+		_, entry, err := store.Increment(key, delta, ttl)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeEntry(w, http.StatusOK, entry)
+	})
+	mux.HandleFunc(touchPath, func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.URL.Path, touchPath)
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		ttl, err := parseTTL(r)
+		if key == "" || err != nil {
+			http.Error(w, "invalid key or ttl", http.StatusBadRequest)
+			return
+		}
+		entry, err := store.Touch(key, ttl)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeEntry(w, http.StatusOK, entry)
+	})
+	mux.HandleFunc(jobsPath, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, queue.Stats())
+		case http.MethodPost:
+			var job Job
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxValueSize)).Decode(&job); err != nil {
+				http.Error(w, "invalid job: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			id, err := queue.Enqueue(&job)
+			if err == ErrQueueFull {
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			writeJSON(w, http.StatusAccepted, map[string]string{"id": id})
+		default:
+			methodNotAllowed(w, "GET, POST")
+		}
+	})
+	return mux
+}
+
+func putValue(store *Store, key string, w http.ResponseWriter, r *http.Request) {
+	ttl, err := parseTTL(r)
 	if err != nil {
-		panic(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-	defer file.Close()
-
-	_, err = io.WriteString(file, data)
+	value, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxValueSize))
 	if err != nil {
-		panic(err)
+		http.Error(w, "value larger than 1MB", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var entry Entry
+	switch {
+	case r.Header.Get("If-None-Match") == "*":
+		entry, err = store.CompareAndSet(key, value, 0, ttl)
+	case r.Header.Get("If-Match") != "":
+		version, parseErr := parseVersion(r.Header.Get("If-Match"))
+		if parseErr != nil {
+			http.Error(w, parseErr.Error(), http.StatusBadRequest)
+			return
+		}
+		entry, err = store.CompareAndSet(key, value, version, ttl)
+	default:
+		entry, err = store.Set(key, value, ttl)
 	}
-	err = file.Sync()
 	if err != nil {
-		panic(err)
+		writeError(w, err)
+		return
 	}
+	setEntryHeaders(w, entry)
+	w.WriteHeader(http.StatusNoContent)
 }
 
-func startHTTPServer(port string) {
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprint(w, "Hello from http server")
-	})
-	// port 8080 is used by the Lambda Invoke API
-	err := http.ListenAndServe("sandbox.localdomain:"+port, nil)
+func deleteValue(store *Store, key string, w http.ResponseWriter, r *http.Request) {
+	var err error
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		version, parseErr := parseVersion(ifMatch)
+		if parseErr != nil {
+			http.Error(w, parseErr.Error(), http.StatusBadRequest)
+			return
+		}
+		err = store.CompareAndDelete(key, version)
+	} else {
+		err = store.Delete(key)
+	}
 	if err != nil {
-		panic(err)
+		writeError(w, err)
+		return
 	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func parseTTL(r *http.Request) (time.Duration, error) {
+	value := r.URL.Query().Get("ttl")
+	if value == "" {
+		return 0, nil
+	}
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl < 0 {
+		return 0, fmt.Errorf("invalid ttl: %s", value)
+	}
+	return ttl, nil
+}
+
+// Versions are sent as ETags, ex: "42"
+func parseVersion(etag string) (uint64, error) {
+	version, err := strconv.ParseUint(strings.Trim(strings.TrimPrefix(etag, "W/"), `"`), 10, 64)
+	if err != nil || version == 0 {
+		return 0, fmt.Errorf("invalid version: %s", etag)
+	}
+	return version, nil
+}
+
+func setEntryHeaders(w http.ResponseWriter, entry Entry) {
+	w.Header().Set("ETag", `"`+strconv.FormatUint(entry.Version, 10)+`"`)
+	if !entry.ExpiresAt.IsZero() {
+		w.Header().Set("Expires", entry.ExpiresAt.UTC().Format(http.TimeFormat))
+		w.Header().Set("X-Ttl-Ms", strconv.FormatInt(int64(time.Until(entry.ExpiresAt)/time.Millisecond), 10))
+	}
+}
+
+func writeEntry(w http.ResponseWriter, status int, entry Entry) {
+	setEntryHeaders(w, entry)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.WriteHeader(status)
+	w.Write(entry.Value)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	switch err {
+	case ErrNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case ErrVersionMismatch:
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+	case ErrNotCounter:
+		http.Error(w, err.Error(), http.StatusConflict)
+	case ErrStoreFull:
+		http.Error(w, err.Error(), http.StatusInsufficientStorage)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func methodNotAllowed(w http.ResponseWriter, allowed string) {
+	w.Header().Set("Allow", allowed)
+	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
 }
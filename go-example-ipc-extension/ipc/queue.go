@@ -0,0 +1,269 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package ipc
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	defaultJobTimeout = 10 * time.Second
+	minJobRetryDelay  = 100 * time.Millisecond
+	maxJobRetryDelay  = 5 * time.Second
+)
+
+// ErrQueueFull is returned when the queue cannot accept more jobs
+var ErrQueueFull = errors.New("job queue is full")
+
+// Job is an HTTP request the extension sends in the background, ex: a metric, an audit event or a
+// webhook call
+type Job struct {
+	ID      string            `json:"id"`
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	// Body is sent as is when it is a JSON string, otherwise as JSON
+	Body        json.RawMessage `json:"body"`
+	TimeoutMs   int64           `json:"timeoutMs"`
+	MaxAttempts int             `json:"maxAttempts"`
+
+	// payload is the raw body of jobs queued over gRPC
+	payload  []byte
+	attempts int
+}
+
+func (j *Job) validate(maxAttempts int) error {
+	target, err := url.Parse(j.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return fmt.Errorf("invalid url: %s", j.URL)
+	}
+	if j.Method == "" {
+		j.Method = http.MethodPost
+	}
+	if j.TimeoutMs <= 0 {
+		j.TimeoutMs = int64(defaultJobTimeout / time.Millisecond)
+	}
+	if j.MaxAttempts <= 0 || j.MaxAttempts > maxAttempts {
+		j.MaxAttempts = maxAttempts
+	}
+	return nil
+}
+
+func (j *Job) body() io.Reader {
+	if j.payload != nil {
+		return bytes.NewReader(j.payload)
+	}
+	if len(j.Body) == 0 || string(j.Body) == "null" {
+		return nil
+	}
+	var text string
+	if json.Unmarshal(j.Body, &text) == nil {
+		return bytes.NewBufferString(text)
+	}
+	return bytes.NewReader(j.Body)
+}
+
+// QueueStats are the counters of the queue since the extension started
+type QueueStats struct {
+	Pending   int    `json:"pending"`
+	Succeeded int    `json:"succeeded"`
+	Failed    int    `json:"failed"`
+	Retried   int    `json:"retried"`
+	LastError string `json:"lastError,omitempty"`
+}
+
+// Queue runs jobs in the background with bounded concurrency, and retries the failed ones with
+// backoff. Pending jobs include the running ones and those waiting for a retry
+type Queue struct {
+	jobs        chan *Job
+	workers     int
+	maxAttempts int
+	httpClient  *http.Client
+
+	lock  sync.Mutex
+	stats QueueStats
+	// idle is closed when no job is pending
+	idle chan struct{}
+}
+
+// NewQueue returns a queue holding up to size jobs, run by the given number of workers
+func NewQueue(size int, workers int, maxAttempts int) *Queue {
+	idle := make(chan struct{})
+	close(idle)
+	return &Queue{
+		jobs:        make(chan *Job, size),
+		workers:     workers,
+		maxAttempts: maxAttempts,
+		httpClient:  &http.Client{},
+		idle:        idle,
+	}
+}
+
+// Start runs the workers until ctx is cancelled, the jobs still queued then fail with the error of ctx
+func (q *Queue) Start(ctx context.Context) {
+	for i := 0; i < q.workers; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					q.drain(ctx.Err())
+					return
+				case job := <-q.jobs:
+					q.run(ctx, job)
+				}
+			}
+		}()
+	}
+}
+
+// Fails the queued jobs with err, so that they are no longer pending
+func (q *Queue) drain(err error) {
+	for {
+		select {
+		case <-q.jobs:
+			q.done(err)
+		default:
+			return
+		}
+	}
+}
+
+// Enqueue validates the job and queues it, it returns the ID of the job
+func (q *Queue) Enqueue(job *Job) (string, error) {
+	if err := job.validate(q.maxAttempts); err != nil {
+		return "", err
+	}
+	job.ID = newJobID()
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	select {
+	case q.jobs <- job:
+	default:
+		return "", ErrQueueFull
+	}
+	if q.stats.Pending == 0 {
+		q.idle = make(chan struct{})
+	}
+	q.stats.Pending++
+	return job.ID, nil
+}
+
+// Wait blocks until no job is pending, returns false when ctx is done first
+func (q *Queue) Wait(ctx context.Context) bool {
+	for {
+		q.lock.Lock()
+		idle, pending := q.idle, q.stats.Pending
+		q.lock.Unlock()
+		if pending == 0 {
+			return true
+		}
+		select {
+		case <-idle:
+			// Jobs may have been queued since, checks again
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// Stats returns the counters of the queue
+func (q *Queue) Stats() QueueStats {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.stats
+}
+
+func (q *Queue) run(ctx context.Context, job *Job) {
+	job.attempts++
+	err := q.send(ctx, job)
+	if err != nil && job.attempts < job.MaxAttempts && ctx.Err() == nil {
+		q.lock.Lock()
+		q.stats.Retried++
+		q.lock.Unlock()
+		// The job stays pending, a full queue only delays the retry
+		time.AfterFunc(retryDelay(job.attempts), func() {
+			select {
+			case q.jobs <- job:
+				// The workers may have drained the queue before the job was queued again
+				if ctx.Err() != nil {
+					q.drain(ctx.Err())
+				}
+			case <-ctx.Done():
+				q.done(ctx.Err())
+			}
+		})
+		return
+	}
+	q.done(err)
+}
+
+func (q *Queue) done(err error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if err != nil {
+		q.stats.Failed++
+		q.stats.LastError = err.Error()
+	} else {
+		q.stats.Succeeded++
+	}
+	q.stats.Pending--
+	if q.stats.Pending == 0 {
+		close(q.idle)
+	}
+}
+
+// Sends the request of the job, server errors and throttling are retried, other statuses are not
+func (q *Queue) send(ctx context.Context, job *Job) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(job.TimeoutMs)*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, job.Method, job.URL, job.body())
+	if err != nil {
+		job.attempts = job.MaxAttempts
+		return err
+	}
+	for name, value := range job.Headers {
+		req.Header.Set(name, value)
+	}
+	res, err := q.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, res.Body)
+	if res.StatusCode >= 500 || res.StatusCode == http.StatusTooManyRequests {
+		return fmt.Errorf("job %s: %s %s failed with status %s", job.ID, job.Method, job.URL, res.Status)
+	}
+	if res.StatusCode >= 400 {
+		job.attempts = job.MaxAttempts
+		return fmt.Errorf("job %s: %s %s failed with status %s", job.ID, job.Method, job.URL, res.Status)
+	}
+	return nil
+}
+
+func retryDelay(attempts int) time.Duration {
+	delay := minJobRetryDelay << uint(attempts-1)
+	if delay > maxJobRetryDelay || delay <= 0 {
+		delay = maxJobRetryDelay
+	}
+	return delay
+}
+
+func newJobID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,177 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package ipc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// jobServer answers the jobs with the statuses in order, then with 200, and records when each
+// request was received
+type jobServer struct {
+	lock     sync.Mutex
+	statuses []int
+	received []time.Time
+}
+
+func (s *jobServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.received = append(s.received, time.Now())
+	status := http.StatusOK
+	if len(s.statuses) > 0 {
+		status, s.statuses = s.statuses[0], s.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func (s *jobServer) requests() []time.Time {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]time.Time(nil), s.received...)
+}
+
+// Runs a job against a server answering with the statuses, and returns the stats once it is done
+func runJob(t *testing.T, statuses ...int) (QueueStats, []time.Time) {
+	t.Helper()
+	server := &jobServer{statuses: statuses}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	queue := NewQueue(10, 1, 3)
+	queue.Start(ctx)
+	if _, err := queue.Enqueue(&Job{URL: httpServer.URL}); err != nil {
+		t.Fatal(err)
+	}
+	wait, stop := context.WithTimeout(ctx, 5*time.Second)
+	defer stop()
+	if !queue.Wait(wait) {
+		t.Fatal("job still pending")
+	}
+	return queue.Stats(), server.requests()
+}
+
+func TestQueueRetriesWithBackoff(t *testing.T) {
+	stats, requests := runJob(t, http.StatusInternalServerError, http.StatusTooManyRequests)
+	if len(requests) != 3 || stats.Succeeded != 1 || stats.Retried != 2 || stats.Failed != 0 {
+		t.Fatalf("%d requests and stats %+v, expected 2 retries and a success", len(requests), stats)
+	}
+	for idx, minDelay := range []time.Duration{minJobRetryDelay, 2 * minJobRetryDelay} {
+		if delay := requests[idx+1].Sub(requests[idx]); delay < minDelay {
+			t.Fatalf("retry %d after %v, expected at least %v", idx+1, delay, minDelay)
+		}
+	}
+}
+
+func TestQueueGivesUpAfterMaxAttempts(t *testing.T) {
+	stats, requests := runJob(t, http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway)
+	if len(requests) != 3 || stats.Failed != 1 || stats.LastError == "" {
+		t.Fatalf("%d requests and stats %+v, expected a failure after 3 attempts", len(requests), stats)
+	}
+}
+
+func TestQueueDoesNotRetryClientErrors(t *testing.T) {
+	for _, status := range []int{http.StatusBadRequest, http.StatusNotFound} {
+		stats, requests := runJob(t, status)
+		if len(requests) != 1 || stats.Failed != 1 || stats.Retried != 0 {
+			t.Fatalf("status %d: %d requests and stats %+v, expected a failure without retry", status, len(requests), stats)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	for attempts, expected := range map[int]time.Duration{
+		1:  minJobRetryDelay,
+		2:  2 * minJobRetryDelay,
+		4:  8 * minJobRetryDelay,
+		10: maxJobRetryDelay,
+		80: maxJobRetryDelay,
+	} {
+		if delay := retryDelay(attempts); delay != expected {
+			t.Errorf("retry after %d attempts in %v, expected %v", attempts, delay, expected)
+		}
+	}
+}
+
+func TestQueueFull(t *testing.T) {
+	queue := NewQueue(1, 1, 3)
+	if _, err := queue.Enqueue(&Job{URL: "http://localhost/"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := queue.Enqueue(&Job{URL: "http://localhost/"}); err != ErrQueueFull {
+		t.Fatalf("queued a job in a full queue: %v", err)
+	}
+	if stats := queue.Stats(); stats.Pending != 1 {
+		t.Fatalf("%d jobs pending, expected the rejected job not to count", stats.Pending)
+	}
+	if _, err := queue.Enqueue(&Job{URL: "ftp://localhost/"}); err == nil {
+		t.Fatal("queued a job with an invalid url")
+	}
+}
+
+func TestQueueWait(t *testing.T) {
+	queue := NewQueue(10, 1, 3)
+	if !queue.Wait(context.Background()) {
+		t.Fatal("empty queue is not idle")
+	}
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	queue.Enqueue(&Job{URL: server.URL})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	queue.Start(ctx)
+
+	short, stop := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer stop()
+	if queue.Wait(short) {
+		t.Fatal("queue idle while a job runs")
+	}
+	close(release)
+	wait, stopWait := context.WithTimeout(ctx, 5*time.Second)
+	defer stopWait()
+	if !queue.Wait(wait) || queue.Stats().Succeeded != 1 {
+		t.Fatalf("queue not idle once the job is done: %+v", queue.Stats())
+	}
+}
+
+func TestQueueFailsQueuedJobsOnCancel(t *testing.T) {
+	started := make(chan struct{}, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	queue := NewQueue(10, 1, 3)
+	ctx, cancel := context.WithCancel(context.Background())
+	queue.Start(ctx)
+	for i := 0; i < 5; i++ {
+		if _, err := queue.Enqueue(&Job{URL: server.URL}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The single worker runs the first job, the others stay queued
+	<-started
+	cancel()
+
+	wait, stop := context.WithTimeout(context.Background(), 5*time.Second)
+	defer stop()
+	if !queue.Wait(wait) {
+		t.Fatalf("jobs still pending after the cancellation: %+v", queue.Stats())
+	}
+	if stats := queue.Stats(); stats.Failed != 5 || stats.Succeeded != 0 || stats.Pending != 0 {
+		t.Fatalf("stats %+v, expected every job to fail", stats)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package ipc
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// snapshot is the content of the snapshot file
+type snapshot struct {
+	Version uint64            `json:"version"`
+	Entries map[string]*Entry `json:"entries"`
+}
+
+// LoadSnapshot restores the store from the snapshot file, expired keys are dropped. A missing file
+// leaves the store empty. Every key is restored even past the limits of the store, ex: when they were
+// lowered, writes are rejected until keys are deleted or expire
+func (s *Store) LoadSnapshot(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var saved snapshot
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	now := time.Now()
+	for key, entry := range saved.Entries {
+		if entry != nil && !entry.expired(now) {
+			s.remove(key)
+			s.entries[key] = entry
+			s.size += entrySize(key, entry)
+		}
+	}
+	if saved.Version > s.version {
+		s.version = saved.Version
+	}
+	return nil
+}
+
+// SaveSnapshot writes the store to a temporary file renamed over the snapshot file, so that it is
+// never partial. Returns false without writing when nothing changed since the last snapshot
+func (s *Store) SaveSnapshot(path string) (bool, error) {
+	s.saveLock.Lock()
+	defer s.saveLock.Unlock()
+
+	s.lock.Lock()
+	if s.changes == s.saved {
+		s.lock.Unlock()
+		return false, nil
+	}
+	changes := s.changes
+	now := time.Now()
+	saved := snapshot{Version: s.version, Entries: make(map[string]*Entry, len(s.entries))}
+	for key, entry := range s.entries {
+		if !entry.expired(now) {
+			copied := *entry
+			saved.Entries[key] = &copied
+		}
+	}
+	s.lock.Unlock()
+
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return false, err
+	}
+	temporary, err := ioutil.TempFile(filepath.Dir(path), ".ipc-snapshot-")
+	if err != nil {
+		return false, err
+	}
+	if _, err := temporary.Write(data); err != nil {
+		temporary.Close()
+		os.Remove(temporary.Name())
+		return false, err
+	}
+	if err := temporary.Close(); err != nil {
+		os.Remove(temporary.Name())
+		return false, err
+	}
+	if err := os.Rename(temporary.Name(), path); err != nil {
+		os.Remove(temporary.Name())
+		return false, err
+	}
+
+	s.lock.Lock()
+	s.saved = changes
+	s.lock.Unlock()
+	return true, nil
+}
@@ -0,0 +1,273 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package ipc
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned for missing or expired keys
+	ErrNotFound = errors.New("key not found")
+	// ErrVersionMismatch is returned when a compare-and-set does not match the current version
+	ErrVersionMismatch = errors.New("version mismatch")
+	// ErrNotCounter is returned when incrementing a value that is not an integer
+	ErrNotCounter = errors.New("value is not an integer")
+	// ErrStoreFull is returned when a write would exceed the maximum keys or bytes of the store
+	ErrStoreFull = errors.New("store is full")
+)
+
+// Entry is a value of the store. Version changes on every write, ExpiresAt is zero for keys without TTL
+type Entry struct {
+	Value     []byte    `json:"value"`
+	Version   uint64    `json:"version"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+func (e *Entry) expired(now time.Time) bool {
+	return !e.ExpiresAt.IsZero() && !now.Before(e.ExpiresAt)
+}
+
+// Store is a key-value store kept in the extension memory, so that it persists across the warm
+// invocations of the execution environment. Expired keys are removed lazily and by Purge. The keys
+// and the bytes of keys and values are limited, since the store shares the memory of the function
+type Store struct {
+	lock    sync.Mutex
+	entries map[string]*Entry
+	// size is the bytes of the keys and values, bounded by maxBytes
+	size       int64
+	maxEntries int
+	maxBytes   int64
+	// version is the last version assigned, versions are unique across keys
+	version uint64
+	// changes counts the writes, saved is the count at the last snapshot
+	changes uint64
+	saved   uint64
+	// saveLock serializes the snapshots
+	saveLock sync.Mutex
+}
+
+// NewStore returns an empty store holding up to maxEntries keys and maxBytes bytes of keys and values
+func NewStore(maxEntries int, maxBytes int64) *Store {
+	return &Store{entries: make(map[string]*Entry), maxEntries: maxEntries, maxBytes: maxBytes}
+}
+
+// Get returns the entry of the key
+func (s *Store) Get(key string) (Entry, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	entry, ok := s.live(key)
+	if !ok {
+		return Entry{}, ErrNotFound
+	}
+	return *entry, nil
+}
+
+// Set writes the value, a zero ttl keeps it until deleted. Returns ErrStoreFull when the store has
+// no room for it
+func (s *Store) Set(key string, value []byte, ttl time.Duration) (Entry, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.write(key, value, ttl)
+}
+
+// CompareAndSet writes the value only when the key is at the given version. Version 0 expects the
+// key not to exist
+func (s *Store) CompareAndSet(key string, value []byte, version uint64, ttl time.Duration) (Entry, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if current := s.currentVersion(key); current != version {
+		return Entry{}, ErrVersionMismatch
+	}
+	return s.write(key, value, ttl)
+}
+
+// Delete removes the key, returns ErrNotFound when it did not exist
+func (s *Store) Delete(key string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.live(key); !ok {
+		return ErrNotFound
+	}
+	s.remove(key)
+	s.changes++
+	return nil
+}
+
+// CompareAndDelete removes the key only when it is at the given version
+func (s *Store) CompareAndDelete(key string, version uint64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	current := s.currentVersion(key)
+	if current == 0 {
+		return ErrNotFound
+	}
+	if current != version {
+		return ErrVersionMismatch
+	}
+	s.remove(key)
+	s.changes++
+	return nil
+}
+
+// Increment atomically adds delta to the integer value of the key and returns the new value.
+// Missing keys start at 0 and get the ttl, existing counters keep their expiration, so that
+// counters can implement fixed windows, ex: rate limits
+func (s *Store) Increment(key string, delta int64, ttl time.Duration) (int64, Entry, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var counter int64
+	entry, ok := s.live(key)
+	if ok {
+		var err error
+		if counter, err = strconv.ParseInt(string(entry.Value), 10, 64); err != nil {
+			return 0, Entry{}, ErrNotCounter
+		}
+		if !entry.ExpiresAt.IsZero() {
+			ttl = time.Until(entry.ExpiresAt)
+		} else {
+			ttl = 0
+		}
+	}
+	counter += delta
+	written, err := s.write(key, []byte(strconv.FormatInt(counter, 10)), ttl)
+	if err != nil {
+		return 0, Entry{}, err
+	}
+	if ok {
+		// Keeps the exact expiration, time.Until loses precision
+		s.entries[key].ExpiresAt = entry.ExpiresAt
+		written.ExpiresAt = entry.ExpiresAt
+	}
+	return counter, written, nil
+}
+
+// Touch resets the TTL of the key, ex: to extend a session on activity. A zero ttl removes the
+// expiration, the key is then kept until deleted
+func (s *Store) Touch(key string, ttl time.Duration) (Entry, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	entry, ok := s.live(key)
+	if !ok {
+		return Entry{}, ErrNotFound
+	}
+	entry.ExpiresAt = expiration(ttl)
+	s.changes++
+	return *entry, nil
+}
+
+// Keys returns the live keys starting with the prefix, sorted
+func (s *Store) Keys(prefix string) []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	now := time.Now()
+	keys := []string{}
+	for key, entry := range s.entries {
+		if strings.HasPrefix(key, prefix) && !entry.expired(now) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Purge removes the expired keys and returns how many were removed
+func (s *Store) Purge() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	count := s.purge()
+	if count > 0 {
+		s.changes++
+	}
+	return count
+}
+
+// Removes the expired keys and returns how many were removed. Expects the lock to be held
+func (s *Store) purge() int {
+	now := time.Now()
+	count := 0
+	for key, entry := range s.entries {
+		if entry.expired(now) {
+			s.remove(key)
+			count++
+		}
+	}
+	return count
+}
+
+// Returns the entry when it exists and has not expired, expired entries are removed. Expects the
+// lock to be held
+func (s *Store) live(key string) (*Entry, bool) {
+	entry, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if entry.expired(time.Now()) {
+		s.remove(key)
+		return nil, false
+	}
+	return entry, true
+}
+
+func (s *Store) currentVersion(key string) uint64 {
+	if entry, ok := s.live(key); ok {
+		return entry.Version
+	}
+	return 0
+}
+
+// Writes the value unless the store would exceed its limits once the expired keys are removed.
+// Expects the lock to be held
+func (s *Store) write(key string, value []byte, ttl time.Duration) (Entry, error) {
+	if !s.fits(key, value) {
+		if s.purge() > 0 {
+			s.changes++
+		}
+		if !s.fits(key, value) {
+			return Entry{}, ErrStoreFull
+		}
+	}
+	s.remove(key)
+	s.version++
+	s.changes++
+	entry := &Entry{Value: append([]byte(nil), value...), Version: s.version, ExpiresAt: expiration(ttl)}
+	s.entries[key] = entry
+	s.size += entrySize(key, entry)
+	return *entry, nil
+}
+
+// Tells if the value can replace the current value of the key within the limits
+func (s *Store) fits(key string, value []byte) bool {
+	entries, size := len(s.entries), s.size+int64(len(key)+len(value))
+	if entry, ok := s.entries[key]; ok {
+		entries--
+		size -= entrySize(key, entry)
+	}
+	return entries < s.maxEntries && size <= s.maxBytes
+}
+
+// Removes the key and its bytes. Expects the lock to be held
+func (s *Store) remove(key string) {
+	if entry, ok := s.entries[key]; ok {
+		s.size -= entrySize(key, entry)
+		delete(s.entries, key)
+	}
+}
+
+func entrySize(key string, entry *Entry) int64 {
+	return int64(len(key) + len(entry.Value))
+}
+
+func expiration(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
@@ -0,0 +1,229 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package ipc
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCompareAndSet(t *testing.T) {
+	store := NewStore(10, 1024)
+	// Version 0 creates the key only when it does not exist
+	first, err := store.CompareAndSet("lock", []byte("a"), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.CompareAndSet("lock", []byte("b"), 0, 0); err != ErrVersionMismatch {
+		t.Fatalf("created an existing key: %v", err)
+	}
+
+	second, err := store.CompareAndSet("lock", []byte("b"), first.Version, 0)
+	if err != nil || second.Version <= first.Version {
+		t.Fatalf("set at the current version returned %+v, %v", second, err)
+	}
+	if _, err := store.CompareAndSet("lock", []byte("c"), first.Version, 0); err != ErrVersionMismatch {
+		t.Fatalf("set at a previous version returned %v", err)
+	}
+	if entry, _ := store.Get("lock"); string(entry.Value) != "b" {
+		t.Fatalf("value %s, expected the last successful set", entry.Value)
+	}
+
+	// Versions are unique across keys, a version of another key never matches
+	other, _ := store.Set("other", []byte("x"), 0)
+	if _, err := store.CompareAndSet("lock", []byte("d"), other.Version, 0); err != ErrVersionMismatch {
+		t.Fatalf("set at the version of another key returned %v", err)
+	}
+}
+
+func TestCompareAndDelete(t *testing.T) {
+	store := NewStore(10, 1024)
+	if err := store.CompareAndDelete("lock", 1); err != ErrNotFound {
+		t.Fatalf("deleted a missing key: %v", err)
+	}
+	entry, _ := store.Set("lock", []byte("a"), 0)
+	if err := store.CompareAndDelete("lock", entry.Version+1); err != ErrVersionMismatch {
+		t.Fatalf("deleted at another version: %v", err)
+	}
+	if err := store.CompareAndDelete("lock", entry.Version); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get("lock"); err != ErrNotFound {
+		t.Fatalf("deleted key still found: %v", err)
+	}
+}
+
+func TestIncrement(t *testing.T) {
+	store := NewStore(10, 1024)
+	count, first, err := store.Increment("requests", 1, time.Minute)
+	if err != nil || count != 1 {
+		t.Fatalf("first increment returned %d, %v", count, err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	// The counter keeps the expiration of its window, whatever the ttl of the next increments
+	count, second, err := store.Increment("requests", 5, time.Hour)
+	if err != nil || count != 6 {
+		t.Fatalf("second increment returned %d, %v", count, err)
+	}
+	if !second.ExpiresAt.Equal(first.ExpiresAt) {
+		t.Fatalf("counter expires at %v, expected the original %v", second.ExpiresAt, first.ExpiresAt)
+	}
+	if entry, _ := store.Get("requests"); !entry.ExpiresAt.Equal(first.ExpiresAt) || string(entry.Value) != "6" {
+		t.Fatalf("stored counter %s expires at %v", entry.Value, entry.ExpiresAt)
+	}
+
+	// Counters without expiration keep none
+	store.Increment("total", 1, 0)
+	if _, entry, _ := store.Increment("total", 1, time.Minute); !entry.ExpiresAt.IsZero() {
+		t.Fatalf("counter without TTL got an expiration %v", entry.ExpiresAt)
+	}
+
+	store.Set("name", []byte("orders"), 0)
+	if _, _, err := store.Increment("name", 1, 0); err != ErrNotCounter {
+		t.Fatalf("incremented a string: %v", err)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	store := NewStore(10, 1024)
+	store.Set("short", []byte("a"), 20*time.Millisecond)
+	store.Set("long", []byte("b"), time.Hour)
+	store.Set("forever", []byte("c"), 0)
+	time.Sleep(30 * time.Millisecond)
+
+	if _, err := store.Get("short"); err != ErrNotFound {
+		t.Fatalf("expired key still found: %v", err)
+	}
+	if keys := store.Keys(""); !reflect.DeepEqual(keys, []string{"forever", "long"}) {
+		t.Fatalf("keys %v, expected the live ones", keys)
+	}
+	if _, err := store.Touch("short", time.Hour); err != ErrNotFound {
+		t.Fatalf("touched an expired key: %v", err)
+	}
+
+	// A zero ttl removes the expiration of the key, not the key
+	entry, err := store.Touch("long", 0)
+	if err != nil || !entry.ExpiresAt.IsZero() {
+		t.Fatalf("touch without TTL returned %+v, %v", entry, err)
+	}
+	if entry, err := store.Get("long"); err != nil || !entry.ExpiresAt.IsZero() {
+		t.Fatalf("touched key %+v, %v, expected it without expiration", entry, err)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	store := NewStore(10, 1024)
+	store.Set("a", []byte("1"), 10*time.Millisecond)
+	store.Set("b", []byte("2"), 10*time.Millisecond)
+	store.Set("c", []byte("3"), 0)
+	time.Sleep(20 * time.Millisecond)
+
+	if count := store.Purge(); count != 2 {
+		t.Fatalf("purged %d keys, expected 2", count)
+	}
+	if count := store.Purge(); count != 0 {
+		t.Fatalf("purged %d keys again", count)
+	}
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	if len(store.entries) != 1 || store.size != 2 {
+		t.Fatalf("%d keys of %d bytes left, expected c only", len(store.entries), store.size)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	t.Run("max entries", func(t *testing.T) {
+		store := NewStore(2, 1024)
+		store.Set("a", []byte("1"), 0)
+		store.Set("b", []byte("2"), 0)
+		if _, err := store.Set("c", []byte("3"), 0); err != ErrStoreFull {
+			t.Fatalf("set a third key: %v", err)
+		}
+		// Existing keys can still be replaced
+		if _, err := store.Set("a", []byte("4"), 0); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := store.Increment("c", 1, 0); err != ErrStoreFull {
+			t.Fatalf("created a counter in a full store: %v", err)
+		}
+	})
+
+	t.Run("max bytes", func(t *testing.T) {
+		store := NewStore(10, 10)
+		if _, err := store.Set("key", []byte("1234567"), 0); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.Set("k", []byte("1"), 0); err != ErrStoreFull {
+			t.Fatalf("exceeded the max bytes: %v", err)
+		}
+		// The bytes of the replaced value are released
+		if _, err := store.Set("key", []byte("12"), 0); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.Set("k", []byte("1"), 0); err != nil {
+			t.Fatalf("cannot use the released bytes: %v", err)
+		}
+	})
+
+	t.Run("expired keys are purged when full", func(t *testing.T) {
+		store := NewStore(2, 1024)
+		store.Set("a", []byte("1"), 10*time.Millisecond)
+		store.Set("b", []byte("2"), 0)
+		time.Sleep(20 * time.Millisecond)
+		if _, err := store.Set("c", []byte("3"), 0); err != nil {
+			t.Fatalf("expired key was not purged to make room: %v", err)
+		}
+		// Still full once purged
+		if _, err := store.Set("d", []byte("4"), 0); err != ErrStoreFull {
+			t.Fatalf("set a third live key: %v", err)
+		}
+	})
+}
+
+func TestSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	store := NewStore(10, 1024)
+	store.Set("config", []byte(`{"a":1}`), 0)
+	store.Set("session", []byte("s"), time.Hour)
+	store.Set("expiring", []byte("e"), 50*time.Millisecond)
+	last, _ := store.Set("counter", []byte("1"), 0)
+
+	if saved, err := store.SaveSnapshot(path); !saved || err != nil {
+		t.Fatalf("snapshot returned %v, %v", saved, err)
+	}
+	if saved, _ := store.SaveSnapshot(path); saved {
+		t.Fatal("snapshot written again without changes")
+	}
+	time.Sleep(60 * time.Millisecond)
+
+	restored := NewStore(10, 1024)
+	if err := restored.LoadSnapshot(path); err != nil {
+		t.Fatal(err)
+	}
+	if keys := restored.Keys(""); !reflect.DeepEqual(keys, []string{"config", "counter", "session"}) {
+		t.Fatalf("restored keys %v, expected the expired key to be dropped", keys)
+	}
+	original, _ := store.Get("session")
+	if entry, _ := restored.Get("session"); !entry.ExpiresAt.Equal(original.ExpiresAt) || entry.Version != original.Version {
+		t.Fatalf("restored %+v, expected %+v", entry, original)
+	}
+	// New versions follow the restored ones, so that clients never see a version twice
+	if entry, _ := restored.Set("new", []byte("n"), 0); entry.Version <= last.Version {
+		t.Fatalf("new key got version %d, expected more than %d", entry.Version, last.Version)
+	}
+
+	// A missing snapshot leaves the store empty
+	if err := NewStore(10, 1024).LoadSnapshot(filepath.Join(t.TempDir(), "missing.json")); err != nil {
+		t.Fatal(err)
+	}
+	var saved snapshot
+	data, _ := os.ReadFile(path)
+	if err := json.Unmarshal(data, &saved); err != nil || saved.Version != last.Version {
+		t.Fatalf("snapshot version %d, %v, expected %d", saved.Version, err, last.Version)
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package logsapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+)
+
+const (
+	extensionIdentiferHeader = "Lambda-Extension-Identifier"
+	schemaVersion            = "2021-03-18"
+
+	// Completed invocations remembered, for the events that come before the extension waits
+	maxCompleted = 100
+)
+
+// RuntimeDone tracks the invocations the runtime responded to, from the platform events of the
+// Logs API. The extension keeps running after the response and until it asks for the next event,
+// so it knows when work can run without delaying the response
+type RuntimeDone struct {
+	lock sync.Mutex
+	// Channels of the invocations waited for, closed when the runtime is done
+	waiting map[string]chan struct{}
+	// Completed invocations, the oldest are forgotten first. Waited invocations are never dropped,
+	// they are in waiting
+	completed map[string]bool
+	order     []string
+}
+
+// NewRuntimeDone returns an empty tracker
+func NewRuntimeDone() *RuntimeDone {
+	return &RuntimeDone{waiting: make(map[string]chan struct{}), completed: make(map[string]bool)}
+}
+
+// Wait blocks until the runtime responded to the invocation, returns false when ctx is done first
+func (d *RuntimeDone) Wait(ctx context.Context, requestID string) bool {
+	d.lock.Lock()
+	if d.completed[requestID] {
+		d.lock.Unlock()
+		return true
+	}
+	done, ok := d.waiting[requestID]
+	if !ok {
+		done = make(chan struct{})
+		d.waiting[requestID] = done
+	}
+	d.lock.Unlock()
+
+	defer func() {
+		d.lock.Lock()
+		if d.waiting[requestID] == done {
+			delete(d.waiting, requestID)
+		}
+		d.lock.Unlock()
+	}()
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Marks the invocation completed, both platform.end and platform.runtimeDone are sent for the same
+// invocation, the second one is ignored
+func (d *RuntimeDone) complete(requestID string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.completed[requestID] {
+		return
+	}
+	if done, ok := d.waiting[requestID]; ok {
+		close(done)
+		delete(d.waiting, requestID)
+	}
+	d.completed[requestID] = true
+	d.order = append(d.order, requestID)
+	if len(d.order) > maxCompleted {
+		delete(d.completed, d.order[0])
+		d.order = d.order[1:]
+	}
+}
+
+// logEvent is an item of the batches posted by the Logs API
+type logEvent struct {
+	Type   string `json:"type"`
+	Record struct {
+		RequestID string `json:"requestId"`
+	} `json:"record"`
+}
+
+// ServeHTTP receives the batches posted by the Logs API. Nothing is printed here, printed lines
+// would be sent back as extension logs
+func (d *RuntimeDone) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var events []json.RawMessage
+	if err := json.Unmarshal(body, &events); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	for _, raw := range events {
+		// Records of other platform events may not be objects
+		var event logEvent
+		if json.Unmarshal(raw, &event) != nil {
+			continue
+		}
+		if (event.Type == "platform.end" || event.Type == "platform.runtimeDone") && event.Record.RequestID != "" {
+			d.complete(event.Record.RequestID)
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Subscribe starts listening on the port and subscribes to the platform events
+func (d *RuntimeDone) Subscribe(runtimeAPI string, extensionID string, port int) error {
+	address := fmt.Sprintf("sandbox.localdomain:%d", port)
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	go http.Serve(listener, d)
+
+	body, err := json.Marshal(map[string]interface{}{
+		"schemaVersion": schemaVersion,
+		"types":         []string{"platform"},
+		// The smallest timeout, the events are waited for after each invocation
+		"buffering":   map[string]int{"maxItems": 1000, "maxBytes": 262144, "timeoutMs": 25},
+		"destination": map[string]string{"protocol": "HTTP", "URI": "http://" + address, "method": "POST", "encoding": "JSON"},
+	})
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("http://%s/2020-08-15/logs", runtimeAPI)
+	req, err := http.NewRequest("PUT", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(extensionIdentiferHeader, extensionID)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("request failed with status %s %s", res.Status, string(message))
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package logsapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func postEvents(t *testing.T, d *RuntimeDone, body string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	d.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d", w.Code)
+	}
+}
+
+func waitFor(d *RuntimeDone, requestID string, timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return d.Wait(ctx, requestID)
+}
+
+func TestWaitReturnsWhenRuntimeIsDone(t *testing.T) {
+	d := NewRuntimeDone()
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		postEvents(t, d, `[{"type":"platform.start","record":{"requestId":"a"}},{"type":"platform.logsSubscription","record":"x"},{"type":"platform.runtimeDone","record":{"requestId":"a"}}]`)
+	}()
+	if !waitFor(d, "a", time.Second) {
+		t.Fatal("Wait did not return when the runtime was done")
+	}
+	if waitFor(d, "b", 20*time.Millisecond) {
+		t.Fatal("Wait returned for an invocation that is not done")
+	}
+}
+
+func TestWaitReturnsWhenEventComesFirst(t *testing.T) {
+	d := NewRuntimeDone()
+	postEvents(t, d, `[{"type":"platform.end","record":{"requestId":"a"}}]`)
+	if !waitFor(d, "a", 20*time.Millisecond) {
+		t.Fatal("Wait did not return for an invocation completed before")
+	}
+}
+
+// platform.end comes after platform.runtimeDone, once Wait returned. The late events must never
+// drop the channel of an invocation being waited for
+func TestLateEventsDoNotDropWaiters(t *testing.T) {
+	d := NewRuntimeDone()
+	for i := 0; i < 3*maxCompleted; i++ {
+		requestID := fmt.Sprintf("request-%d", i)
+		waited := make(chan bool)
+		go func() { waited <- waitFor(d, requestID, time.Second) }()
+		// Waits for the waiter to register
+		for {
+			d.lock.Lock()
+			_, ok := d.waiting[requestID]
+			d.lock.Unlock()
+			if ok {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		postEvents(t, d, fmt.Sprintf(`[{"type":"platform.runtimeDone","record":{"requestId":"%s"}}]`, requestID))
+		if !<-waited {
+			t.Fatalf("Wait of %s did not return", requestID)
+		}
+		postEvents(t, d, fmt.Sprintf(`[{"type":"platform.end","record":{"requestId":"%s"}}]`, requestID))
+	}
+	if len(d.completed) > maxCompleted || len(d.order) > maxCompleted || len(d.waiting) != 0 {
+		t.Fatalf("tracker not bounded: %d completed, %d waiting", len(d.completed), len(d.waiting))
+	}
+}
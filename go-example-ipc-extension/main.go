@@ -10,16 +10,33 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
 	"syscall"
+	"time"
 
 	"aws-lambda-extensions/go-example-ipc-extension/extension"
 	"aws-lambda-extensions/go-example-ipc-extension/ipc"
+	"aws-lambda-extensions/go-example-ipc-extension/logsapi"
+	"aws-lambda-extensions/go-example-ipc-transport/transport"
 )
 
 var (
 	extensionName   = filepath.Base(os.Args[0]) // extension name has to match the filename
 	extensionClient = extension.NewClient(os.Getenv("AWS_LAMBDA_RUNTIME_API"))
 	printPrefix     = fmt.Sprintf("[%s]", extensionName)
+	store           = ipc.NewStore(getIntFromEnv("EXTENSION_STORE_MAX_KEYS", 10000), int64(getIntFromEnv("EXTENSION_STORE_MAX_BYTES", 64<<20)))
+	snapshotFile    = os.Getenv("EXTENSION_SNAPSHOT_FILE")
+	queue           = ipc.NewQueue(getIntFromEnv("EXTENSION_JOB_QUEUE_SIZE", 1000), getIntFromEnv("EXTENSION_JOB_WORKERS", 4), getIntFromEnv("EXTENSION_JOB_ATTEMPTS", 3))
+	runtimeDone     = logsapi.NewRuntimeDone()
+	// Port receiving the platform events of the Logs API, other extensions of the function must not use it
+	logsPort = getIntFromEnv("EXTENSION_LOGS_PORT", 4244)
+)
+
+const (
+	// Interval of the snapshots and of the removal of expired keys, while the environment is not frozen
+	snapshotInterval = time.Second
+	// Time kept before the deadline of an event to ask for the next one
+	deadlineMargin = 100 * time.Millisecond
 )
 
 func main() {
@@ -45,10 +62,110 @@ func main() {
 		port = "2772"
 	}
 
-	ipc.Start(port)
+	socketPath := os.Getenv("EXTENSION_SOCKET_PATH")
+	if len(socketPath) == 0 {
+		socketPath = "/tmp/ipc-extension.sock"
+	}
+
+	grpcSocketPath := os.Getenv("EXTENSION_GRPC_SOCKET_PATH")
+	if len(grpcSocketPath) == 0 {
+		grpcSocketPath = "/tmp/ipc-extension.grpc.sock"
+	}
+
+	if snapshotFile != "" {
+		if err := store.LoadSnapshot(snapshotFile); err != nil {
+			println(printPrefix, "Ignoring invalid snapshot", snapshotFile, err.Error())
+		}
+		go saveSnapshots(ctx)
+	}
+
+	// Without the platform events, the jobs queued when asking for the next event run after the
+	// freeze, at the next invocation
+	if err := runtimeDone.Subscribe(os.Getenv("AWS_LAMBDA_RUNTIME_API"), extensionClient.ExtensionID(), logsPort); err != nil {
+		println(printPrefix, "Cannot subscribe to the platform events", err.Error())
+		runtimeDone = nil
+	}
+
+	tokenFile := os.Getenv("EXTENSION_TOKEN_FILE")
+	if len(tokenFile) == 0 {
+		tokenFile = "/tmp/ipc-extension.token"
+	}
+	// The token of the environment is written before serving, so that the function finds it as soon
+	// as the extension is ready
+	auth := transport.NewAuthenticator()
+	if _, err := auth.Issue("default", tokenFile); err != nil {
+		panic(err)
+	}
+
+	queue.Start(ctx)
+	server, err := ipc.Start(store, queue, transport.Config{
+		// port 8080 is used by the Lambda Invoke API
+		HTTPAddress: "sandbox.localdomain:" + port,
+		HTTPSocket:  socketPath,
+		GRPCSocket:  grpcSocketPath,
+		Auth:        auth,
+	})
+	if err != nil {
+		panic(err)
+	}
+	println(printPrefix, "Serving HTTP on port", port, "and socket", socketPath, "and gRPC on socket", grpcSocketPath)
 
 	// Will block until shutdown event is received or cancelled via the context.
 	processEvents(ctx)
+	saveSnapshot()
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), deadlineMargin)
+	defer cancelShutdown()
+	server.Shutdown(shutdownCtx)
+}
+
+// Waits for the runtime to respond to the invocation, then for the queued jobs to complete, so that
+// the environment is not frozen while jobs run. Gives up before the deadline of the event, pending
+// jobs then resume at the next invocation
+func drainQueue(ctx context.Context, res *extension.NextEventResponse) {
+	deadline := time.Unix(0, res.DeadlineMs*int64(time.Millisecond)).Add(-deadlineMargin)
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+
+	before := queue.Stats()
+	if res.EventType == extension.Invoke && runtimeDone != nil {
+		if !runtimeDone.Wait(ctx, res.RequestID) {
+			println(printPrefix, "Runtime not done before the deadline of", res.RequestID)
+			return
+		}
+	}
+	drained := queue.Wait(ctx)
+
+	after := queue.Stats()
+	if after.Failed > before.Failed {
+		println(printPrefix, after.Failed-before.Failed, "jobs failed, last error:", after.LastError)
+	}
+	if !drained {
+		println(printPrefix, after.Pending, "jobs still pending at the deadline")
+	}
+}
+
+// Removes the expired keys and snapshots the store when it changed, until ctx is cancelled
+func saveSnapshots(ctx context.Context) {
+	ticker := time.NewTicker(snapshotInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			store.Purge()
+			saveSnapshot()
+		}
+	}
+}
+
+func saveSnapshot() {
+	if snapshotFile == "" {
+		return
+	}
+	if _, err := store.SaveSnapshot(snapshotFile); err != nil {
+		println(printPrefix, "Cannot save snapshot", snapshotFile, err.Error())
+	}
 }
 
 func processEvents(ctx context.Context) {
@@ -66,6 +183,7 @@ func processEvents(ctx context.Context) {
 			}
 
 			println(printPrefix, "Received event:", prettyPrint(res))
+			drainQueue(ctx, res)
 			// Exit if we receive a SHUTDOWN event
 			if res.EventType == extension.Shutdown {
 				println(printPrefix, "Received SHUTDOWN event")
@@ -76,6 +194,19 @@ func processEvents(ctx context.Context) {
 	}
 }
 
+// Returns the integer value of the environment variable, or the default value when it is not set
+func getIntFromEnv(name string, defaultValue int) int {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return defaultValue
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil || number <= 0 {
+		panic(fmt.Sprintf("invalid %s: %s", name, value))
+	}
+	return number
+}
+
 func prettyPrint(v interface{}) string {
 	data, err := json.MarshalIndent(v, "", "\t")
 	if err != nil {
@@ -0,0 +1,153 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package transport
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// TokenHeader is the HTTP header of the token, it is also the gRPC metadata key in lower case
+	TokenHeader   = "X-Extension-Token"
+	tokenMetadata = "x-extension-token"
+	tokenBytes    = 32
+)
+
+type tokenNameKey struct{}
+
+// Authenticator issues the tokens of the execution environment and rejects the requests without a
+// valid one. Tokens are named, so that servers can grant different access to each token
+type Authenticator struct {
+	lock sync.RWMutex
+	// Tokens by name
+	tokens map[string]string
+}
+
+// NewAuthenticator returns an authenticator without tokens, that rejects every request
+func NewAuthenticator() *Authenticator {
+	return &Authenticator{tokens: make(map[string]string)}
+}
+
+// Issue generates a random token for the name, replacing its previous token, and writes it to the
+// file with the 0600 mode, so that only the user of the function can read it
+func (a *Authenticator) Issue(name string, path string) (string, error) {
+	random := make([]byte, tokenBytes)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(random)
+	if err := writeTokenFile(path, token); err != nil {
+		return "", err
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.tokens[name] = token
+	return token, nil
+}
+
+// Revoke removes the token of the name
+func (a *Authenticator) Revoke(name string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	delete(a.tokens, name)
+}
+
+// Authenticate returns the name of the token, every token is compared in constant time
+func (a *Authenticator) Authenticate(token string) (string, bool) {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	found := ""
+	for name, candidate := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(candidate), []byte(token)) == 1 {
+			found = name
+		}
+	}
+	return found, found != "" && token != ""
+}
+
+// Middleware rejects the HTTP requests without a valid token with 401, the name of the token is
+// added to the context of the others
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, ok := a.Authenticate(r.Header.Get(TokenHeader))
+		if !ok {
+			http.Error(w, "missing or invalid "+TokenHeader+" header", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tokenNameKey{}, name)))
+	})
+}
+
+// UnaryInterceptor rejects the gRPC calls without a valid token with UNAUTHENTICATED, the name of
+// the token is added to the context of the others
+func (a *Authenticator) UnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := a.authenticateCall(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// StreamInterceptor is the UnaryInterceptor of streaming calls
+func (a *Authenticator) StreamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if _, err := a.authenticateCall(stream.Context()); err != nil {
+		return err
+	}
+	return handler(srv, stream)
+}
+
+func (a *Authenticator) authenticateCall(ctx context.Context) (context.Context, error) {
+	token := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get(tokenMetadata)) > 0 {
+		token = md.Get(tokenMetadata)[0]
+	}
+	name, ok := a.Authenticate(token)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "missing or invalid "+tokenMetadata+" metadata")
+	}
+	return context.WithValue(ctx, tokenNameKey{}, name), nil
+}
+
+// TokenName returns the name of the token of an authenticated request
+func TokenName(ctx context.Context) (string, bool) {
+	name, ok := ctx.Value(tokenNameKey{}).(string)
+	return name, ok
+}
+
+// Writes the token to a temporary file renamed over the token file, so that it is never partial.
+// Temporary files are created with the 0600 mode
+func writeTokenFile(path string, token string) error {
+	temporary, err := ioutil.TempFile(filepath.Dir(path), ".token-")
+	if err != nil {
+		return err
+	}
+	if _, err := temporary.WriteString(token); err != nil {
+		temporary.Close()
+		os.Remove(temporary.Name())
+		return err
+	}
+	if err := temporary.Close(); err != nil {
+		os.Remove(temporary.Name())
+		return err
+	}
+	if err := os.Rename(temporary.Name(), path); err != nil {
+		os.Remove(temporary.Name())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package transport
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Issues the default and reader tokens to files of a temporary directory
+func newTestAuthenticator(t *testing.T) (*Authenticator, map[string]string) {
+	t.Helper()
+	auth := NewAuthenticator()
+	tokens := make(map[string]string)
+	for _, name := range []string{"default", "reader"} {
+		token, err := auth.Issue(name, filepath.Join(t.TempDir(), name+".token"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens[name] = token
+	}
+	return auth, tokens
+}
+
+// Returns the token of each case: the name of an issued token, or the token itself
+func testToken(tokens map[string]string, token string) string {
+	if issued, ok := tokens[token]; ok {
+		return issued
+	}
+	return token
+}
+
+var authTests = []struct {
+	name    string
+	token   string
+	sent    bool
+	allowed string
+}{
+	{"no token", "", false, ""},
+	{"empty token", "", true, ""},
+	{"wrong token", "not-a-token", true, ""},
+	{"default token", "default", true, "default"},
+	{"reader token", "reader", true, "reader"},
+}
+
+func TestMiddleware(t *testing.T) {
+	auth, tokens := newTestAuthenticator(t)
+	server := httptest.NewServer(auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, _ := TokenName(r.Context())
+		w.Write([]byte(name))
+	})))
+	defer server.Close()
+
+	for _, test := range authTests {
+		t.Run(test.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", server.URL, nil)
+			if test.sent {
+				req.Header.Set(TokenHeader, testToken(tokens, test.token))
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			expected := http.StatusOK
+			if test.allowed == "" {
+				expected = http.StatusUnauthorized
+			}
+			if resp.StatusCode != expected {
+				t.Fatalf("request returned %s, expected %d", resp.Status, expected)
+			}
+		})
+	}
+}
+
+// serverStream is the stream of a gRPC call with the context
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestInterceptors(t *testing.T) {
+	auth, tokens := newTestAuthenticator(t)
+	for _, test := range authTests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			if test.sent {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(tokenMetadata, testToken(tokens, test.token)))
+			}
+
+			var name string
+			_, err := auth.UnaryInterceptor(ctx, nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, req interface{}) (interface{}, error) {
+				name, _ = TokenName(ctx)
+				return nil, nil
+			})
+			streamErr := auth.StreamInterceptor(nil, &serverStream{ctx: ctx}, &grpc.StreamServerInfo{}, func(srv interface{}, stream grpc.ServerStream) error {
+				return nil
+			})
+			if test.allowed == "" {
+				if status.Code(err) != codes.Unauthenticated || status.Code(streamErr) != codes.Unauthenticated {
+					t.Fatalf("calls returned %v and %v, expected UNAUTHENTICATED", err, streamErr)
+				}
+				return
+			}
+			if err != nil || streamErr != nil || name != test.allowed {
+				t.Fatalf("calls returned %v and %v for token %q, expected %s to be allowed", err, streamErr, name, test.allowed)
+			}
+		})
+	}
+}
+
+func TestEmptyTokenNeverAuthenticates(t *testing.T) {
+	auth := NewAuthenticator()
+	if _, ok := auth.Authenticate(""); ok {
+		t.Fatal("empty token authenticated without tokens")
+	}
+	// Even when a token is empty, ex: it was set without Issue
+	auth.tokens["broken"] = ""
+	if name, ok := auth.Authenticate(""); ok {
+		t.Fatalf("empty token authenticated as %s", name)
+	}
+}
+
+func TestIssueAndRevoke(t *testing.T) {
+	directory := t.TempDir()
+	path := filepath.Join(directory, "ipc.token")
+	auth := NewAuthenticator()
+	first, err := auth.Issue("default", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("token file written with mode %v, expected 0600", info.Mode().Perm())
+	}
+	if data, _ := os.ReadFile(path); string(data) != first {
+		t.Fatalf("token file contains %q, expected the issued token", data)
+	}
+
+	// Issuing again replaces the token and its file
+	second, err := auth.Issue("default", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := auth.Authenticate(first); ok || second == first {
+		t.Fatal("previous token still authenticates")
+	}
+	if data, _ := os.ReadFile(path); string(data) != second {
+		t.Fatalf("token file contains %q, expected the new token", data)
+	}
+	if entries, _ := os.ReadDir(directory); len(entries) != 1 {
+		t.Fatalf("found %d files, expected the temporary token files to be renamed", len(entries))
+	}
+
+	auth.Revoke("default")
+	if _, ok := auth.Authenticate(second); ok {
+		t.Fatal("revoked token still authenticates")
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package transport
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"google.golang.org/grpc"
+)
+
+// Config lists the listeners of the IPC servers, an empty value disables the listener
+type Config struct {
+	// TCP address of the HTTP server, ex: sandbox.localdomain:2772
+	HTTPAddress string
+	// Unix socket of the HTTP server, ex: /tmp/ipc-extension.sock
+	HTTPSocket string
+	// Unix socket of the gRPC server, ex: /tmp/ipc-extension.grpc.sock
+	GRPCSocket string
+	// Auth rejects the requests without a valid token on every listener, when not nil
+	Auth *Authenticator
+}
+
+// Server serves an HTTP handler and gRPC services on the listeners of the config
+type Server struct {
+	http    *http.Server
+	grpc    *grpc.Server
+	sockets []string
+}
+
+// Serve starts serving the handler over HTTP, and the services registered by register over gRPC.
+// register is only called when the gRPC socket is configured
+func Serve(config Config, handler http.Handler, register func(*grpc.Server)) (*Server, error) {
+	var options []grpc.ServerOption
+	if config.Auth != nil {
+		handler = config.Auth.Middleware(handler)
+		options = append(options, grpc.UnaryInterceptor(config.Auth.UnaryInterceptor), grpc.StreamInterceptor(config.Auth.StreamInterceptor))
+	}
+	server := &Server{http: &http.Server{Handler: handler}}
+	var httpListeners []net.Listener
+	var grpcListener net.Listener
+	fail := func(err error) (*Server, error) {
+		for _, listener := range httpListeners {
+			listener.Close()
+		}
+		if grpcListener != nil {
+			grpcListener.Close()
+		}
+		server.removeSockets()
+		return nil, err
+	}
+
+	if config.HTTPAddress != "" {
+		listener, err := net.Listen("tcp", config.HTTPAddress)
+		if err != nil {
+			return fail(err)
+		}
+		httpListeners = append(httpListeners, listener)
+	}
+	if config.HTTPSocket != "" {
+		listener, err := ListenUnix(config.HTTPSocket)
+		if err != nil {
+			return fail(err)
+		}
+		httpListeners = append(httpListeners, listener)
+		server.sockets = append(server.sockets, config.HTTPSocket)
+	}
+	if config.GRPCSocket != "" {
+		listener, err := ListenUnix(config.GRPCSocket)
+		if err != nil {
+			return fail(err)
+		}
+		grpcListener = listener
+		server.sockets = append(server.sockets, config.GRPCSocket)
+		server.grpc = grpc.NewServer(options...)
+		register(server.grpc)
+	}
+
+	for _, listener := range httpListeners {
+		go func(listener net.Listener) {
+			err := server.http.Serve(listener)
+			if err != nil && err != http.ErrServerClosed {
+				panic(err)
+			}
+		}(listener)
+	}
+	if grpcListener != nil {
+		go func() {
+			err := server.grpc.Serve(grpcListener)
+			if err != nil && err != grpc.ErrServerStopped {
+				panic(err)
+			}
+		}()
+	}
+	return server, nil
+}
+
+// Shutdown stops the servers once the pending requests completed or ctx is done, and removes the
+// sockets
+func (s *Server) Shutdown(ctx context.Context) error {
+	defer s.removeSockets()
+	if s.grpc != nil {
+		stopped := make(chan struct{})
+		go func() {
+			s.grpc.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			s.grpc.Stop()
+		}
+	}
+	return s.http.Shutdown(ctx)
+}
+
+func (s *Server) removeSockets() {
+	for _, socket := range s.sockets {
+		os.Remove(socket)
+	}
+}
+
+// ListenUnix listens on a Unix domain socket only the user of the extension, which is also the user
+// of the function, can connect to. The socket is created in a temporary 0700 directory next to the
+// path, where no other user can reach it, and moved to the path once its permissions are restricted
+func ListenUnix(path string) (net.Listener, error) {
+	// A socket left by a previous extension process would fail the rename
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	directory, err := os.MkdirTemp(filepath.Dir(path), ".socket-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(directory)
+	temporary := filepath.Join(directory, filepath.Base(path))
+	listener, err := net.Listen("unix", temporary)
+	if err != nil {
+		return nil, err
+	}
+	// The socket is removed by Server, it would not be found under its temporary name
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err := os.Chmod(temporary, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	if err := os.Rename(temporary, path); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
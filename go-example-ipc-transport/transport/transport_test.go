@@ -0,0 +1,152 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package transport
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+func TestListenUnixRestrictsSocket(t *testing.T) {
+	directory := t.TempDir()
+	path := filepath.Join(directory, "ipc.sock")
+	listener, err := ListenUnix(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSocket == 0 || info.Mode().Perm() != 0600 {
+		t.Fatalf("socket created with mode %v, expected a 0600 socket", info.Mode())
+	}
+	if entries, _ := os.ReadDir(directory); len(entries) != 1 {
+		t.Fatalf("found %d files next to the socket, expected the temporary directory to be removed", len(entries))
+	}
+	connection, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("cannot connect to the socket: %v", err)
+	}
+	connection.Close()
+}
+
+func TestListenUnixReplacesStaleSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ipc.sock")
+	// A previous process exited without removing its socket
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("stale socket was removed: %v", err)
+	}
+
+	listener, err := ListenUnix(path)
+	if err != nil {
+		t.Fatalf("cannot listen over a stale socket: %v", err)
+	}
+	defer listener.Close()
+	connection, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("cannot connect to the new socket: %v", err)
+	}
+	connection.Close()
+}
+
+// Reserves a free TCP address
+func freeAddress(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+func TestServeClosesListenersOnFailure(t *testing.T) {
+	directory := t.TempDir()
+	config := Config{
+		HTTPAddress: freeAddress(t),
+		HTTPSocket:  filepath.Join(directory, "ipc.sock"),
+		// The gRPC socket fails, after the HTTP listeners were opened
+		GRPCSocket: filepath.Join(directory, "missing", "ipc.grpc.sock"),
+	}
+	server, err := Serve(config, http.NotFoundHandler(), func(*grpc.Server) {})
+	if err == nil {
+		server.Shutdown(context.Background())
+		t.Fatal("Serve succeeded with a socket in a missing directory")
+	}
+
+	listener, err := net.Listen("tcp", config.HTTPAddress)
+	if err != nil {
+		t.Fatalf("TCP listener was not closed: %v", err)
+	}
+	listener.Close()
+	if _, err := os.Stat(config.HTTPSocket); !os.IsNotExist(err) {
+		t.Fatalf("HTTP socket was not removed: %v", err)
+	}
+}
+
+func TestServe(t *testing.T) {
+	directory := t.TempDir()
+	config := Config{
+		HTTPAddress: freeAddress(t),
+		HTTPSocket:  filepath.Join(directory, "ipc.sock"),
+		GRPCSocket:  filepath.Join(directory, "ipc.grpc.sock"),
+	}
+	registered := false
+	server, err := Serve(config, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "served")
+	}), func(*grpc.Server) { registered = true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !registered {
+		t.Fatal("gRPC services were not registered")
+	}
+
+	socketClient := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", config.HTTPSocket)
+		},
+	}}
+	for _, client := range []*http.Client{http.DefaultClient, socketClient} {
+		resp, err := client.Get("http://" + config.HTTPAddress + "/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if !strings.Contains(string(body), "served") {
+			t.Fatalf("server returned %s", body)
+		}
+	}
+	socketClient.CloseIdleConnections()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, socket := range []string{config.HTTPSocket, config.GRPCSocket} {
+		if _, err := os.Stat(socket); !os.IsNotExist(err) {
+			t.Fatalf("socket %s was not removed on shutdown: %v", socket, err)
+		}
+	}
+}
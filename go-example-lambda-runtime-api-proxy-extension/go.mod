@@ -2,4 +2,8 @@ module LAMBDA-RUNTIME-API-PROXY-EXTENSION-MAIN/golang-example-lambda-runtime-api
 
 go 1.6
 
-require github.com/go-chi/chi/v5 v5.0.10
+require (
+	github.com/aws/aws-sdk-go v1.55.8
+	github.com/go-chi/chi/v5 v5.0.10
+	github.com/santhosh-tekuri/jsonschema/v5 v5.3.1
+)
@@ -29,6 +29,7 @@ type NextEventResponse struct {
 	RequestID          string    `json:"requestId"`
 	InvokedFunctionArn string    `json:"invokedFunctionArn"`
 	Tracing            Tracing   `json:"tracing"`
+	ShutdownReason     string    `json:"shutdownReason"`
 }
 
 // Tracing is part of the response for /event/next
@@ -81,9 +82,9 @@ func (e *Client) Register(ctx context.Context, filename string) (*RegisterRespon
 
 	url := e.baseURL + action
 
-	// We only register for Shutdown events as the proxy
+	// We only register for Shutdown events as the proxy, to drain it before the environment stops
 	reqBody, err := json.Marshal(map[string]interface{}{
-		"events": []EventType{}, // You can register for INVOKE and SHUTDOWN events here
+		"events": []EventType{Shutdown}, // You can register for INVOKE and SHUTDOWN events here
 	})
 	if err != nil {
 		println(printPrefix, "failed to create request body:", err)
@@ -156,4 +157,45 @@ func (e *Client) NextEvent(ctx context.Context) (*NextEventResponse, error) {
 	}
 	println(printPrefix, "Next success")
 	return &res, nil
-}
\ No newline at end of file
+}
+
+// InitError reports an initialization error to the platform. Call it when you registered but failed to initialize
+func (e *Client) InitError(ctx context.Context, errorType string, errorMessage string) (*StatusResponse, error) {
+	println(printPrefix, "reporting init error", errorType)
+	const action = "/init/error"
+	url := e.baseURL + action
+
+	reqBody, err := json.Marshal(map[string]string{
+		"errorType":    errorType,
+		"errorMessage": errorMessage,
+	})
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set(extensionIdentifierHeader, e.extensionID)
+	httpReq.Header.Set(extensionErrorType, errorType)
+	httpRes, err := e.httpClient.Do(httpReq)
+	if err != nil {
+		println(printPrefix, "failed to send request:", err)
+		return nil, err
+	}
+	if httpRes.StatusCode != 200 {
+		println(printPrefix, "init error request failed with status", httpRes.Status)
+		return nil, fmt.Errorf("request failed with status %s", httpRes.Status)
+	}
+	defer httpRes.Body.Close()
+	body, err := io.ReadAll(httpRes.Body)
+	if err != nil {
+		return nil, err
+	}
+	res := StatusResponse{}
+	err = json.Unmarshal(body, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
@@ -14,22 +14,39 @@ import (
 	"path/filepath"
 	"strconv"
 	"syscall"
+	"time"
 
 	"LAMBDA-RUNTIME-API-PROXY-EXTENSION-MAIN/golang-example-lambda-runtime-api-proxy-example/src/extension"
+	"LAMBDA-RUNTIME-API-PROXY-EXTENSION-MAIN/golang-example-lambda-runtime-api-proxy-example/src/middleware"
 	"LAMBDA-RUNTIME-API-PROXY-EXTENSION-MAIN/golang-example-lambda-runtime-api-proxy-example/src/proxy"
+	"LAMBDA-RUNTIME-API-PROXY-EXTENSION-MAIN/golang-example-lambda-runtime-api-proxy-example/src/replay"
 )
 
 const (
-	printPrefix     = "[LRAP:Main]"
+	printPrefix = "[LRAP:Main]"
+	// Used when the extension is stopped by a signal instead of a SHUTDOWN event
+	defaultShutdownBudget = 500 * time.Millisecond
+	shutdownMargin        = 50 * time.Millisecond
 )
 
 func main() {
+	// The same binary replays capture files locally, see the README
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		os.Exit(replay.Run(os.Args[2:]))
+	}
+
 	println(printPrefix, "Starting")
 	runtimeApiEndpoint := getRuntimeApiEndpoint()
 	listenerPort := getListenerPort()
 	extensionName := filepath.Base(os.Args[0]) // extension name has to match the filename
 
-	proxy.StartProxy(runtimeApiEndpoint, listenerPort)
+	// The proxy is started before registering so that it is ready when the runtime starts, but the
+	// configuration errors and its failure can only be reported once registered
+	configErr := useMiddlewares()
+	var proxyErr error
+	if configErr == nil {
+		proxyErr = proxy.StartProxy(runtimeApiEndpoint, getListenerHost(), listenerPort)
+	}
 	extensionClient := extension.NewClient(os.Getenv("AWS_LAMBDA_RUNTIME_API"))
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -50,13 +67,108 @@ func main() {
 		panic(err)
 	}
 	println(printPrefix, "Register response:", fmt.Sprintf("%+v",res))
-	extensionClient.NextEvent(ctx)
 
-	//processEvents(ctx)
-	<-ctx.Done()
+	if configErr != nil {
+		println(printPrefix, configErr.Error())
+		if _, err := extensionClient.InitError(ctx, "Extension.InvalidConfig", configErr.Error()); err != nil {
+			println(printPrefix, "Cannot report InitError", err.Error())
+		}
+		os.Exit(1)
+	}
+	if proxyErr != nil {
+		println(printPrefix, "Error starting proxy:", proxyErr.Error())
+		if _, err := extensionClient.InitError(ctx, "Extension.ProxyListenerError", proxyErr.Error()); err != nil {
+			println(printPrefix, "Cannot report InitError", err.Error())
+		}
+		os.Exit(1)
+	}
+
+	processEvents(ctx, extensionClient)
 	println(printPrefix, "FINISHED")
 }
 
+// Registers the middlewares configured by the environment variables. They run in registration order
+// on /next, and in reverse order on /response and /error
+func useMiddlewares() error {
+	// Validation is registered first so that it checks the events and responses at the boundary
+	validation, err := middleware.NewValidationFromEnv()
+	if err != nil {
+		return fmt.Errorf("invalid validation configuration: %v", err)
+	}
+	if validation != nil {
+		proxy.Use(validation)
+	}
+	// Idempotency keys are derived from the raw events, and the final responses are stored once every
+	// middleware has accepted them
+	idempotency, err := middleware.NewIdempotencyFromEnv()
+	if err != nil {
+		return fmt.Errorf("invalid idempotency configuration: %v", err)
+	}
+	if idempotency != nil {
+		proxy.Use(idempotency)
+	}
+	// Redaction sees the raw events and the final responses
+	redaction, err := middleware.NewRedactionFromEnv()
+	if err != nil {
+		return fmt.Errorf("invalid redaction configuration: %v", err)
+	}
+	if redaction != nil {
+		proxy.Use(redaction)
+	}
+	capture, err := middleware.NewCaptureFromEnv()
+	if err != nil {
+		return fmt.Errorf("invalid capture configuration: %v", err)
+	}
+	if capture != nil {
+		capture.Redaction = redaction
+		proxy.Use(capture)
+	}
+	// Enrichment runs after capture so that resolved secrets are never captured
+	enrichment, err := middleware.NewEnrichmentFromEnv()
+	if err != nil {
+		return fmt.Errorf("invalid enrichment configuration: %v", err)
+	}
+	if enrichment != nil {
+		proxy.Use(enrichment)
+	}
+	proxy.Use(middleware.NewMarker())
+	return nil
+}
+
+// Blocks until SHUTDOWN or a signal, then drains the proxy within the shutdown budget
+func processEvents(ctx context.Context, extensionClient *extension.Client) {
+	for {
+		event, err := extensionClient.NextEvent(ctx)
+		if err != nil {
+			println(printPrefix, "Error receiving next event:", err.Error())
+			shutdown(time.Now().Add(defaultShutdownBudget))
+			return
+		}
+		if event.EventType == extension.Shutdown {
+			println(printPrefix, "Received SHUTDOWN, reason:", event.ShutdownReason)
+			shutdown(time.Unix(0, event.DeadlineMs*int64(time.Millisecond)))
+			return
+		}
+	}
+}
+
+// Drains the proxy, keeping a margin before the deadline for the process to exit
+func shutdown(deadline time.Time) {
+	ctx, cancel := context.WithDeadline(context.Background(), deadline.Add(-shutdownMargin))
+	defer cancel()
+	if err := proxy.Shutdown(ctx); err != nil {
+		println(printPrefix, "Proxy did not drain before the deadline:", err.Error())
+	}
+}
+
+func getListenerHost() string {
+	host := os.Getenv("LRAP_LISTENER_HOST")
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	return host
+}
+
 func getListenerPort() int {
 	port := os.Getenv("LRAP_LISTENER_PORT")
 	portInt, err := strconv.Atoi(port)
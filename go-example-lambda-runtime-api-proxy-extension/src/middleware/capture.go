@@ -0,0 +1,417 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package middleware
+
+import (
+	"bytes"
+	cryptorand "crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"LAMBDA-RUNTIME-API-PROXY-EXTENSION-MAIN/golang-example-lambda-runtime-api-proxy-example/src/proxy"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Lambda environment variables configuring the capture middleware
+const (
+	CaptureFileEnv       = "LRAP_CAPTURE_FILE"
+	CaptureS3UriEnv      = "LRAP_CAPTURE_S3_URI"
+	CaptureSampleRateEnv = "LRAP_CAPTURE_SAMPLE_RATE"
+	CaptureMaxBytesEnv   = "LRAP_CAPTURE_MAX_BYTES"
+
+	defaultCaptureMaxBytes = 10 * 1024 * 1024
+	captureBatchBytes      = 1024 * 1024
+	captureBatchAge        = time.Minute
+	captureContextKey      = "capture"
+)
+
+// CapturedPayload is the headers and body of a captured Runtime API call. JSON bodies are kept
+// as they are, other text bodies are kept as a string and binary bodies are base64 encoded
+type CapturedPayload struct {
+	Header     http.Header     `json:"header,omitempty"`
+	Body       json.RawMessage `json:"body,omitempty"`
+	BodyText   string          `json:"bodyText,omitempty"`
+	BodyBase64 string          `json:"bodyBase64,omitempty"`
+	Streamed   bool            `json:"streamed,omitempty"`
+	Truncated  bool            `json:"truncated,omitempty"`
+}
+
+// CaptureRecord is a line of a capture file: the event returned by /next and the response or
+// error posted by the handler
+type CaptureRecord struct {
+	RequestId   string           `json:"requestId"`
+	FunctionArn string           `json:"functionArn,omitempty"`
+	TraceId     string           `json:"traceId,omitempty"`
+	DeadlineMs  int64            `json:"deadlineMs,omitempty"`
+	ReceivedAt  time.Time        `json:"receivedAt"`
+	DurationMs  int64            `json:"durationMs"`
+	Event       *CapturedPayload `json:"event"`
+	Response    *CapturedPayload `json:"response,omitempty"`
+	Error       *CapturedPayload `json:"error,omitempty"`
+}
+
+// BodyBytes returns the captured body as it was sent
+func (p *CapturedPayload) BodyBytes() []byte {
+	if p.BodyText != "" {
+		return []byte(p.BodyText)
+	}
+	if p.BodyBase64 != "" {
+		body, _ := base64.StdEncoding.DecodeString(p.BodyBase64)
+		return body
+	}
+	return p.Body
+}
+
+// Capture records a sample of the invocations to a NDJSON file or to S3, to build test events
+// from production traffic. Capture stops once the size cap is reached
+type Capture struct {
+	proxy.BaseMiddleware
+	// Redaction scrubs the captured payloads when set, whatever the order of the middlewares
+	Redaction *Redaction
+
+	sampleRate float64
+	maxBytes   int64
+	file       *os.File
+	bucket     string
+	prefix     string
+	instance   string
+	s3Client   *s3.S3
+	batchAge   time.Duration
+
+	lock       sync.Mutex
+	written    int64
+	full       bool
+	batch      bytes.Buffer
+	batchStart time.Time
+
+	// Batches are uploaded in the background, one at a time
+	uploadLock sync.Mutex
+	batchCount int
+	flush      chan struct{}
+	stop       chan struct{}
+	stopOnce   sync.Once
+}
+
+// NewCaptureFromEnv configures the capture from "LRAP_CAPTURE_FILE" or "LRAP_CAPTURE_S3_URI"
+// (s3://bucket/prefix). Returns nil when neither is set
+func NewCaptureFromEnv() (*Capture, error) {
+	fileName := os.Getenv(CaptureFileEnv)
+	s3Uri := os.Getenv(CaptureS3UriEnv)
+	if fileName == "" && s3Uri == "" {
+		return nil, nil
+	}
+
+	capture := &Capture{sampleRate: 1, maxBytes: defaultCaptureMaxBytes}
+	if rate := os.Getenv(CaptureSampleRateEnv); rate != "" {
+		value, err := strconv.ParseFloat(rate, 64)
+		if err != nil || value < 0 || value > 1 {
+			return nil, fmt.Errorf("invalid %s env variable %q, expected a number between 0 and 1", CaptureSampleRateEnv, rate)
+		}
+		capture.sampleRate = value
+	}
+	if maxBytes := os.Getenv(CaptureMaxBytesEnv); maxBytes != "" {
+		value, err := strconv.ParseInt(maxBytes, 10, 64)
+		if err != nil || value <= 0 {
+			return nil, fmt.Errorf("invalid %s env variable %q, expected a positive number of bytes", CaptureMaxBytesEnv, maxBytes)
+		}
+		capture.maxBytes = value
+	}
+
+	if fileName != "" {
+		file, err := os.OpenFile(fileName, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("cannot open capture file: %v", err)
+		}
+		info, err := file.Stat()
+		if err != nil {
+			return nil, err
+		}
+		capture.file = file
+		capture.written = info.Size()
+	}
+	if s3Uri != "" {
+		if !strings.HasPrefix(s3Uri, "s3://") {
+			return nil, fmt.Errorf("invalid %s env variable %q, expected s3://bucket/prefix", CaptureS3UriEnv, s3Uri)
+		}
+		location := strings.SplitN(strings.TrimPrefix(s3Uri, "s3://"), "/", 2)
+		capture.bucket = location[0]
+		if len(location) == 2 {
+			capture.prefix = strings.Trim(location[1], "/")
+		}
+		sess, err := session.NewSession()
+		if err != nil {
+			return nil, err
+		}
+		capture.s3Client = s3.New(sess)
+		capture.instance = captureInstance()
+		capture.batchAge = captureBatchAge
+		capture.startUploads()
+	}
+	return capture, nil
+}
+
+// Identifies the execution environment in the S3 keys, so that concurrent environments never
+// overwrite each other's batches. Uses the ID ending the log stream name, ex:
+// 2024/01/15/[$LATEST]0123456789abcdef, or a random one
+func captureInstance() string {
+	logStream := os.Getenv("AWS_LAMBDA_LOG_STREAM_NAME")
+	if idx := strings.LastIndex(logStream, "]"); idx >= 0 && idx < len(logStream)-1 {
+		return logStream[idx+1:]
+	}
+	id := make([]byte, 8)
+	cryptorand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// Uploads the batch every batchAge, or as soon as it reaches the batch size
+func (c *Capture) startUploads() {
+	c.flush = make(chan struct{}, 1)
+	c.stop = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(c.batchAge)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-c.flush:
+			case <-c.stop:
+				return
+			}
+			if err := c.flushBatch(); err != nil {
+				println(printPrefix, "Error uploading capture, retrying with the next batch:", err.Error())
+			}
+		}
+	}()
+}
+
+func (c *Capture) OnNext(ctx *proxy.InvocationContext, event *proxy.Payload) (proxy.Action, error) {
+	if c.isFull() || rand.Float64() >= c.sampleRate {
+		return proxy.Continue, nil
+	}
+
+	record := &CaptureRecord{
+		RequestId:   ctx.RequestId,
+		FunctionArn: ctx.FunctionArn,
+		TraceId:     ctx.TraceId,
+		ReceivedAt:  ctx.ReceivedAt,
+		Event:       c.capturePayload(TargetEvent, event.Header, event.Body),
+	}
+	if !ctx.Deadline.IsZero() {
+		record.DeadlineMs = ctx.Deadline.UnixNano() / int64(time.Millisecond)
+	}
+	ctx.Set(captureContextKey, record)
+	return proxy.Continue, nil
+}
+
+func (c *Capture) OnResponse(ctx *proxy.InvocationContext, response *proxy.Payload) (proxy.Action, error) {
+	if record := captureRecord(ctx); record != nil {
+		record.Response = c.capturePayload(TargetResponse, response.Header, response.Body)
+		return proxy.Continue, c.write(record)
+	}
+	return proxy.Continue, nil
+}
+
+func (c *Capture) OnInvokeError(ctx *proxy.InvocationContext, invokeError *proxy.Payload) (proxy.Action, error) {
+	if record := captureRecord(ctx); record != nil {
+		record.Error = c.capturePayload(TargetResponse, invokeError.Header, invokeError.Body)
+		return proxy.Continue, c.write(record)
+	}
+	return proxy.Continue, nil
+}
+
+// OnResponseChunk buffers streamed responses up to the size cap
+func (c *Capture) OnResponseChunk(ctx *proxy.InvocationContext, chunk []byte) {
+	record := captureRecord(ctx)
+	if record == nil {
+		return
+	}
+	if record.Response == nil {
+		record.Response = &CapturedPayload{Streamed: true}
+		ctx.Set(captureContextKey+".stream", &bytes.Buffer{})
+	}
+	value, _ := ctx.Get(captureContextKey + ".stream")
+	buffer := value.(*bytes.Buffer)
+	if int64(buffer.Len()+len(chunk)) > c.maxBytes {
+		record.Response.Truncated = true
+		return
+	}
+	buffer.Write(chunk)
+}
+
+func (c *Capture) OnResponseEnd(ctx *proxy.InvocationContext, trailer http.Header, err error) {
+	record := captureRecord(ctx)
+	if record == nil {
+		return
+	}
+	var body []byte
+	if value, ok := ctx.Get(captureContextKey + ".stream"); ok {
+		body = value.(*bytes.Buffer).Bytes()
+	}
+	response := c.capturePayload(TargetResponse, trailer, body)
+	response.Streamed = true
+	if record.Response != nil {
+		response.Truncated = record.Response.Truncated
+	}
+	record.Response = response
+	if err := c.write(record); err != nil {
+		println(printPrefix, "Error writing capture:", err.Error())
+	}
+}
+
+// OnShutdown uploads the pending S3 batch and closes the capture file
+func (c *Capture) OnShutdown() error {
+	if c.stop != nil {
+		c.stopOnce.Do(func() { close(c.stop) })
+	}
+	err := c.flushBatch()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.file != nil {
+		c.file.Close()
+		c.file = nil
+	}
+	return err
+}
+
+// Appends the record to the sinks, unless it would exceed the size cap
+func (c *Capture) write(record *CaptureRecord) error {
+	record.DurationMs = int64(time.Since(record.ReceivedAt) / time.Millisecond)
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.full {
+		return nil
+	}
+	if c.written+int64(len(line)) > c.maxBytes {
+		c.full = true
+		println(printPrefix, "Capture size cap reached, no more invocations will be captured")
+		c.requestFlush()
+		return nil
+	}
+	c.written += int64(len(line))
+
+	if c.file != nil {
+		if _, err := c.file.Write(line); err != nil {
+			return err
+		}
+	}
+	if c.s3Client != nil {
+		if c.batch.Len() == 0 {
+			c.batchStart = time.Now()
+		}
+		c.batch.Write(line)
+		if c.batch.Len() >= captureBatchBytes {
+			c.requestFlush()
+		}
+	}
+	return nil
+}
+
+// Wakes the uploader up without waiting for the upload. Expects the lock to be held
+func (c *Capture) requestFlush() {
+	select {
+	case c.flush <- struct{}{}:
+	default:
+	}
+}
+
+// Uploads the batch as a new object. The records written during the upload go to the next
+// batch, and the batch is kept for the next upload when this one fails
+func (c *Capture) flushBatch() error {
+	if c.s3Client == nil {
+		return nil
+	}
+	c.uploadLock.Lock()
+	defer c.uploadLock.Unlock()
+
+	c.lock.Lock()
+	batch := append([]byte(nil), c.batch.Bytes()...)
+	batchStart := c.batchStart
+	c.batch.Reset()
+	c.lock.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+
+	c.batchCount++
+	key := fmt.Sprintf("%s/%s-%s-%d.ndjson", os.Getenv("AWS_LAMBDA_FUNCTION_NAME"), batchStart.UTC().Format("20060102T150405Z"), c.instance, c.batchCount)
+	if c.prefix != "" {
+		key = c.prefix + "/" + key
+	}
+	_, err := c.s3Client.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(c.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(batch),
+		ContentType: aws.String("application/x-ndjson"),
+	})
+	if err != nil {
+		c.lock.Lock()
+		batch = append(batch, c.batch.Bytes()...)
+		c.batch.Reset()
+		c.batch.Write(batch)
+		c.batchStart = batchStart
+		c.lock.Unlock()
+		return fmt.Errorf("cannot upload capture to s3://%s/%s: %v", c.bucket, key, err)
+	}
+	return nil
+}
+
+func (c *Capture) isFull() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.full
+}
+
+func captureRecord(ctx *proxy.InvocationContext) *CaptureRecord {
+	value, ok := ctx.Get(captureContextKey)
+	if !ok {
+		return nil
+	}
+	return value.(*CaptureRecord)
+}
+
+// Copies the payload, the proxy and other middlewares may change it after this hook
+func (c *Capture) capturePayload(target string, header http.Header, body []byte) *CapturedPayload {
+	if c.Redaction != nil {
+		scrubbed, err := c.Redaction.Scrub(target, body)
+		if err != nil {
+			println(printPrefix, "Error scrubbing captured payload, body dropped:", err.Error())
+			scrubbed = nil
+		}
+		body = scrubbed
+	}
+
+	payload := &CapturedPayload{Header: make(http.Header)}
+	for key, values := range header {
+		payload.Header[key] = append([]string(nil), values...)
+	}
+	switch {
+	case len(body) == 0:
+	case json.Valid(body):
+		payload.Body = append(json.RawMessage(nil), body...)
+	case utf8.Valid(body):
+		payload.BodyText = string(body)
+	default:
+		payload.BodyBase64 = base64.StdEncoding.EncodeToString(body)
+	}
+	return payload
+}
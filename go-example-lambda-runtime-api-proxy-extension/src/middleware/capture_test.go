@@ -0,0 +1,291 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package middleware
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"LAMBDA-RUNTIME-API-PROXY-EXTENSION-MAIN/golang-example-lambda-runtime-api-proxy-example/src/proxy"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Captures an invocation answered with the response, or with the error when isError is set
+func captureInvocation(t *testing.T, capture *Capture, requestId string, event string, response string, isError bool) {
+	t.Helper()
+	ctx := newInvocation(requestId, time.Now().Add(time.Minute))
+	capture.OnNext(ctx, &proxy.Payload{Header: http.Header{"Lambda-Runtime-Aws-Request-Id": {requestId}}, Body: []byte(event)})
+	hook := capture.OnResponse
+	if isError {
+		hook = capture.OnInvokeError
+	}
+	if _, err := hook(ctx, &proxy.Payload{Header: make(http.Header), Body: []byte(response)}); err != nil {
+		t.Fatalf("capture failed: %v", err)
+	}
+}
+
+func readCaptureRecords(t *testing.T, data string) []*CaptureRecord {
+	t.Helper()
+	var records []*CaptureRecord
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		record := &CaptureRecord{}
+		if err := json.Unmarshal(scanner.Bytes(), record); err != nil {
+			t.Fatalf("invalid capture line %s: %v", scanner.Text(), err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestCaptureFile(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "capture.ndjson")
+	t.Setenv(CaptureFileEnv, fileName)
+	capture, err := NewCaptureFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	captureInvocation(t, capture, "request-1", `{"orderId": 1}`, "plain text", false)
+	captureInvocation(t, capture, "request-2", `{"orderId": 2}`, "\xff\xfe", true)
+	if err := capture.OnShutdown(); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("capture file created with mode %v, expected 0600", info.Mode().Perm())
+	}
+	data, _ := os.ReadFile(fileName)
+	records := readCaptureRecords(t, string(data))
+	if len(records) != 2 {
+		t.Fatalf("captured %d records, expected 2", len(records))
+	}
+	first, second := records[0], records[1]
+	if first.RequestId != "request-1" || string(first.Event.Body) != `{"orderId":1}` || first.DeadlineMs == 0 {
+		t.Fatalf("unexpected event %+v %s", first, first.Event.Body)
+	}
+	if first.Event.Header.Get("Lambda-Runtime-Aws-Request-Id") != "request-1" {
+		t.Fatalf("event headers %v were not captured", first.Event.Header)
+	}
+	if first.Response.BodyText != "plain text" || first.Error != nil {
+		t.Fatalf("unexpected response %+v", first.Response)
+	}
+	if second.Response != nil || second.Error.BodyBase64 == "" || string(second.Error.BodyBytes()) != "\xff\xfe" {
+		t.Fatalf("unexpected error %+v", second.Error)
+	}
+}
+
+func TestCaptureStopsAtSizeCap(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "capture.ndjson")
+	t.Setenv(CaptureFileEnv, fileName)
+	t.Setenv(CaptureMaxBytesEnv, "300")
+	capture, err := NewCaptureFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer capture.OnShutdown()
+	captureInvocation(t, capture, "request-1", `{"orderId": 1}`, `{"total": 1}`, false)
+	captureInvocation(t, capture, "request-2", `{"orderId": 2}`, `{"total": 2}`, false)
+
+	data, _ := os.ReadFile(fileName)
+	if records := readCaptureRecords(t, string(data)); len(records) != 1 || records[0].RequestId != "request-1" {
+		t.Fatalf("captured %s, expected only the first invocation to fit", data)
+	}
+	// Events are no longer sampled once the capture is full
+	ctx := newInvocation("request-3", time.Now().Add(time.Minute))
+	capture.OnNext(ctx, &proxy.Payload{Header: make(http.Header), Body: []byte(`{}`)})
+	if captureRecord(ctx) != nil {
+		t.Fatal("event captured after the size cap was reached")
+	}
+}
+
+func TestCaptureStreamedResponse(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "capture.ndjson")
+	t.Setenv(CaptureFileEnv, fileName)
+	capture, err := NewCaptureFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	capture.maxBytes = 10
+	defer capture.OnShutdown()
+
+	ctx := newInvocation("request-1", time.Now().Add(time.Minute))
+	capture.OnNext(ctx, &proxy.Payload{Header: make(http.Header), Body: []byte(`{}`)})
+	for _, chunk := range []string{"first,", "second,", "third"} {
+		capture.OnResponseChunk(ctx, []byte(chunk))
+	}
+	capture.OnResponseEnd(ctx, make(http.Header), nil)
+
+	record := captureRecord(ctx)
+	if !record.Response.Streamed || !record.Response.Truncated || record.Response.BodyText != "first," {
+		t.Fatalf("unexpected streamed response %+v, expected the chunks within the size cap", record.Response)
+	}
+}
+
+// fakeS3 records the uploaded objects. The first failures uploads fail, and uploads are
+// signaled on started then wait for block to be closed when it is set
+type fakeS3 struct {
+	lock     sync.Mutex
+	objects  map[string]string
+	failures int
+	started  chan struct{}
+	block    chan struct{}
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.block != nil {
+		s.started <- struct{}{}
+		<-s.block
+	}
+	body, _ := io.ReadAll(r.Body)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.failures > 0 {
+		s.failures--
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	s.objects[r.URL.Path] = string(body)
+}
+
+func (s *fakeS3) uploaded() map[string]string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	objects := make(map[string]string)
+	for key, value := range s.objects {
+		objects[key] = value
+	}
+	return objects
+}
+
+func newS3Capture(t *testing.T, s3Server *fakeS3, batchAge time.Duration) *Capture {
+	server := httptest.NewServer(s3Server)
+	client := s3.New(session.Must(session.NewSession(&aws.Config{
+		Endpoint:         aws.String(server.URL),
+		Region:           aws.String("us-east-1"),
+		Credentials:      credentials.NewStaticCredentials("test", "test", ""),
+		S3ForcePathStyle: aws.Bool(true),
+		MaxRetries:       aws.Int(0),
+	})))
+	capture := &Capture{
+		sampleRate: 1,
+		maxBytes:   defaultCaptureMaxBytes,
+		bucket:     "captures",
+		prefix:     "prod",
+		instance:   "0123456789abcdef",
+		s3Client:   client,
+		batchAge:   batchAge,
+	}
+	capture.startUploads()
+	t.Cleanup(func() {
+		capture.OnShutdown()
+		server.Close()
+	})
+	return capture
+}
+
+func TestCaptureUploadsBatchByAge(t *testing.T) {
+	t.Setenv("AWS_LAMBDA_FUNCTION_NAME", "orders")
+	s3Server := &fakeS3{objects: make(map[string]string)}
+	capture := newS3Capture(t, s3Server, 50*time.Millisecond)
+	captureInvocation(t, capture, "request-1", `{"orderId": 1}`, `{"total": 1}`, false)
+
+	// No other record is written, the uploader flushes the batch on its own
+	deadline := time.Now().Add(5 * time.Second)
+	for len(s3Server.uploaded()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	objects := s3Server.uploaded()
+	if len(objects) != 1 {
+		t.Fatalf("uploaded %v, expected one batch", objects)
+	}
+	for key, body := range objects {
+		if !strings.HasPrefix(key, "/captures/prod/orders/") || !strings.HasSuffix(key, "-0123456789abcdef-1.ndjson") {
+			t.Fatalf("batch uploaded to %s, expected a key unique to the execution environment", key)
+		}
+		if records := readCaptureRecords(t, body); len(records) != 1 || records[0].RequestId != "request-1" {
+			t.Fatalf("unexpected batch %s", body)
+		}
+	}
+}
+
+func TestCaptureDoesNotWaitForUploads(t *testing.T) {
+	s3Server := &fakeS3{objects: make(map[string]string), started: make(chan struct{}, 2), block: make(chan struct{})}
+	capture := newS3Capture(t, s3Server, time.Hour)
+	captureInvocation(t, capture, "request-1", `{"orderId": 1}`, `{"total": 1}`, false)
+	uploaded := make(chan error)
+	go func() { uploaded <- capture.flushBatch() }()
+	<-s3Server.started
+
+	// The response path keeps capturing while the upload is in flight
+	captured := make(chan struct{})
+	go func() {
+		captureInvocation(t, capture, "request-2", `{"orderId": 2}`, `{"total": 2}`, false)
+		close(captured)
+	}()
+	select {
+	case <-captured:
+	case <-time.After(5 * time.Second):
+		t.Fatal("capture waited for the upload")
+	}
+	close(s3Server.block)
+	if err := <-uploaded; err != nil {
+		t.Fatal(err)
+	}
+	if err := capture.OnShutdown(); err != nil {
+		t.Fatal(err)
+	}
+	if objects := s3Server.uploaded(); len(objects) != 2 {
+		t.Fatalf("uploaded %v, expected the record captured during the upload in a second batch", objects)
+	}
+}
+
+func TestCaptureKeepsBatchOnUploadFailure(t *testing.T) {
+	s3Server := &fakeS3{objects: make(map[string]string), failures: 1}
+	capture := newS3Capture(t, s3Server, time.Hour)
+	captureInvocation(t, capture, "request-1", `{"orderId": 1}`, `{"total": 1}`, false)
+	if err := capture.flushBatch(); err == nil {
+		t.Fatal("failed upload reported no error")
+	}
+	captureInvocation(t, capture, "request-2", `{"orderId": 2}`, `{"total": 2}`, false)
+	if err := capture.OnShutdown(); err != nil {
+		t.Fatal(err)
+	}
+
+	objects := s3Server.uploaded()
+	if len(objects) != 1 {
+		t.Fatalf("uploaded %v, expected the failed batch with the next one", objects)
+	}
+	for _, body := range objects {
+		if records := readCaptureRecords(t, body); len(records) != 2 || records[0].RequestId != "request-1" || records[1].RequestId != "request-2" {
+			t.Fatalf("unexpected batch %s", body)
+		}
+	}
+}
+
+func TestCaptureInstance(t *testing.T) {
+	t.Setenv("AWS_LAMBDA_LOG_STREAM_NAME", "2024/01/15/[$LATEST]0123456789abcdef")
+	if instance := captureInstance(); instance != "0123456789abcdef" {
+		t.Fatalf("instance %s, expected the ID of the log stream", instance)
+	}
+	t.Setenv("AWS_LAMBDA_LOG_STREAM_NAME", "")
+	if first, second := captureInstance(), captureInstance(); len(first) != 16 || first == second {
+		t.Fatalf("instances %s and %s, expected random IDs", first, second)
+	}
+}
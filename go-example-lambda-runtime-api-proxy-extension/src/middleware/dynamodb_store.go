@@ -0,0 +1,163 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package middleware
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Attributes of the idempotency table. The table partition key is "id", a string, and
+// "expiration" can be enabled as the table TTL attribute
+const (
+	idAttribute         = "id"
+	statusAttribute     = "status"
+	requestIdAttribute  = "requestId"
+	responseAttribute   = "response"
+	expirationAttribute = "expiration"
+
+	// Attempts of Lock when the record expires or is released between the put and the get
+	maxLockAttempts = 3
+)
+
+// DynamodbStore shares idempotency records across execution environments and functions
+type DynamodbStore struct {
+	table  string
+	client *dynamodb.DynamoDB
+}
+
+// NewDynamodbStore returns a store backed by the given table, in the function region
+func NewDynamodbStore(table string) (*DynamodbStore, error) {
+	sess, err := session.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	return &DynamodbStore{table: table, client: dynamodb.New(sess)}, nil
+}
+
+// Lock puts an in-flight record, conditioned on no unexpired record existing for the key
+func (s *DynamodbStore) Lock(key string, requestId string, expiresAt time.Time) (bool, *IdempotencyRecord, error) {
+	for attempt := 1; ; attempt++ {
+		locked, err := s.put(key, requestId, expiresAt)
+		if err != nil || locked {
+			return locked, nil, err
+		}
+
+		record, err := s.get(key)
+		if err != nil {
+			return false, nil, err
+		}
+		if record != nil {
+			return false, record, nil
+		}
+		// The record expired or was released in the meantime
+		if attempt == maxLockAttempts {
+			return false, nil, fmt.Errorf("cannot lock idempotency record %s after %d attempts", key, attempt)
+		}
+	}
+}
+
+// Puts an in-flight record, returns false when an unexpired record exists. A record is expired
+// from its expiration second, as in get
+func (s *DynamodbStore) put(key string, requestId string, expiresAt time.Time) (bool, error) {
+	_, err := s.client.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(s.table),
+		Item: map[string]*dynamodb.AttributeValue{
+			idAttribute:         {S: aws.String(key)},
+			statusAttribute:     {S: aws.String(StatusInProgress)},
+			requestIdAttribute:  {S: aws.String(requestId)},
+			expirationAttribute: {N: aws.String(strconv.FormatInt(expiresAt.Unix(), 10))},
+		},
+		ConditionExpression: aws.String("attribute_not_exists(#id) OR #expiration <= :now"),
+		ExpressionAttributeNames: map[string]*string{
+			"#id":         aws.String(idAttribute),
+			"#expiration": aws.String(expirationAttribute),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":now": {N: aws.String(strconv.FormatInt(time.Now().Unix(), 10))},
+		},
+	})
+	if err == nil {
+		return true, nil
+	}
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return false, nil
+	}
+	return false, err
+}
+
+// Complete replaces the record with the response, keeping the request ID of the first invocation
+func (s *DynamodbStore) Complete(key string, response []byte, expiresAt time.Time) error {
+	_, err := s.client.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName:        aws.String(s.table),
+		Key:              map[string]*dynamodb.AttributeValue{idAttribute: {S: aws.String(key)}},
+		UpdateExpression: aws.String("SET #status = :status, #response = :response, #expiration = :expiration"),
+		ExpressionAttributeNames: map[string]*string{
+			"#status":     aws.String(statusAttribute),
+			"#response":   aws.String(responseAttribute),
+			"#expiration": aws.String(expirationAttribute),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":status":     {S: aws.String(StatusCompleted)},
+			":response":   {B: response},
+			":expiration": {N: aws.String(strconv.FormatInt(expiresAt.Unix(), 10))},
+		},
+	})
+	return err
+}
+
+// Release deletes the record when it is still in flight
+func (s *DynamodbStore) Release(key string) error {
+	_, err := s.client.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName:                aws.String(s.table),
+		Key:                      map[string]*dynamodb.AttributeValue{idAttribute: {S: aws.String(key)}},
+		ConditionExpression:      aws.String("#status = :status"),
+		ExpressionAttributeNames: map[string]*string{"#status": aws.String(statusAttribute)},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":status": {S: aws.String(StatusInProgress)},
+		},
+	})
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return nil
+	}
+	return err
+}
+
+// Reads the record of the key, expired records are ignored since the table TTL deletes them lazily
+func (s *DynamodbStore) get(key string) (*IdempotencyRecord, error) {
+	result, err := s.client.GetItem(&dynamodb.GetItemInput{
+		TableName:      aws.String(s.table),
+		Key:            map[string]*dynamodb.AttributeValue{idAttribute: {S: aws.String(key)}},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil || result.Item == nil {
+		return nil, err
+	}
+
+	record := &IdempotencyRecord{}
+	if value, ok := result.Item[statusAttribute]; ok {
+		record.Status = aws.StringValue(value.S)
+	}
+	if value, ok := result.Item[requestIdAttribute]; ok {
+		record.RequestId = aws.StringValue(value.S)
+	}
+	if value, ok := result.Item[responseAttribute]; ok {
+		record.Response = value.B
+	}
+	if value, ok := result.Item[expirationAttribute]; ok {
+		expiration, _ := strconv.ParseInt(aws.StringValue(value.N), 10, 64)
+		record.ExpiresAt = time.Unix(expiration, 0)
+	}
+	// Same comparison as the condition of put, in seconds
+	if record.ExpiresAt.Unix() <= time.Now().Unix() {
+		return nil, nil
+	}
+	return record, nil
+}
@@ -0,0 +1,259 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"LAMBDA-RUNTIME-API-PROXY-EXTENSION-MAIN/golang-example-lambda-runtime-api-proxy-example/src/proxy"
+)
+
+// Lambda environment variables configuring the enrichment middleware
+const (
+	EnrichmentEnv      = "LRAP_ENRICHMENT"
+	EnrichmentTtlEnv   = "LRAP_ENRICHMENT_TTL"
+	EnrichmentKeyEnv   = "LRAP_ENRICHMENT_KEY"
+	EnrichmentStubsEnv = "LRAP_ENRICHMENT_STUBS"
+
+	defaultEnrichmentTtl = 5 * time.Minute
+	defaultEnrichmentKey = "_context"
+)
+
+// resolvedValue is a cached resolver result
+type resolvedValue struct {
+	value     interface{}
+	fetchedAt time.Time
+}
+
+// Enrichment adds a context object to JSON object events before the handler receives them, with
+// the function metadata, the remaining time and values resolved from SSM, Secrets Manager or
+// AppConfig. Handlers in any language can read their configuration from the event
+type Enrichment struct {
+	proxy.BaseMiddleware
+	key        string
+	references map[string]string
+	resolvers  map[string]Resolver
+	ttl        time.Duration
+
+	lock      sync.Mutex
+	cache     map[string]resolvedValue
+	coldStart bool
+}
+
+// NewEnrichment returns the enrichment middleware. references maps the keys of the context values
+// to "<scheme>:<name>" references, resolvers maps the schemes to their resolver
+func NewEnrichment(key string, references map[string]string, resolvers map[string]Resolver, ttl time.Duration) (*Enrichment, error) {
+	for name, reference := range references {
+		scheme, _, err := splitReference(reference)
+		if err != nil {
+			return nil, fmt.Errorf("value %s: %v", name, err)
+		}
+		if _, ok := resolvers[scheme]; !ok {
+			return nil, fmt.Errorf("value %s: unsupported scheme %q, expected %s, %s or %s", name, scheme, SsmScheme, SecretsManagerScheme, AppConfigScheme)
+		}
+	}
+	return &Enrichment{
+		key:        key,
+		references: references,
+		resolvers:  resolvers,
+		ttl:        ttl,
+		cache:      make(map[string]resolvedValue),
+		coldStart:  true,
+	}, nil
+}
+
+// NewEnrichmentFromEnv reads the references from "LRAP_ENRICHMENT", a JSON object inline or the
+// path of a JSON file. When "LRAP_ENRICHMENT_STUBS" is set, references are resolved from that
+// JSON file instead of AWS, ex: {"ssm:/app/db/url": "postgres://localhost"}. Returns nil when
+// "LRAP_ENRICHMENT" is not set. Values are resolved once during init
+func NewEnrichmentFromEnv() (*Enrichment, error) {
+	config := os.Getenv(EnrichmentEnv)
+	if config == "" {
+		return nil, nil
+	}
+	var references map[string]string
+	if err := readJsonConfig(config, &references); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", EnrichmentEnv, err)
+	}
+
+	ttl := defaultEnrichmentTtl
+	if value := os.Getenv(EnrichmentTtlEnv); value != "" {
+		duration, err := time.ParseDuration(value)
+		if err != nil || duration < 0 {
+			return nil, fmt.Errorf("invalid %s env variable %q, expected a Go duration, ex: 30s, 5m", EnrichmentTtlEnv, value)
+		}
+		ttl = duration
+	}
+	key := os.Getenv(EnrichmentKeyEnv)
+	if key == "" {
+		key = defaultEnrichmentKey
+	}
+
+	var resolvers map[string]Resolver
+	if stubsFile := os.Getenv(EnrichmentStubsEnv); stubsFile != "" {
+		var stubs map[string]string
+		if err := readJsonConfig(stubsFile, &stubs); err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", EnrichmentStubsEnv, err)
+		}
+		resolvers = stubResolvers(stubs)
+	} else {
+		var err error
+		if resolvers, err = NewAwsResolvers(); err != nil {
+			return nil, err
+		}
+	}
+
+	enrichment, err := NewEnrichment(key, references, resolvers, ttl)
+	if err != nil {
+		return nil, err
+	}
+	enrichment.Warm()
+	return enrichment, nil
+}
+
+// Warm resolves every value, so that the first invocation does not wait for them
+func (e *Enrichment) Warm() {
+	for name := range e.references {
+		if _, err := e.resolve(name); err != nil {
+			println(printPrefix, "Error resolving enrichment value", name+":", err.Error())
+		}
+	}
+}
+
+func (e *Enrichment) OnNext(ctx *proxy.InvocationContext, event *proxy.Payload) (proxy.Action, error) {
+	e.lock.Lock()
+	coldStart := e.coldStart
+	e.coldStart = false
+	e.lock.Unlock()
+
+	decoded, err := decodeJson(event.Body)
+	document, ok := decoded.(map[string]interface{})
+	if err != nil || !ok {
+		// Only JSON objects can carry the context
+		return proxy.Continue, nil
+	}
+
+	metadata := map[string]interface{}{
+		"requestId":       ctx.RequestId,
+		"functionArn":     ctx.FunctionArn,
+		"functionName":    os.Getenv("AWS_LAMBDA_FUNCTION_NAME"),
+		"functionVersion": os.Getenv("AWS_LAMBDA_FUNCTION_VERSION"),
+		"region":          os.Getenv("AWS_REGION"),
+		"coldStart":       coldStart,
+	}
+	if memory, err := strconv.Atoi(os.Getenv("AWS_LAMBDA_FUNCTION_MEMORY_SIZE")); err == nil {
+		metadata["memoryMb"] = memory
+	}
+	if ctx.TraceId != "" {
+		metadata["traceId"] = ctx.TraceId
+	}
+	if !ctx.Deadline.IsZero() {
+		metadata["deadlineMs"] = ctx.Deadline.UnixNano() / int64(time.Millisecond)
+		metadata["remainingTimeMs"] = int64(time.Until(ctx.Deadline) / time.Millisecond)
+	}
+
+	if len(e.references) > 0 {
+		values := make(map[string]interface{})
+		errors := make(map[string]string)
+		for name := range e.references {
+			value, err := e.resolve(name)
+			if err != nil {
+				errors[name] = err.Error()
+				continue
+			}
+			values[name] = value
+		}
+		metadata["values"] = values
+		if len(errors) > 0 {
+			metadata["errors"] = errors
+		}
+	}
+
+	document[e.key] = metadata
+	body, err := encodeJson(document)
+	if err != nil {
+		return proxy.Continue, err
+	}
+	event.Body = body
+	return proxy.Continue, nil
+}
+
+// Returns the cached value, refreshed once the TTL has elapsed. When the refresh fails the stale
+// value is kept. JSON objects and arrays, ex: AppConfig profiles, are embedded as JSON
+func (e *Enrichment) resolve(name string) (interface{}, error) {
+	e.lock.Lock()
+	cached, ok := e.cache[name]
+	e.lock.Unlock()
+	if ok && (e.ttl == 0 || time.Since(cached.fetchedAt) < e.ttl) {
+		return cached.value, nil
+	}
+
+	scheme, reference, _ := splitReference(e.references[name])
+	raw, err := e.resolvers[scheme].Resolve(reference)
+	if err != nil {
+		if ok {
+			println(printPrefix, "Error refreshing enrichment value", name+", keeping the stale one:", err.Error())
+			return cached.value, nil
+		}
+		return nil, err
+	}
+
+	var value interface{} = raw
+	trimmed := strings.TrimSpace(raw)
+	if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+		var document interface{}
+		if json.Unmarshal([]byte(trimmed), &document) == nil {
+			value = document
+		}
+	}
+
+	e.lock.Lock()
+	e.cache[name] = resolvedValue{value: value, fetchedAt: time.Now()}
+	e.lock.Unlock()
+	return value, nil
+}
+
+// Splits "<scheme>:<name>"
+func splitReference(reference string) (string, string, error) {
+	parts := strings.SplitN(reference, ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid reference %q, expected <scheme>:<name>", reference)
+	}
+	return strings.ToLower(parts[0]), parts[1], nil
+}
+
+// Groups the stubs by scheme
+func stubResolvers(stubs map[string]string) map[string]Resolver {
+	resolvers := map[string]Resolver{
+		SsmScheme:            StaticResolver{},
+		SecretsManagerScheme: StaticResolver{},
+		AppConfigScheme:      StaticResolver{},
+	}
+	for reference, value := range stubs {
+		if scheme, name, err := splitReference(reference); err == nil {
+			if resolver, ok := resolvers[scheme]; ok {
+				resolver.(StaticResolver)[name] = value
+			}
+		}
+	}
+	return resolvers
+}
+
+// Unmarshals a JSON document given inline or as the path of a file
+func readJsonConfig(config string, target interface{}) error {
+	data := []byte(config)
+	if !strings.HasPrefix(strings.TrimSpace(config), "{") {
+		var err error
+		if data, err = os.ReadFile(config); err != nil {
+			return err
+		}
+	}
+	return json.Unmarshal(data, target)
+}
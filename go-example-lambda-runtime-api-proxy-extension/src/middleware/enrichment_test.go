@@ -0,0 +1,171 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"LAMBDA-RUNTIME-API-PROXY-EXTENSION-MAIN/golang-example-lambda-runtime-api-proxy-example/src/proxy"
+)
+
+// Runs the OnNext hook and returns the context added to the event
+func enrich(t *testing.T, enrichment *Enrichment, key string, event string) map[string]interface{} {
+	t.Helper()
+	ctx := &proxy.InvocationContext{
+		RequestId:   "request-1",
+		FunctionArn: "arn:aws:lambda:eu-west-1:123456789012:function:orders",
+		TraceId:     "Root=1-5759e988-bd862e3fe1be46a994272793",
+		Deadline:    time.Now().Add(time.Minute),
+	}
+	payload := &proxy.Payload{Header: make(http.Header), Body: []byte(event)}
+	if action, err := enrichment.OnNext(ctx, payload); action != proxy.Continue || err != nil {
+		t.Fatalf("OnNext returned %v, %v", action, err)
+	}
+	var document map[string]interface{}
+	if err := json.Unmarshal(payload.Body, &document); err != nil {
+		t.Fatalf("enriched event %s is not a JSON object: %v", payload.Body, err)
+	}
+	context, _ := document[key].(map[string]interface{})
+	return context
+}
+
+func TestEnrichmentFromStubs(t *testing.T) {
+	stubs := filepath.Join(t.TempDir(), "stubs.json")
+	err := os.WriteFile(stubs, []byte(`{
+		"ssm:/orders/db/url": "postgres://localhost/orders",
+		"secretsmanager:orders/api-key": "secret",
+		"appconfig:orders/prod/flags": "{\"newCheckout\": true}"
+	}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(EnrichmentEnv, `{"dbUrl": "ssm:/orders/db/url", "apiKey": "secretsmanager:orders/api-key", "flags": "appconfig:orders/prod/flags"}`)
+	t.Setenv(EnrichmentStubsEnv, stubs)
+	t.Setenv(EnrichmentKeyEnv, "context")
+	t.Setenv("AWS_LAMBDA_FUNCTION_NAME", "orders")
+	t.Setenv("AWS_LAMBDA_FUNCTION_MEMORY_SIZE", "512")
+
+	enrichment, err := NewEnrichmentFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	context := enrich(t, enrichment, "context", `{"orderId": 42}`)
+
+	expected := map[string]interface{}{
+		"dbUrl":  "postgres://localhost/orders",
+		"apiKey": "secret",
+		"flags":  map[string]interface{}{"newCheckout": true},
+	}
+	if !reflect.DeepEqual(context["values"], expected) {
+		t.Fatalf("resolved values %v, expected %v", context["values"], expected)
+	}
+	if context["requestId"] != "request-1" || context["functionName"] != "orders" || context["memoryMb"] != float64(512) {
+		t.Fatalf("unexpected function metadata %v", context)
+	}
+	if remaining, _ := context["remainingTimeMs"].(float64); remaining <= 0 || remaining > 60000 {
+		t.Fatalf("unexpected remaining time %v", context["remainingTimeMs"])
+	}
+	if context["coldStart"] != true {
+		t.Fatal("the first invocation is not a cold start")
+	}
+	if context := enrich(t, enrichment, "context", `{"orderId": 43}`); context["coldStart"] != false {
+		t.Fatal("the second invocation is a cold start")
+	}
+}
+
+func TestEnrichmentReportsMissingValues(t *testing.T) {
+	resolvers := stubResolvers(map[string]string{"ssm:/orders/db/url": "postgres://localhost/orders"})
+	enrichment, err := NewEnrichment(defaultEnrichmentKey, map[string]string{
+		"dbUrl":  "ssm:/orders/db/url",
+		"apiKey": "secretsmanager:orders/api-key",
+	}, resolvers, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	context := enrich(t, enrichment, defaultEnrichmentKey, `{}`)
+	if !reflect.DeepEqual(context["values"], map[string]interface{}{"dbUrl": "postgres://localhost/orders"}) {
+		t.Fatalf("unexpected values %v", context["values"])
+	}
+	if problems, _ := context["errors"].(map[string]interface{}); problems["apiKey"] != "no stub for orders/api-key" {
+		t.Fatalf("unexpected errors %v", context["errors"])
+	}
+}
+
+// flakyResolver returns its value once, then fails
+type flakyResolver struct {
+	calls int
+}
+
+func (r *flakyResolver) Resolve(name string) (string, error) {
+	r.calls++
+	if r.calls > 1 {
+		return "", errors.New("throttled")
+	}
+	return "v1", nil
+}
+
+func TestEnrichmentKeepsStaleValues(t *testing.T) {
+	resolver := &flakyResolver{}
+	enrichment, err := NewEnrichment(defaultEnrichmentKey, map[string]string{"value": "ssm:/value"},
+		map[string]Resolver{SsmScheme: resolver}, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enrichment.Warm()
+
+	time.Sleep(5 * time.Millisecond)
+	context := enrich(t, enrichment, defaultEnrichmentKey, `{}`)
+	if resolver.calls != 2 {
+		t.Fatalf("resolved %d times, expected a refresh once the TTL elapsed", resolver.calls)
+	}
+	if !reflect.DeepEqual(context["values"], map[string]interface{}{"value": "v1"}) || context["errors"] != nil {
+		t.Fatalf("unexpected context %v, expected the stale value", context)
+	}
+}
+
+func TestEnrichmentCachesValues(t *testing.T) {
+	resolver := &flakyResolver{}
+	enrichment, err := NewEnrichment(defaultEnrichmentKey, map[string]string{"value": "ssm:/value"},
+		map[string]Resolver{SsmScheme: resolver}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enrichment.Warm()
+	enrich(t, enrichment, defaultEnrichmentKey, `{}`)
+	enrich(t, enrichment, defaultEnrichmentKey, `{}`)
+	if resolver.calls != 1 {
+		t.Fatalf("resolved %d times, a zero TTL resolves once", resolver.calls)
+	}
+}
+
+func TestEnrichmentIgnoresOtherEvents(t *testing.T) {
+	enrichment, err := NewEnrichment(defaultEnrichmentKey, nil, nil, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, event := range []string{`[1, 2]`, `"text"`, `not json`} {
+		payload := &proxy.Payload{Header: make(http.Header), Body: []byte(event)}
+		enrichment.OnNext(&proxy.InvocationContext{}, payload)
+		if string(payload.Body) != event {
+			t.Fatalf("event %s changed to %s", event, payload.Body)
+		}
+	}
+}
+
+func TestEnrichmentRejectsInvalidReferences(t *testing.T) {
+	resolvers := stubResolvers(nil)
+	for _, reference := range []string{"vault:/orders/db", "ssm:", "/orders/db"} {
+		if _, err := NewEnrichment(defaultEnrichmentKey, map[string]string{"value": reference}, resolvers, time.Minute); err == nil {
+			t.Fatalf("accepted the reference %q", reference)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package middleware
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"LAMBDA-RUNTIME-API-PROXY-EXTENSION-MAIN/golang-example-lambda-runtime-api-proxy-example/src/proxy"
+)
+
+// Lambda environment variables configuring the idempotency middleware
+const (
+	IdempotencyStoreEnv      = "LRAP_IDEMPOTENCY_STORE"
+	IdempotencyKeyPathEnv    = "LRAP_IDEMPOTENCY_KEY_PATH"
+	IdempotencyTtlEnv        = "LRAP_IDEMPOTENCY_TTL"
+	IdempotencyTableEnv      = "LRAP_IDEMPOTENCY_TABLE"
+	IdempotencyMaxEntriesEnv = "LRAP_IDEMPOTENCY_MAX_ENTRIES"
+
+	MemoryStoreType   = "memory"
+	DynamodbStoreType = "dynamodb"
+
+	// Statuses of an idempotency record
+	StatusInProgress = "INPROGRESS"
+	StatusCompleted  = "COMPLETED"
+
+	InProgressErrorType = "Proxy.IdempotencyInProgress"
+
+	defaultIdempotencyTtl        = time.Hour
+	defaultIdempotencyMaxEntries = 1000
+	idempotencyContextKey        = "idempotency"
+)
+
+// IdempotencyRecord is what a store keeps for an idempotency key
+type IdempotencyRecord struct {
+	Status    string
+	RequestId string
+	Response  []byte
+	ExpiresAt time.Time
+}
+
+// IdempotencyStore keeps in-flight and completed invocations. Implementations must ignore
+// expired records
+type IdempotencyStore interface {
+	// Lock stores an in-flight record for the key unless it already has one. When it does,
+	// returns false and the existing record
+	Lock(key string, requestId string, expiresAt time.Time) (bool, *IdempotencyRecord, error)
+	// Complete replaces the record with the response of the invocation
+	Complete(key string, response []byte, expiresAt time.Time) error
+	// Release removes an in-flight record so that the event can be retried
+	Release(key string) error
+}
+
+// Idempotency answers duplicate events with the stored response of the first invocation, without
+// waking the handler. The key is the value at "LRAP_IDEMPOTENCY_KEY_PATH" in the event, or the
+// whole event when not set. Events that fail are released so that they can be retried
+type Idempotency struct {
+	proxy.BaseMiddleware
+	store   IdempotencyStore
+	keyPath []pathSegment
+	ttl     time.Duration
+}
+
+// NewIdempotency returns the idempotency middleware. keyPath is a JSONPath and can be empty
+func NewIdempotency(store IdempotencyStore, keyPath string, ttl time.Duration) (*Idempotency, error) {
+	idempotency := &Idempotency{store: store, ttl: ttl}
+	if keyPath != "" {
+		path, err := parsePath(keyPath)
+		if err != nil {
+			return nil, err
+		}
+		idempotency.keyPath = path
+	}
+	return idempotency, nil
+}
+
+// NewIdempotencyFromEnv configures the middleware and its store from "LRAP_IDEMPOTENCY_STORE",
+// memory or dynamodb. Returns nil when no store is set
+func NewIdempotencyFromEnv() (*Idempotency, error) {
+	storeType := strings.ToLower(os.Getenv(IdempotencyStoreEnv))
+	if storeType == "" {
+		return nil, nil
+	}
+
+	ttl := defaultIdempotencyTtl
+	if value := os.Getenv(IdempotencyTtlEnv); value != "" {
+		duration, err := time.ParseDuration(value)
+		if err != nil || duration <= 0 {
+			return nil, fmt.Errorf("invalid %s env variable %q, expected a Go duration, ex: 30m, 24h", IdempotencyTtlEnv, value)
+		}
+		ttl = duration
+	}
+
+	var store IdempotencyStore
+	switch storeType {
+	case MemoryStoreType:
+		maxEntries := defaultIdempotencyMaxEntries
+		if value := os.Getenv(IdempotencyMaxEntriesEnv); value != "" {
+			entries, err := strconv.Atoi(value)
+			if err != nil || entries <= 0 {
+				return nil, fmt.Errorf("invalid %s env variable %q, expected a positive number", IdempotencyMaxEntriesEnv, value)
+			}
+			maxEntries = entries
+		}
+		store = NewMemoryStore(maxEntries)
+	case DynamodbStoreType:
+		table := os.Getenv(IdempotencyTableEnv)
+		if table == "" {
+			return nil, fmt.Errorf("%s is required with the %s store", IdempotencyTableEnv, DynamodbStoreType)
+		}
+		dynamodbStore, err := NewDynamodbStore(table)
+		if err != nil {
+			return nil, err
+		}
+		store = dynamodbStore
+	default:
+		return nil, fmt.Errorf("invalid %s env variable %q, expected %s or %s", IdempotencyStoreEnv, storeType, MemoryStoreType, DynamodbStoreType)
+	}
+	return NewIdempotency(store, os.Getenv(IdempotencyKeyPathEnv), ttl)
+}
+
+func (i *Idempotency) OnNext(ctx *proxy.InvocationContext, event *proxy.Payload) (proxy.Action, error) {
+	key, err := i.key(event.Body)
+	if err != nil || key == "" {
+		return proxy.Continue, err
+	}
+
+	// The lock of an invocation that timed out expires with it, so that a retry is not blocked
+	expiresAt := ctx.Deadline
+	if expiresAt.IsZero() || expiresAt.After(time.Now().Add(i.ttl)) {
+		expiresAt = time.Now().Add(i.ttl)
+	}
+	locked, record, err := i.store.Lock(key, ctx.RequestId, expiresAt)
+	if err != nil {
+		return proxy.Continue, err
+	}
+	switch {
+	case locked:
+		ctx.Set(idempotencyContextKey, key)
+		return proxy.Continue, nil
+	case record.Status == StatusCompleted:
+		println(printPrefix, "Duplicate event, answering requestID:", ctx.RequestId, "with the response of:", record.RequestId)
+		event.Body = record.Response
+		event.Header.Set("Content-Type", "application/json")
+		return proxy.Respond, nil
+	case record.RequestId == ctx.RequestId:
+		// Lambda retries asynchronous invocations with the same request ID
+		ctx.Set(idempotencyContextKey, key)
+		return proxy.Continue, nil
+	default:
+		println(printPrefix, "Duplicate event, requestID:", ctx.RequestId, "is already processed by:", record.RequestId)
+		event.SetError(InProgressErrorType, "an invocation with the same idempotency key is in progress: "+record.RequestId)
+		return proxy.Reject, nil
+	}
+}
+
+// OnComplete stores the final response, once every middleware has accepted it, and releases the
+// key of invocations that end with an error
+func (i *Idempotency) OnComplete(ctx *proxy.InvocationContext, payload *proxy.Payload, isResponse bool) {
+	key, ok := ctx.Get(idempotencyContextKey)
+	if !ok {
+		return
+	}
+	var err error
+	if isResponse {
+		err = i.store.Complete(key.(string), payload.Body, time.Now().Add(i.ttl))
+	} else {
+		err = i.store.Release(key.(string))
+	}
+	if err != nil {
+		println(printPrefix, "Error completing idempotency key:", err.Error())
+	}
+}
+
+// OnResponseChunk ignores streamed responses, they are not stored
+func (i *Idempotency) OnResponseChunk(ctx *proxy.InvocationContext, chunk []byte) {
+}
+
+// OnResponseEnd releases the key of streamed responses so that duplicates are processed again
+func (i *Idempotency) OnResponseEnd(ctx *proxy.InvocationContext, trailer http.Header, err error) {
+	if key, ok := ctx.Get(idempotencyContextKey); ok {
+		if err := i.store.Release(key.(string)); err != nil {
+			println(printPrefix, "Error releasing idempotency key:", err.Error())
+		}
+	}
+}
+
+// Hashes the value at the key path, or the whole event. Returns an empty key when the path
+// does not match, such events are not deduplicated
+func (i *Idempotency) key(body []byte) (string, error) {
+	value := body
+	if i.keyPath != nil {
+		document, err := decodeJson(body)
+		if err != nil {
+			return "", nil
+		}
+		var matches []interface{}
+		replacePath(document, i.keyPath, func(match interface{}) interface{} {
+			matches = append(matches, match)
+			return match
+		})
+		if len(matches) == 0 {
+			return "", nil
+		}
+		if value, err = json.Marshal(matches); err != nil {
+			return "", err
+		}
+	}
+	hash := sha256.Sum256(value)
+	return os.Getenv("AWS_LAMBDA_FUNCTION_NAME") + "#" + hex.EncodeToString(hash[:]), nil
+}
+
+// MemoryStore is an in-memory LRU store, it only deduplicates the events delivered to the same
+// execution environment
+type MemoryStore struct {
+	lock       sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	lru        *list.List
+}
+
+type memoryEntry struct {
+	key    string
+	record IdempotencyRecord
+}
+
+// NewMemoryStore returns a store keeping up to maxEntries keys
+func NewMemoryStore(maxEntries int) *MemoryStore {
+	return &MemoryStore{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+func (s *MemoryStore) Lock(key string, requestId string, expiresAt time.Time) (bool, *IdempotencyRecord, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if element, ok := s.entries[key]; ok {
+		entry := element.Value.(*memoryEntry)
+		if time.Now().Before(entry.record.ExpiresAt) {
+			s.lru.MoveToFront(element)
+			record := entry.record
+			return false, &record, nil
+		}
+		s.remove(element)
+	}
+	s.set(key, IdempotencyRecord{Status: StatusInProgress, RequestId: requestId, ExpiresAt: expiresAt})
+	return true, nil, nil
+}
+
+func (s *MemoryStore) Complete(key string, response []byte, expiresAt time.Time) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var requestId string
+	if element, ok := s.entries[key]; ok {
+		requestId = element.Value.(*memoryEntry).record.RequestId
+		s.remove(element)
+	}
+	s.set(key, IdempotencyRecord{Status: StatusCompleted, RequestId: requestId, Response: response, ExpiresAt: expiresAt})
+	return nil
+}
+
+func (s *MemoryStore) Release(key string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if element, ok := s.entries[key]; ok && element.Value.(*memoryEntry).record.Status == StatusInProgress {
+		s.remove(element)
+	}
+	return nil
+}
+
+// Adds the record and evicts the least recently used keys. Expects the lock to be held
+func (s *MemoryStore) set(key string, record IdempotencyRecord) {
+	s.entries[key] = s.lru.PushFront(&memoryEntry{key: key, record: record})
+	for s.lru.Len() > s.maxEntries {
+		s.remove(s.lru.Back())
+	}
+}
+
+func (s *MemoryStore) remove(element *list.Element) {
+	s.lru.Remove(element)
+	delete(s.entries, element.Value.(*memoryEntry).key)
+}
@@ -0,0 +1,213 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"LAMBDA-RUNTIME-API-PROXY-EXTENSION-MAIN/golang-example-lambda-runtime-api-proxy-example/src/proxy"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Endpoint of DynamoDB Local the DynamodbStore tests run against, ex:
+//
+//	docker run -p 8000:8000 amazon/dynamodb-local
+//	LRAP_TEST_DYNAMODB_ENDPOINT=http://localhost:8000 go test ./src/middleware/
+const testDynamodbEndpointEnv = "LRAP_TEST_DYNAMODB_ENDPOINT"
+
+// Returns the stores the idempotency tests run against, DynamodbStore only with DynamoDB Local
+func idempotencyStores(t *testing.T) map[string]func(t *testing.T) IdempotencyStore {
+	return map[string]func(t *testing.T) IdempotencyStore{
+		"memory": func(t *testing.T) IdempotencyStore {
+			return NewMemoryStore(10)
+		},
+		"dynamodb": dynamodbLocalStore,
+	}
+}
+
+// Creates a table in DynamoDB Local, deleted at the end of the test
+func dynamodbLocalStore(t *testing.T) IdempotencyStore {
+	endpoint := os.Getenv(testDynamodbEndpointEnv)
+	if endpoint == "" {
+		t.Skipf("%s is not set, start DynamoDB Local to run this test", testDynamodbEndpointEnv)
+	}
+	client := dynamodb.New(session.Must(session.NewSession(&aws.Config{
+		Endpoint:    aws.String(endpoint),
+		Region:      aws.String("us-east-1"),
+		Credentials: credentials.NewStaticCredentials("local", "local", ""),
+	})))
+	table := fmt.Sprintf("lrap-idempotency-test-%d", time.Now().UnixNano())
+	_, err := client.CreateTable(&dynamodb.CreateTableInput{
+		TableName:            aws.String(table),
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{{AttributeName: aws.String(idAttribute), AttributeType: aws.String("S")}},
+		KeySchema:            []*dynamodb.KeySchemaElement{{AttributeName: aws.String(idAttribute), KeyType: aws.String("HASH")}},
+		BillingMode:          aws.String(dynamodb.BillingModePayPerRequest),
+	})
+	if err != nil {
+		t.Fatalf("cannot create the table in DynamoDB Local: %v", err)
+	}
+	t.Cleanup(func() {
+		client.DeleteTable(&dynamodb.DeleteTableInput{TableName: aws.String(table)})
+	})
+	return &DynamodbStore{table: table, client: client}
+}
+
+func newInvocation(requestId string, deadline time.Time) *proxy.InvocationContext {
+	return &proxy.InvocationContext{RequestId: requestId, Deadline: deadline, ReceivedAt: time.Now()}
+}
+
+func nextEvent(t *testing.T, idempotency *Idempotency, ctx *proxy.InvocationContext, body string) (proxy.Action, *proxy.Payload) {
+	t.Helper()
+	event := &proxy.Payload{Header: make(http.Header), Body: []byte(body)}
+	action, err := idempotency.OnNext(ctx, event)
+	if err != nil {
+		t.Fatalf("OnNext failed: %v", err)
+	}
+	return action, event
+}
+
+func TestIdempotency(t *testing.T) {
+	for name, newStore := range idempotencyStores(t) {
+		t.Run(name, func(t *testing.T) {
+			t.Run("lock then complete", func(t *testing.T) {
+				idempotency, _ := NewIdempotency(newStore(t), "$.orderId", time.Hour)
+				first := newInvocation("request-1", time.Now().Add(time.Minute))
+				if action, _ := nextEvent(t, idempotency, first, `{"orderId": 1}`); action != proxy.Continue {
+					t.Fatalf("first event returned %v, expected it to reach the handler", action)
+				}
+				idempotency.OnComplete(first, &proxy.Payload{Header: make(http.Header), Body: []byte(`{"total": 10}`)}, true)
+
+				// The duplicate is answered with the stored response, without reaching the handler
+				action, event := nextEvent(t, idempotency, newInvocation("request-2", time.Now().Add(time.Minute)), `{"orderId": 1, "retry": true}`)
+				if action != proxy.Respond || string(event.Body) != `{"total": 10}` {
+					t.Fatalf("duplicate returned %v %s, expected the stored response", action, event.Body)
+				}
+				if action, _ := nextEvent(t, idempotency, newInvocation("request-3", time.Now().Add(time.Minute)), `{"orderId": 2}`); action != proxy.Continue {
+					t.Fatalf("another key returned %v", action)
+				}
+			})
+
+			t.Run("in progress duplicate", func(t *testing.T) {
+				idempotency, _ := NewIdempotency(newStore(t), "", time.Hour)
+				first := newInvocation("request-1", time.Now().Add(time.Minute))
+				nextEvent(t, idempotency, first, `{"orderId": 1}`)
+
+				action, event := nextEvent(t, idempotency, newInvocation("request-2", time.Now().Add(time.Minute)), `{"orderId": 1}`)
+				if action != proxy.Reject || event.Header.Get(proxy.ErrorTypeHeader) != InProgressErrorType {
+					t.Fatalf("duplicate returned %v %s, expected an in progress error", action, event.Body)
+				}
+				// Lambda retries asynchronous invocations with the same request ID
+				if action, _ := nextEvent(t, idempotency, newInvocation("request-1", time.Now().Add(time.Minute)), `{"orderId": 1}`); action != proxy.Continue {
+					t.Fatalf("retry of the same request returned %v", action)
+				}
+			})
+
+			t.Run("release on error", func(t *testing.T) {
+				idempotency, _ := NewIdempotency(newStore(t), "", time.Hour)
+				first := newInvocation("request-1", time.Now().Add(time.Minute))
+				nextEvent(t, idempotency, first, `{"orderId": 1}`)
+				idempotency.OnComplete(first, &proxy.Payload{Header: make(http.Header), Body: []byte(`{"errorType": "Failed"}`)}, false)
+
+				if action, _ := nextEvent(t, idempotency, newInvocation("request-2", time.Now().Add(time.Minute)), `{"orderId": 1}`); action != proxy.Continue {
+					t.Fatalf("event after an error returned %v, expected it to be processed again", action)
+				}
+			})
+
+			t.Run("expired lock", func(t *testing.T) {
+				idempotency, _ := NewIdempotency(newStore(t), "", time.Hour)
+				// Timed out invocations do not block the retries, DynamoDB expirations are in seconds
+				nextEvent(t, idempotency, newInvocation("request-1", time.Now().Add(-time.Second)), `{"orderId": 1}`)
+				if action, _ := nextEvent(t, idempotency, newInvocation("request-2", time.Now().Add(time.Minute)), `{"orderId": 1}`); action != proxy.Continue {
+					t.Fatalf("event after an expired lock returned %v", action)
+				}
+			})
+		})
+	}
+}
+
+// expiryStore records the expiration of the locks
+type expiryStore struct {
+	*MemoryStore
+	expiresAt time.Time
+}
+
+func (s *expiryStore) Lock(key string, requestId string, expiresAt time.Time) (bool, *IdempotencyRecord, error) {
+	s.expiresAt = expiresAt
+	return s.MemoryStore.Lock(key, requestId, expiresAt)
+}
+
+func TestIdempotencyLockExpiry(t *testing.T) {
+	now := time.Now()
+	for _, test := range []struct {
+		name     string
+		deadline time.Time
+		expected time.Time
+	}{
+		{"deadline before the ttl", now.Add(time.Minute), now.Add(time.Minute)},
+		{"ttl before the deadline", now.Add(3 * time.Hour), now.Add(time.Hour)},
+		{"no deadline", time.Time{}, now.Add(time.Hour)},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			store := &expiryStore{MemoryStore: NewMemoryStore(10)}
+			idempotency, _ := NewIdempotency(store, "", time.Hour)
+			nextEvent(t, idempotency, newInvocation("request-1", test.deadline), `{}`)
+			if difference := store.expiresAt.Sub(test.expected); difference < -time.Second || difference > time.Second {
+				t.Fatalf("lock expires at %v, expected %v", store.expiresAt, test.expected)
+			}
+		})
+	}
+}
+
+func TestIdempotencyIgnoresEventsWithoutKey(t *testing.T) {
+	store := NewMemoryStore(10)
+	idempotency, _ := NewIdempotency(store, "$.orderId", time.Hour)
+	for _, body := range []string{`{"other": 1}`, `not json`} {
+		ctx := newInvocation("request-1", time.Now().Add(time.Minute))
+		if action, _ := nextEvent(t, idempotency, ctx, body); action != proxy.Continue {
+			t.Fatalf("event %s returned %v", body, action)
+		}
+		if _, ok := ctx.Get(idempotencyContextKey); ok {
+			t.Fatalf("event %s was locked", body)
+		}
+	}
+}
+
+func TestMemoryStoreEvictsLeastRecentlyUsed(t *testing.T) {
+	store := NewMemoryStore(2)
+	expiresAt := time.Now().Add(time.Hour)
+	store.Lock("a", "request-a", expiresAt)
+	store.Lock("b", "request-b", expiresAt)
+	// Reading a refreshes it
+	if locked, _, _ := store.Lock("a", "request-a2", expiresAt); locked {
+		t.Fatal("locked a key already locked")
+	}
+	store.Lock("c", "request-c", expiresAt)
+
+	if locked, record, _ := store.Lock("a", "request-a3", expiresAt); locked || record.RequestId != "request-a" {
+		t.Fatalf("a was evicted, or lost its request ID: %+v", record)
+	}
+	if locked, _, _ := store.Lock("b", "request-b2", expiresAt); !locked {
+		t.Fatal("b was not evicted")
+	}
+}
+
+func TestMemoryStoreCompleteKeepsRequestId(t *testing.T) {
+	store := NewMemoryStore(10)
+	store.Lock("a", "request-a", time.Now().Add(time.Minute))
+	store.Complete("a", []byte("response"), time.Now().Add(time.Hour))
+	// Completed records are not released
+	store.Release("a")
+
+	_, record, _ := store.Lock("a", "request-b", time.Now().Add(time.Minute))
+	if record == nil || record.Status != StatusCompleted || record.RequestId != "request-a" || string(record.Response) != "response" {
+		t.Fatalf("unexpected record %+v", record)
+	}
+}
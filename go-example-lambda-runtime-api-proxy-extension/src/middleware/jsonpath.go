@@ -0,0 +1,110 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package middleware
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// pathSegment is a step of a JSONPath expression
+type pathSegment struct {
+	key       string
+	index     int
+	isIndex   bool
+	wildcard  bool
+	recursive bool
+}
+
+// Parses the JSONPath subset supported by the middlewares: $.a.b, $.a[0], $.a[*], $.*, $..a and $['a b']
+func parsePath(path string) ([]pathSegment, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("path %q must start with $", path)
+	}
+
+	var segments []pathSegment
+	rest := path[1:]
+	for rest != "" {
+		recursive := false
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			recursive = true
+			rest = rest[2:]
+		case rest[0] == '.':
+			rest = rest[1:]
+		case rest[0] == '[':
+		default:
+			return nil, fmt.Errorf("invalid path %q near %q", path, rest)
+		}
+
+		if strings.HasPrefix(rest, "[") {
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("invalid path %q, missing ]", path)
+			}
+			selector := rest[1:end]
+			rest = rest[end+1:]
+			segment := pathSegment{recursive: recursive}
+			switch {
+			case selector == "*":
+				segment.wildcard = true
+			case len(selector) >= 2 && (selector[0] == '\'' || selector[0] == '"') && selector[len(selector)-1] == selector[0]:
+				segment.key = selector[1 : len(selector)-1]
+			default:
+				index, err := strconv.Atoi(selector)
+				if err != nil || index < 0 {
+					return nil, fmt.Errorf("invalid path %q, unsupported selector [%s]", path, selector)
+				}
+				segment.index = index
+				segment.isIndex = true
+			}
+			segments = append(segments, segment)
+			continue
+		}
+
+		end := strings.IndexAny(rest, ".[")
+		if end < 0 {
+			end = len(rest)
+		}
+		name := rest[:end]
+		rest = rest[end:]
+		if name == "" {
+			return nil, fmt.Errorf("invalid path %q, empty key", path)
+		}
+		segments = append(segments, pathSegment{key: name, wildcard: name == "*", recursive: recursive})
+	}
+	return segments, nil
+}
+
+// Calls replace with every value matched by the path and stores what it returns in place.
+// Returns the root, which is only different from node when the path is $
+func replacePath(node interface{}, segments []pathSegment, replace func(interface{}) interface{}) interface{} {
+	if len(segments) == 0 {
+		return replace(node)
+	}
+
+	segment, rest := segments[0], segments[1:]
+	switch value := node.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			if segment.recursive {
+				value[key] = replacePath(child, segments, replace)
+			}
+			if !segment.isIndex && (segment.wildcard || segment.key == key) {
+				value[key] = replacePath(value[key], rest, replace)
+			}
+		}
+	case []interface{}:
+		for idx, child := range value {
+			if segment.recursive {
+				value[idx] = replacePath(child, segments, replace)
+			}
+			if segment.wildcard || (segment.isIndex && segment.index == idx) {
+				value[idx] = replacePath(value[idx], rest, replace)
+			}
+		}
+	}
+	return node
+}
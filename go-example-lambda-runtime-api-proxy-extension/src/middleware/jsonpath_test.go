@@ -0,0 +1,80 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package middleware
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePath(t *testing.T) {
+	for _, test := range []struct {
+		path     string
+		segments []pathSegment
+		err      string
+	}{
+		{"$", nil, ""},
+		{"$.a.b", []pathSegment{{key: "a"}, {key: "b"}}, ""},
+		{"$.a[0]", []pathSegment{{key: "a"}, {index: 0, isIndex: true}}, ""},
+		{"$.a[*]", []pathSegment{{key: "a"}, {wildcard: true}}, ""},
+		{"$.*", []pathSegment{{key: "*", wildcard: true}}, ""},
+		{"$..a", []pathSegment{{key: "a", recursive: true}}, ""},
+		{"$['a b'][\"c\"]", []pathSegment{{key: "a b"}, {key: "c"}}, ""},
+		{"a.b", nil, "must start with $"},
+		{"$a", nil, "near"},
+		{"$.a[0", nil, "missing ]"},
+		{"$.a[-1]", nil, "unsupported selector [-1]"},
+		{"$.a[b]", nil, "unsupported selector [b]"},
+		{"$.a..", nil, "empty key"},
+	} {
+		t.Run(test.path, func(t *testing.T) {
+			segments, err := parsePath(test.path)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("parsed %+v with error %v, expected %q", segments, err, test.err)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(segments, test.segments) {
+				t.Fatalf("parsed %+v, %v, expected %+v", segments, err, test.segments)
+			}
+		})
+	}
+}
+
+func TestReplacePath(t *testing.T) {
+	document := `{"a": {"b": 1, "c": [1, 2]}, "d": [{"b": 2}, {"e": {"b": 3}}], "a b": 4}`
+	for _, test := range []struct {
+		path     string
+		expected string
+	}{
+		{"$", `"x"`},
+		{"$.a.b", `{"a":{"b":"x","c":[1,2]},"a b":4,"d":[{"b":2},{"e":{"b":3}}]}`},
+		{"$.a.c[1]", `{"a":{"b":1,"c":[1,"x"]},"a b":4,"d":[{"b":2},{"e":{"b":3}}]}`},
+		{"$.d[*].b", `{"a":{"b":1,"c":[1,2]},"a b":4,"d":[{"b":"x"},{"e":{"b":3}}]}`},
+		{"$.*", `{"a":"x","a b":"x","d":"x"}`},
+		{"$..b", `{"a":{"b":"x","c":[1,2]},"a b":4,"d":[{"b":"x"},{"e":{"b":"x"}}]}`},
+		{"$['a b']", `{"a":{"b":1,"c":[1,2]},"a b":"x","d":[{"b":2},{"e":{"b":3}}]}`},
+		{"$.missing.b", `{"a":{"b":1,"c":[1,2]},"a b":4,"d":[{"b":2},{"e":{"b":3}}]}`},
+		{"$.a[0]", `{"a":{"b":1,"c":[1,2]},"a b":4,"d":[{"b":2},{"e":{"b":3}}]}`},
+	} {
+		t.Run(test.path, func(t *testing.T) {
+			segments, err := parsePath(test.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			root, err := decodeJson([]byte(document))
+			if err != nil {
+				t.Fatal(err)
+			}
+			root = replacePath(root, segments, func(value interface{}) interface{} {
+				return "x"
+			})
+			if body, _ := encodeJson(root); string(body) != test.expected {
+				t.Fatalf("replaced %s, expected %s", body, test.expected)
+			}
+		})
+	}
+}
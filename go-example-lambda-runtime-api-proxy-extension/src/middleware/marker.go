@@ -0,0 +1,64 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package middleware
+
+import (
+	"encoding/json"
+
+	"LAMBDA-RUNTIME-API-PROXY-EXTENSION-MAIN/golang-example-lambda-runtime-api-proxy-example/src/proxy"
+)
+
+const (
+	printPrefix = "[LRAP:Middleware]"
+
+	// Keys added by the Marker to JSON events and responses
+	RequestMarkerKey  = "LRAP RequestModified"
+	ResponseMarkerKey = "LRAP ResponseModified"
+)
+
+// Marker is a sample middleware that flags the events and responses that went through the proxy
+type Marker struct {
+	proxy.BaseMiddleware
+}
+
+// NewMarker returns the sample Marker middleware
+func NewMarker() *Marker {
+	return &Marker{}
+}
+
+// Assumes body is a JSON object. Expand as needed
+func (m *Marker) OnNext(ctx *proxy.InvocationContext, event *proxy.Payload) (proxy.Action, error) {
+	return proxy.Continue, setJsonKey(event, RequestMarkerKey)
+}
+
+// Assumes body is a JSON object. Expand as needed
+func (m *Marker) OnResponse(ctx *proxy.InvocationContext, response *proxy.Payload) (proxy.Action, error) {
+	return proxy.Continue, setJsonKey(response, ResponseMarkerKey)
+}
+
+// Adds a key to a JSON object body, the original body is kept if it is not a JSON object
+func setJsonKey(payload *proxy.Payload, key string) error {
+	jsonBody, err := unmarshalBody(payload.Body)
+	if err != nil {
+		return err
+	}
+
+	jsonBody[key] = true
+
+	newBody, err := json.Marshal(jsonBody)
+	if err != nil {
+		return err
+	}
+	payload.Body = newBody
+	return nil
+}
+
+func unmarshalBody(body []byte) (map[string]interface{}, error) {
+	var temp = make(map[string]interface{})
+	err := json.Unmarshal(body, &temp)
+	if err != nil {
+		return nil, err
+	}
+	return temp, nil
+}
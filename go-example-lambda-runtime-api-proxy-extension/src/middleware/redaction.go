@@ -0,0 +1,443 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"LAMBDA-RUNTIME-API-PROXY-EXTENSION-MAIN/golang-example-lambda-runtime-api-proxy-example/src/proxy"
+)
+
+// Lambda environment variables configuring the redaction middleware
+const (
+	RedactionRulesEnv     = "LRAP_REDACTION_RULES"
+	RedactionRulesFileEnv = "LRAP_REDACTION_RULES_FILE"
+	RedactionModeEnv      = "LRAP_REDACTION_MODE"
+	// Set to true when the function streams its responses, which cannot be redacted
+	ResponseStreamingEnv = "LRAP_RESPONSE_STREAMING"
+
+	// RedactMode replaces the matches, ReportMode only counts them
+	RedactMode = "redact"
+	ReportMode = "report"
+
+	// Payloads a rule applies to. Responses include invocation and init errors
+	TargetEvent    = "event"
+	TargetResponse = "response"
+	TargetAll      = "all"
+
+	defaultReplacement = "[REDACTED]"
+
+	redactionStreamKey = "redaction.stream"
+)
+
+// Patterns that can be referenced by name with the "builtin" field of a rule
+var builtinPatterns = map[string]string{
+	"email":        `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`,
+	"creditcard":   `\b(?:\d[ -]?){12,18}\d\b`,
+	"bearer":       `(?i)\bbearer\s+[A-Za-z0-9\-._~+/]+=*`,
+	"jwt":          `\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`,
+	"awsaccesskey": `\b(?:AKIA|ASIA)[A-Z0-9]{16}\b`,
+}
+
+// RedactionRule matches values to scrub. Keys matches object keys anywhere in the payload and
+// replaces their whole value, Path replaces the values it selects, and Pattern (or Builtin)
+// replaces the matching substrings of every string, restricted to Path when both are set
+type RedactionRule struct {
+	Name        string   `json:"name"`
+	Builtin     string   `json:"builtin"`
+	Pattern     string   `json:"pattern"`
+	Keys        []string `json:"keys"`
+	Path        string   `json:"path"`
+	Replacement string   `json:"replacement"`
+	Target      string   `json:"target"`
+
+	regex *regexp.Regexp
+	path  []pathSegment
+	keys  map[string]bool
+}
+
+// Redaction scrubs PII and secrets from events before the handler sees them, and from responses
+// before they are posted to the Runtime API. In report mode payloads are left untouched and only
+// the matches are counted
+type Redaction struct {
+	proxy.BaseMiddleware
+	rules  []*RedactionRule
+	report bool
+
+	lock   sync.Mutex
+	counts map[string]int64
+}
+
+// NewRedaction validates the rules and returns the redaction middleware
+func NewRedaction(rules []*RedactionRule, mode string) (*Redaction, error) {
+	switch mode {
+	case "", RedactMode:
+	case ReportMode:
+	default:
+		return nil, fmt.Errorf("invalid redaction mode %q, expected %s or %s", mode, RedactMode, ReportMode)
+	}
+
+	for idx, rule := range rules {
+		if err := rule.compile(); err != nil {
+			return nil, fmt.Errorf("redaction rule %d: %v", idx, err)
+		}
+	}
+	return &Redaction{
+		rules:  rules,
+		report: mode == ReportMode,
+		counts: make(map[string]int64),
+	}, nil
+}
+
+// NewRedactionFromEnv reads the rules from "LRAP_REDACTION_RULES", a JSON array, or from the
+// JSON file in "LRAP_REDACTION_RULES_FILE". Returns nil when no rules are configured. Rules
+// targeting responses are rejected when "LRAP_RESPONSE_STREAMING" declares streamed responses
+func NewRedactionFromEnv() (*Redaction, error) {
+	streaming := false
+	if value := os.Getenv(ResponseStreamingEnv); value != "" {
+		var err error
+		if streaming, err = strconv.ParseBool(value); err != nil {
+			return nil, fmt.Errorf("invalid %s %q, expected true or false", ResponseStreamingEnv, value)
+		}
+	}
+
+	data := []byte(os.Getenv(RedactionRulesEnv))
+	if fileName := os.Getenv(RedactionRulesFileEnv); len(data) == 0 && fileName != "" {
+		var err error
+		data, err = os.ReadFile(fileName)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read redaction rules: %v", err)
+		}
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, nil
+	}
+
+	var rules []*RedactionRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("invalid redaction rules: %v", err)
+	}
+	redaction, err := NewRedaction(rules, strings.ToLower(os.Getenv(RedactionModeEnv)))
+	if err != nil {
+		return nil, err
+	}
+	if streaming {
+		for _, rule := range redaction.rules {
+			if rule.Target != TargetEvent {
+				return nil, fmt.Errorf("redaction rule %s targets %s but streamed responses cannot be redacted, set its target to %s", rule.Name, rule.Target, TargetEvent)
+			}
+		}
+	}
+	return redaction, nil
+}
+
+// Counts returns the number of matches per rule since the extension started
+func (r *Redaction) Counts() map[string]int64 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	counts := make(map[string]int64, len(r.counts))
+	for name, count := range r.counts {
+		counts[name] = count
+	}
+	return counts
+}
+
+func (r *Redaction) OnNext(ctx *proxy.InvocationContext, event *proxy.Payload) (proxy.Action, error) {
+	return proxy.Continue, r.apply(ctx.RequestId, "event", TargetEvent, event)
+}
+
+func (r *Redaction) OnResponse(ctx *proxy.InvocationContext, response *proxy.Payload) (proxy.Action, error) {
+	return proxy.Continue, r.apply(ctx.RequestId, "response", TargetResponse, response)
+}
+
+func (r *Redaction) OnInvokeError(ctx *proxy.InvocationContext, invokeError *proxy.Payload) (proxy.Action, error) {
+	return proxy.Continue, r.apply(ctx.RequestId, "error", TargetResponse, invokeError)
+}
+
+func (r *Redaction) OnInitError(initError *proxy.Payload) (proxy.Action, error) {
+	return proxy.Continue, r.apply("", "init error", TargetResponse, initError)
+}
+
+// OnResponseChunk warns once per invocation that a streamed response is forwarded as it is. The
+// chunks cannot be changed by observers, and a match can span two of them. Declaring streamed
+// responses with "LRAP_RESPONSE_STREAMING" rejects such rules at init instead
+func (r *Redaction) OnResponseChunk(ctx *proxy.InvocationContext, chunk []byte) {
+	if !r.hasRules(TargetResponse) {
+		return
+	}
+	if _, warned := ctx.Get(redactionStreamKey); warned {
+		return
+	}
+	ctx.Set(redactionStreamKey, true)
+	println(printPrefix, "Warning: streamed response for requestID:", ctx.RequestId, "is forwarded without redaction")
+}
+
+func (r *Redaction) OnResponseEnd(ctx *proxy.InvocationContext, trailer http.Header, err error) {
+}
+
+// Tells if a rule applies to the target
+func (r *Redaction) hasRules(target string) bool {
+	for _, rule := range r.rules {
+		if rule.Target == TargetAll || rule.Target == target {
+			return true
+		}
+	}
+	return false
+}
+
+// Runs the rules of the target against the payload and records the matches
+func (r *Redaction) apply(requestId string, kind string, target string, payload *proxy.Payload) error {
+	counts := make(map[string]int64)
+	body, err := r.scrub(target, payload.Body, counts)
+	if len(counts) > 0 {
+		r.record(requestId, kind, counts)
+	}
+	if err != nil || r.report {
+		return err
+	}
+	payload.Body = body
+	return nil
+}
+
+// Scrub applies the rules of the target ("event" or "response") to a copy of the payload body,
+// in both modes and without recording the matches. Used to keep captured payloads clean
+func (r *Redaction) Scrub(target string, body []byte) ([]byte, error) {
+	return r.scrub(target, body, make(map[string]int64))
+}
+
+// Returns the scrubbed body. JSON bodies are scrubbed value by value so that they stay valid
+// JSON, other bodies only go through the patterns
+func (r *Redaction) scrub(target string, body []byte, counts map[string]int64) ([]byte, error) {
+	var rules []*RedactionRule
+	for _, rule := range r.rules {
+		if rule.Target == TargetAll || rule.Target == target {
+			rules = append(rules, rule)
+		}
+	}
+	if len(rules) == 0 || len(body) == 0 {
+		return body, nil
+	}
+
+	document, err := decodeJson(body)
+	if err != nil {
+		text := string(body)
+		for _, rule := range rules {
+			if rule.regex != nil && rule.path == nil {
+				text = rule.replaceString(text, counts)
+			}
+		}
+		if len(counts) == 0 {
+			return body, nil
+		}
+		return []byte(text), nil
+	}
+
+	for _, rule := range rules {
+		document = rule.applyJson(document, counts)
+	}
+	if len(counts) == 0 {
+		return body, nil
+	}
+	return encodeJson(document)
+}
+
+// Adds the matches of a payload to the totals and logs them, without the matched values
+func (r *Redaction) record(requestId string, kind string, counts map[string]int64) {
+	var names []string
+	r.lock.Lock()
+	for name, count := range counts {
+		r.counts[name] += count
+		names = append(names, fmt.Sprintf("%s=%d", name, count))
+	}
+	r.lock.Unlock()
+	sort.Strings(names)
+
+	verb := "Redacted"
+	if r.report {
+		verb = "Found"
+	}
+	println(printPrefix, verb, "matches in", kind, "for requestID:", requestId, strings.Join(names, " "))
+}
+
+// Validates the rule and compiles its pattern and path
+func (rule *RedactionRule) compile() error {
+	if rule.Builtin != "" {
+		pattern, ok := builtinPatterns[strings.ToLower(rule.Builtin)]
+		if !ok {
+			return fmt.Errorf("unknown builtin %q", rule.Builtin)
+		}
+		if rule.Pattern != "" {
+			return fmt.Errorf("builtin and pattern are mutually exclusive")
+		}
+		rule.Pattern = pattern
+		if rule.Name == "" {
+			rule.Name = strings.ToLower(rule.Builtin)
+		}
+	}
+	if rule.Pattern == "" && rule.Path == "" && len(rule.Keys) == 0 {
+		return fmt.Errorf("one of builtin, pattern, keys or path is required")
+	}
+	if rule.Pattern != "" && len(rule.Keys) > 0 {
+		return fmt.Errorf("keys cannot be combined with a pattern")
+	}
+	if rule.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+
+	switch strings.ToLower(rule.Target) {
+	case "":
+		rule.Target = TargetAll
+	case TargetEvent, TargetResponse, TargetAll:
+		rule.Target = strings.ToLower(rule.Target)
+	default:
+		return fmt.Errorf("invalid target %q, expected %s, %s or %s", rule.Target, TargetEvent, TargetResponse, TargetAll)
+	}
+	if rule.Replacement == "" {
+		rule.Replacement = defaultReplacement
+	}
+
+	if rule.Pattern != "" {
+		regex, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern: %v", err)
+		}
+		rule.regex = regex
+	}
+	if rule.Path != "" {
+		path, err := parsePath(rule.Path)
+		if err != nil {
+			return err
+		}
+		rule.path = path
+	}
+	if len(rule.Keys) > 0 {
+		rule.keys = make(map[string]bool)
+		for _, key := range rule.Keys {
+			rule.keys[strings.ToLower(key)] = true
+		}
+	}
+	return nil
+}
+
+// Applies the rule to a decoded JSON document and returns the new root
+func (rule *RedactionRule) applyJson(document interface{}, counts map[string]int64) interface{} {
+	switch {
+	case rule.keys != nil:
+		return rule.replaceKeys(document, counts)
+	case rule.path != nil && rule.regex != nil:
+		return replacePath(document, rule.path, func(value interface{}) interface{} {
+			return rule.replaceStrings(value, counts)
+		})
+	case rule.path != nil:
+		return replacePath(document, rule.path, func(value interface{}) interface{} {
+			counts[rule.Name]++
+			return rule.Replacement
+		})
+	default:
+		return rule.replaceStrings(document, counts)
+	}
+}
+
+// Replaces the value of every matching key, at any depth
+func (rule *RedactionRule) replaceKeys(node interface{}, counts map[string]int64) interface{} {
+	switch value := node.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			if rule.keys[strings.ToLower(key)] {
+				counts[rule.Name]++
+				value[key] = rule.Replacement
+				continue
+			}
+			value[key] = rule.replaceKeys(child, counts)
+		}
+	case []interface{}:
+		for idx, child := range value {
+			value[idx] = rule.replaceKeys(child, counts)
+		}
+	}
+	return node
+}
+
+// Runs the pattern against every string value below node
+func (rule *RedactionRule) replaceStrings(node interface{}, counts map[string]int64) interface{} {
+	switch value := node.(type) {
+	case string:
+		return rule.replaceString(value, counts)
+	case map[string]interface{}:
+		for key, child := range value {
+			value[key] = rule.replaceStrings(child, counts)
+		}
+	case []interface{}:
+		for idx, child := range value {
+			value[idx] = rule.replaceStrings(child, counts)
+		}
+	}
+	return node
+}
+
+func (rule *RedactionRule) replaceString(text string, counts map[string]int64) string {
+	return rule.regex.ReplaceAllStringFunc(text, func(match string) string {
+		// Card number patterns match any long digit sequence, only keep the valid ones
+		if rule.Builtin != "" && strings.ToLower(rule.Builtin) == "creditcard" && !isLuhn(match) {
+			return match
+		}
+		counts[rule.Name]++
+		return rule.Replacement
+	})
+}
+
+// Checks the Luhn checksum of a card number, ignoring separators
+func isLuhn(number string) bool {
+	sum, digits := 0, 0
+	for idx := len(number) - 1; idx >= 0; idx-- {
+		c := number[idx]
+		if c < '0' || c > '9' {
+			continue
+		}
+		digit := int(c - '0')
+		if digits%2 == 1 {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		digits++
+	}
+	return digits >= 13 && sum%10 == 0
+}
+
+// Decodes a JSON body keeping numbers as they were sent
+func decodeJson(body []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var document interface{}
+	if err := decoder.Decode(&document); err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("unexpected data after JSON value")
+	}
+	return document, nil
+}
+
+// Encodes a JSON body without escaping HTML characters
+func encodeJson(document interface{}) ([]byte, error) {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(document); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buffer.Bytes(), "\n"), nil
+}
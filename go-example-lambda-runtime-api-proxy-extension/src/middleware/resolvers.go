@@ -0,0 +1,161 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package middleware
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/appconfigdata"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/ssm"
+)
+
+// Schemes of the references resolved by the enrichment middleware, ex: ssm:/app/db/url
+const (
+	SsmScheme            = "ssm"
+	SecretsManagerScheme = "secretsmanager"
+	AppConfigScheme      = "appconfig"
+
+	// Shortest interval AppConfig accepts between two reads of a configuration session
+	appConfigPollInterval = 15 * time.Second
+)
+
+// Resolver fetches the value a reference points to, ex: the name of an SSM parameter.
+// Implement it with local stubs to run the enrichment without AWS
+type Resolver interface {
+	Resolve(name string) (string, error)
+}
+
+// NewAwsResolvers returns the SSM, Secrets Manager and AppConfig resolvers, in the function region
+func NewAwsResolvers() (map[string]Resolver, error) {
+	sess, err := session.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]Resolver{
+		SsmScheme:            &SsmResolver{client: ssm.New(sess)},
+		SecretsManagerScheme: &SecretsManagerResolver{client: secretsmanager.New(sess)},
+		AppConfigScheme:      &AppConfigResolver{client: appconfigdata.New(sess), sessions: make(map[string]*appConfigSession)},
+	}, nil
+}
+
+// SsmResolver reads SSM parameters, SecureString parameters are decrypted
+type SsmResolver struct {
+	client *ssm.SSM
+}
+
+func (r *SsmResolver) Resolve(name string) (string, error) {
+	output, err := r.client.GetParameter(&ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(output.Parameter.Value), nil
+}
+
+// SecretsManagerResolver reads the current version of a secret, by name or ARN
+type SecretsManagerResolver struct {
+	client *secretsmanager.SecretsManager
+}
+
+func (r *SecretsManagerResolver) Resolve(name string) (string, error) {
+	output, err := r.client.GetSecretValue(&secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(name),
+	})
+	if err != nil {
+		return "", err
+	}
+	if output.SecretString == nil {
+		return "", fmt.Errorf("secret %s is binary, only string secrets are supported", name)
+	}
+	return aws.StringValue(output.SecretString), nil
+}
+
+// AppConfigResolver reads a configuration profile defined as "<application>/<environment>/<profile>".
+// A configuration session is started on the first read of a profile, AppConfig then only returns
+// the content when it has changed. The session is started again after an error, ex: when its token
+// expired
+type AppConfigResolver struct {
+	client *appconfigdata.AppConfigData
+
+	lock     sync.Mutex
+	sessions map[string]*appConfigSession
+}
+
+// appConfigSession is the configuration session of a profile
+type appConfigSession struct {
+	// token is the next poll token, empty until a session is started
+	token      string
+	nextPollAt time.Time
+	content    string
+}
+
+func (r *AppConfigResolver) Resolve(name string) (string, error) {
+	identifiers := strings.Split(name, "/")
+	if len(identifiers) != 3 {
+		return "", fmt.Errorf("invalid AppConfig profile %q, expected <application>/<environment>/<profile>", name)
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	state, ok := r.sessions[name]
+	if !ok {
+		state = &appConfigSession{}
+		r.sessions[name] = state
+	}
+	// AppConfig rejects the reads before the poll interval
+	isNewSession := state.token == ""
+	if !isNewSession && time.Now().Before(state.nextPollAt) {
+		return state.content, nil
+	}
+	if isNewSession {
+		started, err := r.client.StartConfigurationSession(&appconfigdata.StartConfigurationSessionInput{
+			ApplicationIdentifier:                aws.String(identifiers[0]),
+			EnvironmentIdentifier:                aws.String(identifiers[1]),
+			ConfigurationProfileIdentifier:       aws.String(identifiers[2]),
+			RequiredMinimumPollIntervalInSeconds: aws.Int64(int64(appConfigPollInterval / time.Second)),
+		})
+		if err != nil {
+			return "", err
+		}
+		state.token = aws.StringValue(started.InitialConfigurationToken)
+	}
+
+	output, err := r.client.GetLatestConfiguration(&appconfigdata.GetLatestConfigurationInput{
+		ConfigurationToken: aws.String(state.token),
+	})
+	if err != nil {
+		state.token = ""
+		return "", err
+	}
+	state.token = aws.StringValue(output.NextPollConfigurationToken)
+	interval := time.Duration(aws.Int64Value(output.NextPollIntervalInSeconds)) * time.Second
+	if interval < appConfigPollInterval {
+		interval = appConfigPollInterval
+	}
+	state.nextPollAt = time.Now().Add(interval)
+	// An empty configuration means it did not change since the last read of the session
+	if len(output.Configuration) > 0 || isNewSession {
+		state.content = string(output.Configuration)
+	}
+	return state.content, nil
+}
+
+// StaticResolver resolves references from a map, ex: stubs loaded from a local file
+type StaticResolver map[string]string
+
+func (r StaticResolver) Resolve(name string) (string, error) {
+	value, ok := r[name]
+	if !ok {
+		return "", fmt.Errorf("no stub for %s", name)
+	}
+	return value, nil
+}
@@ -0,0 +1,110 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/appconfigdata"
+)
+
+// appConfigData emulates the AppConfig data plane: every session starts with the token "start",
+// and each token is answered with its configuration and the next token. Unknown tokens are rejected
+type appConfigData struct {
+	configurations map[string]string
+	calls          []string
+}
+
+func (a *appConfigData) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "POST" && r.URL.Path == "/configurationsessions" {
+		body, _ := io.ReadAll(r.Body)
+		a.calls = append(a.calls, "start")
+		if !strings.Contains(string(body), `"ApplicationIdentifier":"orders"`) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"InitialConfigurationToken": "start"}`)
+		return
+	}
+	token := r.URL.Query().Get("configuration_token")
+	a.calls = append(a.calls, token)
+	configuration, ok := a.configurations[token]
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"Message": "expired token"}`)
+		return
+	}
+	w.Header().Set("Next-Poll-Configuration-Token", "after-"+token)
+	w.Header().Set("Next-Poll-Interval-In-Seconds", "15")
+	io.WriteString(w, configuration)
+}
+
+func TestAppConfigResolver(t *testing.T) {
+	data := &appConfigData{configurations: map[string]string{
+		"start":                   `{"flag": 1}`,
+		"after-start":             "",
+		"after-after-start":       `{"flag": 2}`,
+		"after-after-after-start": "",
+	}}
+	server := httptest.NewServer(data)
+	defer server.Close()
+	resolver := &AppConfigResolver{
+		client: appconfigdata.New(session.Must(session.NewSession(&aws.Config{
+			Endpoint:    aws.String(server.URL),
+			Region:      aws.String("us-east-1"),
+			Credentials: credentials.NewStaticCredentials("test", "test", ""),
+			MaxRetries:  aws.Int(0),
+		}))),
+		sessions: make(map[string]*appConfigSession),
+	}
+	poll := func(expected string) {
+		t.Helper()
+		// Skips the poll interval
+		if state, ok := resolver.sessions["orders/prod/flags"]; ok {
+			state.nextPollAt = time.Time{}
+		}
+		if value, err := resolver.Resolve("orders/prod/flags"); err != nil || value != expected {
+			t.Fatalf("resolved %q, %v, expected %q", value, err, expected)
+		}
+	}
+
+	poll(`{"flag": 1}`)
+	// Reads within the poll interval are answered from the session
+	if value, _ := resolver.Resolve("orders/prod/flags"); value != `{"flag": 1}` || len(data.calls) != 2 {
+		t.Fatalf("resolved %q after calls %v, expected the content of the session", value, data.calls)
+	}
+	// An empty configuration did not change, the next poll tokens are chained
+	poll(`{"flag": 1}`)
+	poll(`{"flag": 2}`)
+	poll(`{"flag": 2}`)
+	expected := []string{"start", "start", "after-start", "after-after-start", "after-after-after-start"}
+	if !reflect.DeepEqual(data.calls, expected) {
+		t.Fatalf("called %v, expected %v", data.calls, expected)
+	}
+
+	// The session is started again after an error
+	resolver.sessions["orders/prod/flags"].nextPollAt = time.Time{}
+	if _, err := resolver.Resolve("orders/prod/flags"); err == nil {
+		t.Fatal("expired token returned no error")
+	}
+	poll(`{"flag": 1}`)
+	if calls := data.calls[len(expected)+1:]; !reflect.DeepEqual(calls, []string{"start", "start"}) {
+		t.Fatalf("called %v after the error, expected a new session", calls)
+	}
+
+	if _, err := resolver.Resolve("orders/flags"); err == nil {
+		t.Fatal("resolved an invalid profile")
+	}
+}
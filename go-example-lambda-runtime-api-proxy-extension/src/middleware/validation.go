@@ -0,0 +1,150 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package middleware
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"LAMBDA-RUNTIME-API-PROXY-EXTENSION-MAIN/golang-example-lambda-runtime-api-proxy-example/src/proxy"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// Lambda environment variables configuring the validation middleware. Schemas are a path to a
+// JSON Schema file, which can $ref files next to it, or the schema itself inline
+const (
+	EventSchemaEnv      = "LRAP_EVENT_SCHEMA"
+	ResponseSchemaEnv   = "LRAP_RESPONSE_SCHEMA"
+	ValidationModeEnv   = "LRAP_VALIDATION_MODE"
+	ValidationReject    = "reject"
+	ValidationLog       = "log"
+	InvalidEventType    = "Proxy.InvalidEvent"
+	InvalidResponseType = "Proxy.InvalidResponse"
+
+	maxValidationErrors = 10
+)
+
+// Validation checks events and responses against JSON Schemas. In reject mode an invalid event
+// never reaches the handler and is posted as an invocation error, and an invalid response is
+// posted as an invocation error instead. In log mode violations are only logged
+type Validation struct {
+	proxy.BaseMiddleware
+	event    *jsonschema.Schema
+	response *jsonschema.Schema
+	reject   bool
+}
+
+// NewValidationFromEnv compiles the schemas from "LRAP_EVENT_SCHEMA" and "LRAP_RESPONSE_SCHEMA".
+// Returns nil when neither is set
+func NewValidationFromEnv() (*Validation, error) {
+	eventSchema := os.Getenv(EventSchemaEnv)
+	responseSchema := os.Getenv(ResponseSchemaEnv)
+	if eventSchema == "" && responseSchema == "" {
+		return nil, nil
+	}
+
+	validation := &Validation{}
+	switch mode := strings.ToLower(os.Getenv(ValidationModeEnv)); mode {
+	case "", ValidationReject:
+		validation.reject = true
+	case ValidationLog:
+	default:
+		return nil, fmt.Errorf("invalid %s env variable %q, expected %s or %s", ValidationModeEnv, mode, ValidationReject, ValidationLog)
+	}
+
+	var err error
+	if eventSchema != "" {
+		if validation.event, err = compileSchema("event.json", eventSchema); err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", EventSchemaEnv, err)
+		}
+	}
+	if responseSchema != "" {
+		if validation.response, err = compileSchema("response.json", responseSchema); err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", ResponseSchemaEnv, err)
+		}
+	}
+	return validation, nil
+}
+
+func (v *Validation) OnNext(ctx *proxy.InvocationContext, event *proxy.Payload) (proxy.Action, error) {
+	if v.event == nil {
+		return proxy.Continue, nil
+	}
+	return v.validate(ctx.RequestId, "event", InvalidEventType, v.event, event), nil
+}
+
+func (v *Validation) OnResponse(ctx *proxy.InvocationContext, response *proxy.Payload) (proxy.Action, error) {
+	if v.response == nil {
+		return proxy.Continue, nil
+	}
+	return v.validate(ctx.RequestId, "response", InvalidResponseType, v.response, response), nil
+}
+
+// Validates the body and replaces it with a validation error when it must be rejected
+func (v *Validation) validate(requestId string, kind string, errorType string, schema *jsonschema.Schema, payload *proxy.Payload) proxy.Action {
+	problems := validateBody(schema, payload.Body)
+	if len(problems) == 0 {
+		return proxy.Continue
+	}
+
+	message := fmt.Sprintf("%s does not match the schema: %s", kind, strings.Join(problems, "; "))
+	println(printPrefix, "Invalid", kind, "for requestID:", requestId, message)
+	if !v.reject {
+		return proxy.Continue
+	}
+	payload.SetError(errorType, message)
+	return proxy.Reject
+}
+
+// Returns the violations of the body as "<instance location>: <message>"
+func validateBody(schema *jsonschema.Schema, body []byte) []string {
+	document, err := decodeJson(body)
+	if err != nil {
+		return []string{"body is not valid JSON: " + err.Error()}
+	}
+
+	err = schema.Validate(document)
+	if err == nil {
+		return nil
+	}
+	validationError, ok := err.(*jsonschema.ValidationError)
+	if !ok {
+		return []string{err.Error()}
+	}
+
+	var problems []string
+	collectProblems(validationError, &problems)
+	if len(problems) > maxValidationErrors {
+		problems = append(problems[:maxValidationErrors], fmt.Sprintf("and %d more", len(problems)-maxValidationErrors))
+	}
+	return problems
+}
+
+// Keeps the leaves of the error tree, they carry the precise location of each violation
+func collectProblems(validationError *jsonschema.ValidationError, problems *[]string) {
+	if len(validationError.Causes) == 0 {
+		location := validationError.InstanceLocation
+		if location == "" {
+			location = "/"
+		}
+		*problems = append(*problems, fmt.Sprintf("%s: %s", location, validationError.Message))
+		return
+	}
+	for _, cause := range validationError.Causes {
+		collectProblems(cause, problems)
+	}
+}
+
+// Compiles an inline schema, or the schema file at the given path
+func compileSchema(name string, schema string) (*jsonschema.Schema, error) {
+	if strings.HasPrefix(strings.TrimSpace(schema), "{") {
+		compiler := jsonschema.NewCompiler()
+		if err := compiler.AddResource(name, strings.NewReader(schema)); err != nil {
+			return nil, err
+		}
+		return compiler.Compile(name)
+	}
+	return jsonschema.Compile(schema)
+}
@@ -0,0 +1,189 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"LAMBDA-RUNTIME-API-PROXY-EXTENSION-MAIN/golang-example-lambda-runtime-api-proxy-example/src/proxy"
+)
+
+const orderSchema = `{
+	"type": "object",
+	"required": ["orderId", "items"],
+	"properties": {
+		"orderId": {"type": "integer"},
+		"items": {"type": "array", "items": {"type": "object", "properties": {"qty": {"type": "integer", "minimum": 1}}}}
+	}
+}`
+
+const totalSchema = `{"type": "object", "required": ["total"], "properties": {"total": {"type": "number"}}}`
+
+func newTestValidation(t *testing.T, eventSchema string, responseSchema string, mode string) *Validation {
+	t.Helper()
+	t.Setenv(EventSchemaEnv, eventSchema)
+	t.Setenv(ResponseSchemaEnv, responseSchema)
+	t.Setenv(ValidationModeEnv, mode)
+	validation, err := NewValidationFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return validation
+}
+
+// Returns the error type and message of a rejected payload
+func invocationError(t *testing.T, payload *proxy.Payload) (string, string) {
+	t.Helper()
+	var document struct {
+		ErrorType    string `json:"errorType"`
+		ErrorMessage string `json:"errorMessage"`
+	}
+	if err := json.Unmarshal(payload.Body, &document); err != nil {
+		t.Fatalf("rejected payload %s is not an invocation error: %v", payload.Body, err)
+	}
+	if header := payload.Header.Get(proxy.ErrorTypeHeader); header != document.ErrorType {
+		t.Fatalf("error type header %q, expected %q", header, document.ErrorType)
+	}
+	return document.ErrorType, document.ErrorMessage
+}
+
+func TestValidationRejectsEvents(t *testing.T) {
+	validation := newTestValidation(t, orderSchema, "", "")
+	for _, test := range []struct {
+		name    string
+		event   string
+		message string
+	}{
+		{"valid", `{"orderId": 1, "items": [{"qty": 2}]}`, ""},
+		{"minimum", `{"orderId": 1, "items": [{"qty": 0}]}`, "event does not match the schema: /items/0/qty: must be >= 1 but found 0"},
+		{"missing property", `{"orderId": 1}`, "event does not match the schema: /: missing properties: 'items'"},
+		{"several violations", `{"orderId": "1", "items": [{"qty": 0}]}`, "/orderId: expected integer, but got string"},
+		{"not json", `orderId=1`, "event does not match the schema: body is not valid JSON"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := &proxy.InvocationContext{RequestId: "request-1"}
+			event := &proxy.Payload{Header: make(http.Header), Body: []byte(test.event)}
+			action, err := validation.OnNext(ctx, event)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.message == "" {
+				if action != proxy.Continue || string(event.Body) != test.event {
+					t.Fatalf("valid event returned %v with body %s", action, event.Body)
+				}
+				return
+			}
+
+			// The handler never receives the event, the proxy posts it as an invocation error
+			if action != proxy.Reject {
+				t.Fatalf("invalid event returned %v, expected Reject", action)
+			}
+			errorType, message := invocationError(t, event)
+			if errorType != InvalidEventType || !strings.Contains(message, test.message) {
+				t.Fatalf("rejected with %s: %s, expected %s: %s", errorType, message, InvalidEventType, test.message)
+			}
+		})
+	}
+}
+
+func TestValidationRejectsResponses(t *testing.T) {
+	validation := newTestValidation(t, "", totalSchema, ValidationReject)
+	ctx := &proxy.InvocationContext{RequestId: "request-1"}
+
+	// Events are not validated without an event schema
+	event := &proxy.Payload{Header: make(http.Header), Body: []byte(`not json`)}
+	if action, err := validation.OnNext(ctx, event); action != proxy.Continue || err != nil {
+		t.Fatalf("OnNext returned %v, %v without an event schema", action, err)
+	}
+
+	response := &proxy.Payload{Header: make(http.Header), Body: []byte(`{"total": 3}`)}
+	if action, err := validation.OnResponse(ctx, response); action != proxy.Continue || err != nil {
+		t.Fatalf("valid response returned %v, %v", action, err)
+	}
+
+	response = &proxy.Payload{Header: make(http.Header), Body: []byte(`{"total": "3"}`)}
+	if action, err := validation.OnResponse(ctx, response); action != proxy.Reject || err != nil {
+		t.Fatalf("invalid response returned %v, %v, expected Reject", action, err)
+	}
+	errorType, message := invocationError(t, response)
+	if errorType != InvalidResponseType || message != "response does not match the schema: /total: expected number, but got string" {
+		t.Fatalf("rejected with %s: %s", errorType, message)
+	}
+}
+
+func TestValidationLogMode(t *testing.T) {
+	validation := newTestValidation(t, orderSchema, totalSchema, "LOG")
+	ctx := &proxy.InvocationContext{RequestId: "request-1"}
+	event := &proxy.Payload{Header: make(http.Header), Body: []byte(`{}`)}
+	if action, err := validation.OnNext(ctx, event); action != proxy.Continue || err != nil || string(event.Body) != `{}` {
+		t.Fatalf("invalid event returned %v, %v with body %s in log mode", action, err, event.Body)
+	}
+	response := &proxy.Payload{Header: make(http.Header), Body: []byte(`{}`)}
+	if action, err := validation.OnResponse(ctx, response); action != proxy.Continue || err != nil || string(response.Body) != `{}` {
+		t.Fatalf("invalid response returned %v, %v with body %s in log mode", action, err, response.Body)
+	}
+}
+
+func TestValidationErrorsAreCapped(t *testing.T) {
+	validation := newTestValidation(t, orderSchema, "", "")
+	items := make([]string, maxValidationErrors+3)
+	for idx := range items {
+		items[idx] = `{"qty": 0}`
+	}
+	body := fmt.Sprintf(`{"orderId": 1, "items": [%s]}`, strings.Join(items, ", "))
+	problems := validateBody(validation.event, []byte(body))
+	if len(problems) != maxValidationErrors+1 || problems[maxValidationErrors] != "and 3 more" {
+		t.Fatalf("problems %q, expected %d and a summary", problems, maxValidationErrors)
+	}
+}
+
+func TestValidationSchemaFiles(t *testing.T) {
+	directory := t.TempDir()
+	files := map[string]string{
+		"order.json":    `{"type": "object", "properties": {"customer": {"$ref": "customer.json"}}}`,
+		"customer.json": `{"type": "object", "required": ["id"]}`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(directory, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	validation := newTestValidation(t, filepath.Join(directory, "order.json"), "", "")
+	if problems := validateBody(validation.event, []byte(`{"customer": {}}`)); len(problems) != 1 || problems[0] != "/customer: missing properties: 'id'" {
+		t.Fatalf("problems %q, expected the referenced schema to be applied", problems)
+	}
+}
+
+func TestInvalidValidationConfiguration(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		event string
+		mode  string
+		err   string
+	}{
+		{"invalid mode", totalSchema, "drop", `invalid LRAP_VALIDATION_MODE env variable "drop"`},
+		{"invalid schema", `{"type": 1}`, "", "invalid LRAP_EVENT_SCHEMA"},
+		{"missing file", filepath.Join(t.TempDir(), "missing.json"), "", "invalid LRAP_EVENT_SCHEMA"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv(EventSchemaEnv, test.event)
+			t.Setenv(ValidationModeEnv, test.mode)
+			if _, err := NewValidationFromEnv(); err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("configuration accepted with error %v, expected %q", err, test.err)
+			}
+		})
+	}
+
+	t.Setenv(EventSchemaEnv, "")
+	t.Setenv(ResponseSchemaEnv, "")
+	if validation, err := NewValidationFromEnv(); validation != nil || err != nil {
+		t.Fatalf("returned %v, %v without schemas, expected no middleware", validation, err)
+	}
+}
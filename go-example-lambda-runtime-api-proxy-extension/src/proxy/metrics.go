@@ -0,0 +1,241 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+// Read about CloudWatch embedded metric format here
+// https://docs.aws.amazon.com/AmazonCloudWatch/latest/monitoring/CloudWatch_Embedded_Metric_Format_Specification.html
+
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Lambda environment variables configuring the proxy metrics
+const (
+	// MetricsEnv is a comma separated list of sinks: emf prints an EMF line per invocation,
+	// endpoint serves the aggregated metrics of the last invocations on MetricsPath
+	MetricsEnv          = "LRAP_METRICS"
+	MetricsNamespaceEnv = "LRAP_METRICS_NAMESPACE"
+	MetricsPath         = "/lrap/metrics"
+
+	defaultMetricsNamespace = "LambdaRuntimeApiProxy"
+	metricsWindow           = 1000
+)
+
+// InvocationMetrics is measured by the proxy for every invocation
+type InvocationMetrics struct {
+	// TimeToHandler is the time from /next returning until the event is delivered to the handler
+	TimeToHandler time.Duration
+	// HandlerDuration is the time from the event delivery until the handler posts its result,
+	// or its first bytes for streamed responses
+	HandlerDuration time.Duration
+	// ProxyOverhead is the time the proxy and its middlewares added to the invocation, on both
+	// the event and the response path
+	ProxyOverhead time.Duration
+	ResponseSize  int64
+	Error         bool
+	// AnsweredByProxy is set when a middleware answered the event without waking the handler
+	AnsweredByProxy bool
+}
+
+// MetricSummary aggregates a metric over the last invocations
+type MetricSummary struct {
+	Count int     `json:"count"`
+	Avg   float64 `json:"avg"`
+	Max   float64 `json:"max"`
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+	P99   float64 `json:"p99"`
+}
+
+// MetricsReport is the document served on the metrics endpoint. Durations are in milliseconds
+type MetricsReport struct {
+	Invocations     int64                    `json:"invocations"`
+	Errors          int64                    `json:"errors"`
+	AnsweredByProxy int64                    `json:"answeredByProxy"`
+	ErrorRate       float64                  `json:"errorRate"`
+	Window          map[string]MetricSummary `json:"window"`
+}
+
+var (
+	emitEmf          bool
+	serveMetrics     bool
+	metricsNamespace = defaultMetricsNamespace
+	metricsLock      sync.Mutex
+	report           = MetricsReport{}
+	samples          = make(map[string][]float64)
+)
+
+// Reads "LRAP_METRICS" and "LRAP_METRICS_NAMESPACE"
+func initMetrics() error {
+	for _, sink := range strings.Split(os.Getenv(MetricsEnv), ",") {
+		switch strings.ToLower(strings.TrimSpace(sink)) {
+		case "":
+		case "emf":
+			emitEmf = true
+		case "endpoint":
+			serveMetrics = true
+		default:
+			return fmt.Errorf("invalid %s env variable %q, expected emf and/or endpoint", MetricsEnv, sink)
+		}
+	}
+	if namespace := os.Getenv(MetricsNamespaceEnv); namespace != "" {
+		metricsNamespace = namespace
+	}
+	return nil
+}
+
+// Records the metrics of a finished invocation in the enabled sinks
+func recordInvocation(ctx *InvocationContext, metrics InvocationMetrics) {
+	if serveMetrics {
+		aggregate(metrics)
+	}
+	if emitEmf {
+		printEmf(ctx, metrics)
+	}
+}
+
+// Records the metrics of an invocation once the handler posted its result. overhead is the time
+// the proxy spent on the result before posting it
+func recordResult(ctx *InvocationContext, receivedAt time.Time, overhead time.Duration, size int, isError bool) {
+	metrics := InvocationMetrics{ProxyOverhead: overhead, ResponseSize: int64(size), Error: isError}
+	if deliveredAt := ctx.DeliveredAt(); !deliveredAt.IsZero() {
+		metrics.TimeToHandler = deliveredAt.Sub(ctx.ReceivedAt)
+		metrics.HandlerDuration = receivedAt.Sub(deliveredAt)
+		metrics.ProxyOverhead += metrics.TimeToHandler
+	}
+	recordInvocation(ctx, metrics)
+}
+
+func aggregate(metrics InvocationMetrics) {
+	metricsLock.Lock()
+	defer metricsLock.Unlock()
+	report.Invocations++
+	if metrics.Error {
+		report.Errors++
+	}
+	if metrics.AnsweredByProxy {
+		report.AnsweredByProxy++
+	}
+	addSample("timeToHandler", milliseconds(metrics.TimeToHandler))
+	addSample("proxyOverhead", milliseconds(metrics.ProxyOverhead))
+	if !metrics.AnsweredByProxy {
+		addSample("handlerDuration", milliseconds(metrics.HandlerDuration))
+		addSample("responseSize", float64(metrics.ResponseSize))
+	}
+}
+
+// Keeps the last samples of a metric. Expects metricsLock to be held
+func addSample(name string, value float64) {
+	values := append(samples[name], value)
+	if len(values) > metricsWindow {
+		values = values[len(values)-metricsWindow:]
+	}
+	samples[name] = values
+}
+
+// Prints one CloudWatch EMF line for the invocation
+func printEmf(ctx *InvocationContext, metrics InvocationMetrics) {
+	errors, answered := 0, 0
+	if metrics.Error {
+		errors = 1
+	}
+	if metrics.AnsweredByProxy {
+		answered = 1
+	}
+	line, err := json.Marshal(map[string]interface{}{
+		"_aws": map[string]interface{}{
+			"Timestamp": time.Now().UnixNano() / int64(time.Millisecond),
+			"CloudWatchMetrics": []map[string]interface{}{{
+				"Namespace":  metricsNamespace,
+				"Dimensions": [][]string{{"FunctionName"}},
+				"Metrics": []map[string]string{
+					{"Name": "TimeToHandler", "Unit": "Milliseconds"},
+					{"Name": "HandlerDuration", "Unit": "Milliseconds"},
+					{"Name": "ProxyOverhead", "Unit": "Milliseconds"},
+					{"Name": "ResponseSize", "Unit": "Bytes"},
+					{"Name": "Errors", "Unit": "Count"},
+					{"Name": "AnsweredByProxy", "Unit": "Count"},
+				},
+			}},
+		},
+		"FunctionName":    os.Getenv("AWS_LAMBDA_FUNCTION_NAME"),
+		"requestId":       ctx.RequestId,
+		"traceId":         ctx.TraceId,
+		"TimeToHandler":   milliseconds(metrics.TimeToHandler),
+		"HandlerDuration": milliseconds(metrics.HandlerDuration),
+		"ProxyOverhead":   milliseconds(metrics.ProxyOverhead),
+		"ResponseSize":    metrics.ResponseSize,
+		"Errors":          errors,
+		"AnsweredByProxy": answered,
+	})
+	if err != nil {
+		println(printPrefix, "Error while marshalling metrics", err.Error())
+		return
+	}
+	fmt.Println(string(line))
+}
+
+// Serves the aggregated metrics as JSON
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	metricsLock.Lock()
+	current := report
+	current.Window = make(map[string]MetricSummary)
+	for name, values := range samples {
+		current.Window[name] = summarize(values)
+	}
+	metricsLock.Unlock()
+
+	if current.Invocations > 0 {
+		current.ErrorRate = float64(current.Errors) / float64(current.Invocations)
+	}
+	body, err := json.Marshal(current)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(body)
+}
+
+func summarize(values []float64) MetricSummary {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	summary := MetricSummary{Count: len(sorted)}
+	if len(sorted) == 0 {
+		return summary
+	}
+	var sum float64
+	for _, value := range sorted {
+		sum += value
+	}
+	summary.Avg = sum / float64(len(sorted))
+	summary.Max = sorted[len(sorted)-1]
+	summary.P50 = percentile(sorted, 0.50)
+	summary.P90 = percentile(sorted, 0.90)
+	summary.P99 = percentile(sorted, 0.99)
+	return summary
+}
+
+// Nearest-rank percentile of sorted values
+func percentile(sorted []float64, rank float64) float64 {
+	idx := int(rank*float64(len(sorted))+0.5) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
+
+func milliseconds(duration time.Duration) float64 {
+	return float64(duration) / float64(time.Millisecond)
+}
@@ -0,0 +1,300 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	RequestIdHeader       = "Lambda-Runtime-Aws-Request-Id"
+	DeadlineHeader        = "Lambda-Runtime-Deadline-Ms"
+	FunctionArnHeader     = "Lambda-Runtime-Invoked-Function-Arn"
+	TraceIdHeader         = "Lambda-Runtime-Trace-Id"
+	ClientContextHeader   = "Lambda-Runtime-Client-Context"
+	CognitoIdentityHeader = "Lambda-Runtime-Cognito-Identity"
+	ErrorTypeHeader       = "Lambda-Runtime-Function-Error-Type"
+)
+
+// Action tells the chain what to do once a hook returns
+type Action int
+
+const (
+	// Continue runs the next middleware of the chain
+	Continue Action = iota
+	// Halt skips the remaining middlewares and proxies the payload as it is
+	Halt
+	// Respond skips the remaining middlewares and posts the payload body as the
+	// invocation response. Returned from OnNext, the handler never sees the event
+	Respond
+	// Reject skips the remaining middlewares and posts the payload as an invocation
+	// error. Returned from OnNext, the handler never sees the event
+	Reject
+)
+
+// Payload is the body and headers of a Runtime API call. Middlewares can change them in place
+type Payload struct {
+	Header http.Header
+	Body   []byte
+}
+
+// SetError replaces the payload with a Runtime API error document
+func (p *Payload) SetError(errorType string, errorMessage string) {
+	body, _ := json.Marshal(map[string]string{
+		"errorType":    errorType,
+		"errorMessage": errorMessage,
+	})
+	p.Body = body
+	p.Header.Set(ErrorTypeHeader, errorType)
+	p.Header.Set("Content-Type", "application/json")
+}
+
+// InvocationContext holds the state of an invocation from the moment /next returns the event
+// until the handler posts its response or error. Middlewares can store their own values in it
+type InvocationContext struct {
+	RequestId   string
+	FunctionArn string
+	TraceId     string
+	Deadline    time.Time
+	ReceivedAt  time.Time
+
+	lock        sync.Mutex
+	values      map[string]interface{}
+	deliveredAt time.Time
+}
+
+// DeliveredAt returns when the event was delivered to the handler, zero until then
+func (c *InvocationContext) DeliveredAt() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.deliveredAt
+}
+
+func (c *InvocationContext) delivered(at time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.deliveredAt = at
+}
+
+// Set stores a value for the duration of the invocation
+func (c *InvocationContext) Set(key string, value interface{}) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.values == nil {
+		c.values = make(map[string]interface{})
+	}
+	c.values[key] = value
+}
+
+// Get returns a value stored by Set
+func (c *InvocationContext) Get(key string) (interface{}, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	value, ok := c.values[key]
+	return value, ok
+}
+
+// Middleware is a stage of the proxy pipeline. Each hook can change the payload in place,
+// short-circuit the chain by returning an Action other than Continue, or only observe it.
+// A hook that returns an error is logged and the chain continues with the next middleware
+type Middleware interface {
+	// OnNext is called with the event returned by /next before the runtime receives it
+	OnNext(ctx *InvocationContext, event *Payload) (Action, error)
+	// OnResponse is called with the handler response before it is posted to /response
+	OnResponse(ctx *InvocationContext, response *Payload) (Action, error)
+	// OnInvokeError is called with the handler error before it is posted to /error
+	OnInvokeError(ctx *InvocationContext, invokeError *Payload) (Action, error)
+	// OnInitError is called with the runtime initialization error before it is posted to /init/error
+	OnInitError(initError *Payload) (Action, error)
+}
+
+// ShutdownHook is implemented by middlewares that need to flush or release resources when the
+// execution environment shuts down
+type ShutdownHook interface {
+	OnShutdown() error
+}
+
+// CompletionHook is implemented by middlewares that need the final outcome of an invocation, once
+// every hook has run and the Runtime API answered the post. isResponse tells whether the payload was
+// posted as the invocation response and accepted, it is false for invocation errors and for posts
+// the Runtime API rejected or that could not reach it
+type CompletionHook interface {
+	OnComplete(ctx *InvocationContext, payload *Payload, isResponse bool)
+}
+
+// BaseMiddleware implements every hook as a no-op. Embed it to only implement the hooks you need
+type BaseMiddleware struct{}
+
+func (BaseMiddleware) OnNext(ctx *InvocationContext, event *Payload) (Action, error) {
+	return Continue, nil
+}
+
+func (BaseMiddleware) OnResponse(ctx *InvocationContext, response *Payload) (Action, error) {
+	return Continue, nil
+}
+
+func (BaseMiddleware) OnInvokeError(ctx *InvocationContext, invokeError *Payload) (Action, error) {
+	return Continue, nil
+}
+
+func (BaseMiddleware) OnInitError(initError *Payload) (Action, error) {
+	return Continue, nil
+}
+
+// Chain runs middlewares in registration order for /next, and in reverse order for the
+// response and errors, so that the first registered middleware sees the final payloads
+type Chain struct {
+	lock        sync.RWMutex
+	middlewares []Middleware
+	invocations map[string]*InvocationContext
+}
+
+var pipeline = NewChain()
+
+// NewChain returns an empty middleware chain
+func NewChain() *Chain {
+	return &Chain{invocations: make(map[string]*InvocationContext)}
+}
+
+// Use appends middlewares to the proxy pipeline. Call it before StartProxy
+func Use(middlewares ...Middleware) {
+	pipeline.Use(middlewares...)
+}
+
+// Use appends middlewares to the chain
+func (c *Chain) Use(middlewares ...Middleware) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.middlewares = append(c.middlewares, middlewares...)
+}
+
+// Next runs the OnNext hooks and starts tracking the invocation
+func (c *Chain) Next(event *Payload) (*InvocationContext, Action) {
+	ctx := newInvocationContext(event.Header)
+	c.lock.Lock()
+	c.invocations[ctx.RequestId] = ctx
+	middlewares := c.middlewares
+	c.lock.Unlock()
+
+	for _, middleware := range middlewares {
+		action, err := middleware.OnNext(ctx, event)
+		if done := c.handle(middleware, "OnNext", action, err); done {
+			return ctx, action
+		}
+	}
+	return ctx, Continue
+}
+
+// Response runs the OnResponse hooks of the invocation
+func (c *Chain) Response(requestId string, response *Payload) (*InvocationContext, Action) {
+	ctx, middlewares := c.invocation(requestId)
+	for idx := len(middlewares) - 1; idx >= 0; idx-- {
+		action, err := middlewares[idx].OnResponse(ctx, response)
+		if done := c.handle(middlewares[idx], "OnResponse", action, err); done {
+			return ctx, action
+		}
+	}
+	return ctx, Continue
+}
+
+// InvokeError runs the OnInvokeError hooks of the invocation
+func (c *Chain) InvokeError(requestId string, invokeError *Payload) (*InvocationContext, Action) {
+	ctx, middlewares := c.invocation(requestId)
+	for idx := len(middlewares) - 1; idx >= 0; idx-- {
+		action, err := middlewares[idx].OnInvokeError(ctx, invokeError)
+		if done := c.handle(middlewares[idx], "OnInvokeError", action, err); done {
+			return ctx, action
+		}
+	}
+	return ctx, Continue
+}
+
+// InitError runs the OnInitError hooks
+func (c *Chain) InitError(initError *Payload) Action {
+	c.lock.RLock()
+	middlewares := c.middlewares
+	c.lock.RUnlock()
+
+	for idx := len(middlewares) - 1; idx >= 0; idx-- {
+		action, err := middlewares[idx].OnInitError(initError)
+		if done := c.handle(middlewares[idx], "OnInitError", action, err); done {
+			return action
+		}
+	}
+	return Continue
+}
+
+// Complete runs the completion hooks of the invocation with its final payload
+func (c *Chain) Complete(ctx *InvocationContext, payload *Payload, isResponse bool) {
+	c.lock.RLock()
+	middlewares := c.middlewares
+	c.lock.RUnlock()
+
+	for _, middleware := range middlewares {
+		if hook, ok := middleware.(CompletionHook); ok {
+			hook.OnComplete(ctx, payload, isResponse)
+		}
+	}
+}
+
+// Done stops tracking an invocation once its response or error has been posted
+func (c *Chain) Done(requestId string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.invocations, requestId)
+}
+
+// Shutdown runs the shutdown hooks of the middlewares
+func (c *Chain) Shutdown() {
+	c.lock.RLock()
+	middlewares := c.middlewares
+	c.lock.RUnlock()
+
+	for _, middleware := range middlewares {
+		if hook, ok := middleware.(ShutdownHook); ok {
+			if err := hook.OnShutdown(); err != nil {
+				println(printPrefix, fmt.Sprintf("%T.OnShutdown failed:", middleware), err.Error())
+			}
+		}
+	}
+}
+
+// Returns the context of a tracked invocation, or a new one if /next was not seen by this proxy
+func (c *Chain) invocation(requestId string) (*InvocationContext, []Middleware) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	ctx, ok := c.invocations[requestId]
+	if !ok {
+		ctx = &InvocationContext{RequestId: requestId, ReceivedAt: time.Now()}
+	}
+	return ctx, c.middlewares
+}
+
+// Logs hook errors and reports whether the chain must stop
+func (c *Chain) handle(middleware Middleware, hook string, action Action, err error) bool {
+	if err != nil {
+		println(printPrefix, fmt.Sprintf("%T.%s failed, continuing:", middleware, hook), err.Error())
+		return false
+	}
+	return action != Continue
+}
+
+func newInvocationContext(headers http.Header) *InvocationContext {
+	ctx := &InvocationContext{
+		RequestId:   headers.Get(RequestIdHeader),
+		FunctionArn: headers.Get(FunctionArnHeader),
+		TraceId:     headers.Get(TraceIdHeader),
+		ReceivedAt:  time.Now(),
+	}
+	deadlineMs, err := strconv.ParseInt(headers.Get(DeadlineHeader), 10, 64)
+	if err == nil {
+		ctx.Deadline = time.Unix(0, deadlineMs*int64(time.Millisecond))
+	}
+	return ctx
+}
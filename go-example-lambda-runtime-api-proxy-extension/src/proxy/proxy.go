@@ -8,13 +8,14 @@ package proxy
 
 import (
 	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
-	"strings"
-
-	//"time"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 )
@@ -25,22 +26,66 @@ const (
 
 var (
 	awsLambdaRuntimeAPI string
-	client = &http.Client{}
+	// No overall timeout, /next long polls until the next event is available
+	client = &http.Client{
+		Transport: &http.Transport{
+			DialContext:         (&net.Dialer{Timeout: 5 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+			MaxIdleConnsPerHost: 10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+	server *http.Server
+
+	inflightLock sync.Mutex
+	inflight     int
 )
 
 
-// NewProxy returns a Lambda Extensions API client
-func StartProxy(endpoint string, port int) {
+// StartProxy binds the proxy to host:port and serves the Runtime API in the background. Returns
+// an error when the address cannot be bound, ex: the port is already taken
+func StartProxy(endpoint string, host string, port int) error {
 	println(printPrefix, "Starting proxy server")
 	awsLambdaRuntimeAPI = endpoint
+	if err := initMetrics(); err != nil {
+		println(printPrefix, "Metrics disabled:", err.Error())
+	}
+
+	// Read and write timeouts cover the whole request, they would cut /next long polls and
+	// streamed responses, so only the headers and idle connections are bounded
+	server = &http.Server{
+		Handler:           newRouter(),
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+		MaxHeaderBytes:    1 << 20,
+	}
+
+	address := net.JoinHostPort(host, strconv.Itoa(port))
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("cannot listen on %s: %v", address, err)
+	}
+	go func ()  {
+		err := server.Serve(listener)
+		if err != nil && err != http.ErrServerClosed {
+			println(printPrefix, "proxy reported error:", fmt.Sprintf("%s", err))
+		}
+	}()
+	println(printPrefix, "Proxy Server Started on", address)
+	return nil
+}
 
+// Returns the routes of the Runtime API served by the proxy
+func newRouter() http.Handler {
 	r := chi.NewRouter()
 	// Lambda runtime API
 	r.Use(simpleLogger)
 	r.Get("/2018-06-01/runtime/invocation/next", handleNext)
-	r.Post("/2018-06-01/runtime/invocation/{requestId}/response", handleResponse)
-	r.Post("/2018-06-01/runtime/init/error", handleInitError)
-	r.Post("/2018-06-01/runtime/invocation/{requestId}/error", handleInvokeError)
+	r.With(trackInflight).Post("/2018-06-01/runtime/invocation/{requestId}/response", handleResponse)
+	r.With(trackInflight).Post("/2018-06-01/runtime/init/error", handleInitError)
+	r.With(trackInflight).Post("/2018-06-01/runtime/invocation/{requestId}/error", handleInvokeError)
+	if serveMetrics {
+		r.Get(MetricsPath, handleMetrics)
+	}
 
 	// NotFound defines a handler to respond whenever a route could
 	// not be found.
@@ -50,21 +95,53 @@ func StartProxy(endpoint string, port int) {
 	// not allowed.
 	r.MethodNotAllowed(handleError)
 
-	proxy := &http.Server{
-		Addr:           fmt.Sprintf(":%d", port),
-		Handler:        r,
-		// ReadTimeout:    30 * time.Second,
-		// WriteTimeout:   30 * time.Second,
-		// MaxHeaderBytes: 1 << 20,
+	return r
+}
+
+// Shutdown waits until the in-flight responses and errors are posted to the Runtime API or the
+// context is done, runs the shutdown hooks of the middlewares and closes the server. Pending
+// /next long polls are closed since no more events will be delivered
+func Shutdown(ctx context.Context) error {
+	println(printPrefix, "Shutting down proxy server")
+	err := waitInflight(ctx)
+	pipeline.Shutdown()
+	if server != nil {
+		server.Close()
 	}
+	return err
+}
 
-	go func ()  {
-		err := proxy.ListenAndServe()
-		if err != nil {
-			println(printPrefix, "proxy reported error:", fmt.Sprintf("%s", err))
+// Counts the requests posting a result, Shutdown waits for them
+func trackInflight(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inflightLock.Lock()
+		inflight++
+		inflightLock.Unlock()
+		defer func() {
+			inflightLock.Lock()
+			inflight--
+			inflightLock.Unlock()
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+func waitInflight(ctx context.Context) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		inflightLock.Lock()
+		count := inflight
+		inflightLock.Unlock()
+		if count == 0 {
+			return nil
 		}
-	}()
-	println(printPrefix, "Proxy Server Started")
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d results still in flight: %v", count, ctx.Err())
+		case <-ticker.C:
+		}
+	}
 }
 
 func handleNext(w http.ResponseWriter, r *http.Request) {
@@ -72,70 +149,169 @@ func handleNext(w http.ResponseWriter, r *http.Request) {
 
 	url := fmt.Sprintf("http://%s/2018-06-01/runtime/invocation/next", awsLambdaRuntimeAPI)
 
-	resp, err := request("GET", url, r.Body, r.Header)
-	if err != nil {
-		return
-	}
+	// Events answered by a middleware never reach the runtime, so keep polling until one must be delivered
+	for {
+		resp, err := request("GET", url, r.Body, r.Header)
+		if err != nil {
+			upstreamError(w, err)
+			return
+		}
 
-	body, err := readBody(resp.Body)
-	if err != nil {
-		return
-	}
+		body, err := readBody(resp.Body)
+		if err != nil {
+			upstreamError(w, err)
+			return
+		}
+
+		// Errors from the Runtime API are not events, return them to the runtime as they are
+		if resp.StatusCode != http.StatusOK {
+			println(printPrefix, "Runtime API returned status", resp.StatusCode, "for next")
+			finalizeResponse(w, resp.StatusCode, body, resp.Header)
+			return
+		}
 
-	body, headers := processRequest(body, resp.Header)
+		event := &Payload{Header: resp.Header, Body: body}
+		ctx, action := pipeline.Next(event)
+		if action == Respond || action == Reject {
+			println(printPrefix, "Event answered by middleware for requestID:", ctx.RequestId)
+			metrics := InvocationMetrics{
+				ProxyOverhead:   time.Since(ctx.ReceivedAt),
+				ResponseSize:    int64(len(event.Body)),
+				Error:           action == Reject,
+				AnsweredByProxy: true,
+			}
+			accepted := postResult(ctx.RequestId, action, event)
+			pipeline.Complete(ctx, event, action == Respond && accepted)
+			recordInvocation(ctx, metrics)
+			pipeline.Done(ctx.RequestId)
+			continue
+		}
 
-	finalizeResponse(w, body, headers)
-	println(printPrefix, "handleNext posted")
+		finalizeResponse(w, resp.StatusCode, event.Body, event.Header)
+		ctx.delivered(time.Now())
+		println(printPrefix, "handleNext posted")
+		return
+	}
 }
 
 func handleResponse(w http.ResponseWriter, r *http.Request) {
+	receivedAt := time.Now()
 	requestId := chi.URLParam(r, "requestId")
 	println(printPrefix, "Handle Response for requestID:", requestId)
 
+	// Streamed responses are piped as they arrive instead of being buffered
+	if isStreamingResponse(r) {
+		handleStreamingResponse(w, r, requestId, receivedAt)
+		return
+	}
+
 	body, err := readBody(r.Body)
 	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 		return
 	}
 
-	body, headers := processResponse(body, r.Header, )
-	url := fmt.Sprintf("http://%s/2018-06-01/runtime/invocation/%s/response", awsLambdaRuntimeAPI, requestId)
-	bodyBuffer := io.NopCloser(bytes.NewReader(body))
+	response := &Payload{Header: r.Header, Body: body}
+	ctx, action := pipeline.Response(requestId, response)
+	defer pipeline.Done(requestId)
+	overhead := time.Since(receivedAt)
 
-	proxyPost(w, headers, url, bodyBuffer)
+	// The response is only complete once the Runtime API accepted it
+	status := proxyPost(w, response.Header, resultUrl(requestId, action != Reject), bodyReader(response.Body))
+	pipeline.Complete(ctx, response, action != Reject && isAccepted(status))
+	recordResult(ctx, receivedAt, overhead, len(response.Body), action == Reject)
 	println(printPrefix, "handleResponse posted")
 }
 
 func handleInitError(w http.ResponseWriter, r *http.Request) {
 	println(printPrefix, "Handle Init Error")
 
+	body, err := readBody(r.Body)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	initError := &Payload{Header: r.Header, Body: body}
+	pipeline.InitError(initError)
+
 	url := fmt.Sprintf("http://%s/2018-06-01/runtime/init/error", awsLambdaRuntimeAPI)
-	proxyPost(w, r.Header, url, r.Body)
+	proxyPost(w, initError.Header, url, bodyReader(initError.Body))
 
 	println(printPrefix, "handleInitError posted")
 }
 
 func handleInvokeError(w http.ResponseWriter, r *http.Request) {
+	receivedAt := time.Now()
 	requestId := chi.URLParam(r, "requestId")
 	println(printPrefix, "Handle Invoke Error for requestID:", requestId)
 
-	url := fmt.Sprintf("http://%s/2018-06-01/runtime/invocation/%s/error", awsLambdaRuntimeAPI, requestId)
-	proxyPost(w, r.Header, url, r.Body)
+	body, err := readBody(r.Body)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	invokeError := &Payload{Header: r.Header, Body: body}
+	ctx, action := pipeline.InvokeError(requestId, invokeError)
+	defer pipeline.Done(requestId)
+	overhead := time.Since(receivedAt)
 
+	status := proxyPost(w, invokeError.Header, resultUrl(requestId, action == Respond), bodyReader(invokeError.Body))
+	pipeline.Complete(ctx, invokeError, action == Respond && isAccepted(status))
+	recordResult(ctx, receivedAt, overhead, len(invokeError.Body), action != Respond)
 	println(printPrefix, "handleInvokeError posted")
 }
 
-func proxyPost(w http.ResponseWriter, headers http.Header, url string, body io.ReadCloser) {
+// Posts the result of an invocation answered by a middleware directly to the Runtime API, returns
+// whether it was accepted
+func postResult(requestId string, action Action, payload *Payload) bool {
+	resp, err := request("POST", resultUrl(requestId, action == Respond), bodyReader(payload.Body), payload.Header)
+	if err != nil {
+		return false
+	}
+	readBody(resp.Body)
+	if !isAccepted(resp.StatusCode) {
+		println(printPrefix, "Runtime API returned status", resp.StatusCode, "for requestID:", requestId)
+		return false
+	}
+	return true
+}
+
+// Tells if the Runtime API accepted a post, a zero status means it could not be reached
+func isAccepted(status int) bool {
+	return status >= 200 && status < 300
+}
+
+// Returns the Runtime API url of the invocation response, or of the invocation error
+func resultUrl(requestId string, isResponse bool) string {
+	if isResponse {
+		return fmt.Sprintf("http://%s/2018-06-01/runtime/invocation/%s/response", awsLambdaRuntimeAPI, requestId)
+	}
+	return fmt.Sprintf("http://%s/2018-06-01/runtime/invocation/%s/error", awsLambdaRuntimeAPI, requestId)
+}
+
+func bodyReader(body []byte) io.ReadCloser {
+	return io.NopCloser(bytes.NewReader(body))
+}
+
+// Posts to the Runtime API and relays its answer to the runtime. Returns the status of the Runtime
+// API, or 0 when it could not be reached
+func proxyPost(w http.ResponseWriter, headers http.Header, url string, body io.ReadCloser) int {
 	resp, err := request("POST", url, body, headers)
 	if err != nil {
-		return
+		upstreamError(w, err)
+		return 0
 	}
 
 	respBody, err := readBody(resp.Body)
 	if err != nil {
-		return
+		upstreamError(w, err)
+		return 0
 	}
 
-	finalizeResponse(w, respBody, resp.Header)
+	finalizeResponse(w, resp.StatusCode, respBody, resp.Header)
+	return resp.StatusCode
 }
 
 func handleError(w http.ResponseWriter, r *http.Request) {
@@ -143,14 +319,42 @@ func handleError(w http.ResponseWriter, r *http.Request) {
 	http.Error(w, http.StatusText(404), 404)
 }
 
+// Replies 502 with a Runtime API error document when the Runtime API cannot be reached
+func upstreamError(w http.ResponseWriter, err error) {
+	payload := &Payload{Header: make(http.Header)}
+	payload.SetError("Proxy.UpstreamError", err.Error())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadGateway)
+	_, _ = w.Write(payload.Body)
+}
+
+// Headers that only apply to a single connection, or that no longer match a modified body
+var hopHeaders = []string{
+	"Connection",
+	"Content-Length",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// Copies the end-to-end headers with canonical keys, replacing the values already in target
 func copyHeaders(original http.Header, target http.Header) {
 	for key, value := range original {
-  		target[strings.ToLower(key)]  = value
+		target[http.CanonicalHeaderKey(key)] = append([]string(nil), value...)
+	}
+	for _, key := range hopHeaders {
+		target.Del(key)
 	}
 }
 
-func finalizeResponse(w http.ResponseWriter, body []byte, headers http.Header) {
+func finalizeResponse(w http.ResponseWriter, status int, body []byte, headers http.Header) {
 	copyHeaders(headers, w.Header())
+	w.WriteHeader(status)
 	_, err := w.Write(body)
 	if err != nil {
 		println(printPrefix, "Error writing response body")
@@ -168,24 +372,14 @@ func readBody(bodyBuffer io.ReadCloser) ([]byte, error) {
 	return body, nil
 }
 
-func unmarshalBody(body []byte) (map[string]interface{}, error) {
-	var temp = make(map[string]interface{})
-	err := json.Unmarshal(body, &temp)
-	if err != nil {
-		println(printPrefix, "failed to unmarshal response body:", err)
-		return nil, err
-	}
-	return temp, nil
-}
-
 func request(verb string, url string, body io.Reader, headers http.Header) (*http.Response, error) {
 	request, err := http.NewRequest(verb, url, body)
 	if err != nil {
 		println(printPrefix, "Error creating http request")
 		return nil, err
 	}
-	if (headers != nil) {
-		copyHeaders(request.Header, headers)
+	if headers != nil {
+		copyHeaders(headers, request.Header)
 	}
 	resp, err := client.Do(request)
 	if err != nil {
@@ -204,39 +398,3 @@ func simpleLogger(next http.Handler) http.Handler {
 
 	return http.HandlerFunc(fn)
 }
-
-// Assumes body is a JSON object. Expand as needed
-func processRequest(body []byte, headers http.Header) ([]byte, http.Header) {
-	jsonBody, err := unmarshalBody(body)
-	if err != nil {
-		println(printPrefix, "Error unmarshalling body, returning original body")
-		return body, headers
-	}
-
-	jsonBody["LRAP RequestModified"] = true
-
-	newBody, err :=json.Marshal(jsonBody)
-	if err != nil {
-		println(printPrefix, "Error marshalling body, returning original body")
-		return body, headers
-	}
-	return newBody, headers
-}
-
-// Assumes body is a JSON object. Expand as needed
-func processResponse(body []byte, headers http.Header) ([]byte, http.Header) {
-	jsonBody, err := unmarshalBody(body)
-	if err != nil {
-		println(printPrefix, "Error unmarshalling body, returning original body")
-		return body, headers
-	}
-
-	jsonBody["LRAP ResponseModified"] = true
-
-	newBody, err :=json.Marshal(jsonBody)
-	if err != nil {
-		println(printPrefix, "Error marshalling body, returning original body")
-		return body, headers
-	}
-	return newBody, headers
-}
\ No newline at end of file
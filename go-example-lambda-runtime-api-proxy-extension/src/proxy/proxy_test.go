@@ -0,0 +1,570 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// runtimeApi emulates the Runtime API: /next returns the queued events, and the posted responses
+// and errors are recorded and answered with status and header, 202 by default
+type runtimeApi struct {
+	events  chan testEvent
+	results chan testResult
+	status  int
+	header  http.Header
+	server  *httptest.Server
+}
+
+// testEvent is returned by /next with status, 200 by default, and the headers in header
+type testEvent struct {
+	requestId string
+	body      string
+	status    int
+	header    http.Header
+}
+
+type testResult struct {
+	requestId string
+	isError   bool
+	header    http.Header
+	trailer   http.Header
+	body      string
+}
+
+func newRuntimeApi() *runtimeApi {
+	return &runtimeApi{events: make(chan testEvent, 10), results: make(chan testResult, 10), status: http.StatusAccepted, header: make(http.Header)}
+}
+
+func (a *runtimeApi) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/2018-06-01/runtime/invocation/next" {
+		select {
+		case event := <-a.events:
+			w.Header().Set(RequestIdHeader, event.requestId)
+			w.Header().Set(DeadlineHeader, strconv.FormatInt(time.Now().Add(time.Minute).UnixNano()/int64(time.Millisecond), 10))
+			for key, values := range event.header {
+				w.Header()[key] = values
+			}
+			if event.status != 0 {
+				w.WriteHeader(event.status)
+			}
+			io.WriteString(w, event.body)
+		case <-time.After(5 * time.Second):
+			http.Error(w, "no event", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	parts := strings.Split(r.URL.Path, "/")
+	body, _ := io.ReadAll(r.Body)
+	a.results <- testResult{
+		requestId: parts[len(parts)-2],
+		isError:   parts[len(parts)-1] == "error",
+		header:    r.Header.Clone(),
+		trailer:   r.Trailer.Clone(),
+		body:      string(body),
+	}
+	for key, values := range a.header {
+		w.Header()[key] = values
+	}
+	w.WriteHeader(a.status)
+	io.WriteString(w, `{"status":"OK"}`)
+}
+
+func (a *runtimeApi) result(t *testing.T) testResult {
+	t.Helper()
+	select {
+	case result := <-a.results:
+		return result
+	case <-time.After(5 * time.Second):
+		t.Fatal("no result posted to the Runtime API")
+		return testResult{}
+	}
+}
+
+// Serves the proxy in front of an emulated Runtime API, with a new pipeline of the middlewares
+func newTestProxy(t *testing.T, middlewares ...Middleware) (string, *runtimeApi) {
+	runtime := newRuntimeApi()
+	upstream := httptest.NewServer(runtime)
+	runtime.server = upstream
+	awsLambdaRuntimeAPI = strings.TrimPrefix(upstream.URL, "http://")
+	pipeline = NewChain()
+	pipeline.Use(middlewares...)
+	server := httptest.NewServer(newRouter())
+	t.Cleanup(func() {
+		server.Close()
+		upstream.Close()
+	})
+	return server.URL, runtime
+}
+
+type callLog struct {
+	lock  sync.Mutex
+	calls []string
+}
+
+func (l *callLog) add(call string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.calls = append(l.calls, call)
+}
+
+func (l *callLog) String() string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return strings.Join(l.calls, ",")
+}
+
+// recordingMiddleware logs its hooks and appends its name to the payloads. Events with the body
+// answer are short-circuited with nextAction, responses with responseAction
+type recordingMiddleware struct {
+	BaseMiddleware
+	name           string
+	log            *callLog
+	answer         string
+	nextAction     Action
+	responseAction Action
+}
+
+func (m *recordingMiddleware) OnNext(ctx *InvocationContext, event *Payload) (Action, error) {
+	m.log.add(m.name + ".OnNext")
+	if m.answer != "" && string(event.Body) == m.answer {
+		return m.shortCircuit(m.nextAction, event)
+	}
+	event.Body = append(event.Body, " "+m.name...)
+	return Continue, nil
+}
+
+func (m *recordingMiddleware) OnResponse(ctx *InvocationContext, response *Payload) (Action, error) {
+	m.log.add(m.name + ".OnResponse")
+	response.Body = append(response.Body, " "+m.name...)
+	return m.shortCircuit(m.responseAction, response)
+}
+
+func (m *recordingMiddleware) OnComplete(ctx *InvocationContext, payload *Payload, isResponse bool) {
+	m.log.add(m.name + ".OnComplete:" + strconv.FormatBool(isResponse))
+}
+
+func (m *recordingMiddleware) shortCircuit(action Action, payload *Payload) (Action, error) {
+	switch action {
+	case Respond:
+		payload.Body = []byte("answered by " + m.name)
+	case Reject:
+		payload.SetError("Test.Rejected", "rejected by "+m.name)
+	}
+	return action, nil
+}
+
+// streamRecorder records the chunks and the trailers of streamed responses
+type streamRecorder struct {
+	BaseMiddleware
+	lock    sync.Mutex
+	chunks  []string
+	trailer http.Header
+}
+
+func (r *streamRecorder) OnResponseChunk(ctx *InvocationContext, chunk []byte) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.chunks = append(r.chunks, string(chunk))
+}
+
+func (r *streamRecorder) OnResponseEnd(ctx *InvocationContext, trailer http.Header, err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.trailer = trailer.Clone()
+}
+
+func getNext(t *testing.T, proxyUrl string) (string, string) {
+	t.Helper()
+	resp, err := http.Get(proxyUrl + "/2018-06-01/runtime/invocation/next")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("next returned %s: %s", resp.Status, body)
+	}
+	return resp.Header.Get(RequestIdHeader), string(body)
+}
+
+func postResponse(t *testing.T, proxyUrl string, requestId string, body string) {
+	t.Helper()
+	resp, err := http.Post(proxyUrl+"/2018-06-01/runtime/invocation/"+requestId+"/response", "text/plain", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("response returned %s", resp.Status)
+	}
+}
+
+func TestHookOrder(t *testing.T) {
+	log := &callLog{}
+	proxyUrl, runtime := newTestProxy(t,
+		&recordingMiddleware{name: "first", log: log},
+		&recordingMiddleware{name: "second", log: log})
+
+	runtime.events <- testEvent{requestId: "1", body: "event"}
+	requestId, event := getNext(t, proxyUrl)
+	if requestId != "1" || event != "event first second" {
+		t.Fatalf("handler received %s %q, expected the event changed in registration order", requestId, event)
+	}
+
+	postResponse(t, proxyUrl, requestId, "response")
+	result := runtime.result(t)
+	if result.isError || result.requestId != "1" || result.body != "response second first" {
+		t.Fatalf("Runtime API received %+v, expected the response changed in reverse order", result)
+	}
+	expected := "first.OnNext,second.OnNext,second.OnResponse,first.OnResponse,first.OnComplete:true,second.OnComplete:true"
+	if log.String() != expected {
+		t.Fatalf("hooks ran in order %s, expected %s", log, expected)
+	}
+}
+
+func TestRespondFromNext(t *testing.T) {
+	log := &callLog{}
+	proxyUrl, runtime := newTestProxy(t,
+		&recordingMiddleware{name: "first", log: log, answer: "duplicate", nextAction: Respond},
+		&recordingMiddleware{name: "second", log: log})
+
+	runtime.events <- testEvent{requestId: "1", body: "duplicate"}
+	runtime.events <- testEvent{requestId: "2", body: "event"}
+	requestId, event := getNext(t, proxyUrl)
+	if requestId != "2" || event != "event first second" {
+		t.Fatalf("handler received %s %q, expected the second event", requestId, event)
+	}
+
+	result := runtime.result(t)
+	if result.isError || result.requestId != "1" || result.body != "answered by first" {
+		t.Fatalf("Runtime API received %+v, expected the response of the middleware", result)
+	}
+	expected := "first.OnNext,first.OnComplete:true,second.OnComplete:true,first.OnNext,second.OnNext"
+	if log.String() != expected {
+		t.Fatalf("hooks ran in order %s, expected %s", log, expected)
+	}
+}
+
+func TestRejectFromNext(t *testing.T) {
+	log := &callLog{}
+	proxyUrl, runtime := newTestProxy(t, &recordingMiddleware{name: "first", log: log, answer: "invalid", nextAction: Reject})
+
+	runtime.events <- testEvent{requestId: "1", body: "invalid"}
+	runtime.events <- testEvent{requestId: "2", body: "event"}
+	if requestId, _ := getNext(t, proxyUrl); requestId != "2" {
+		t.Fatalf("handler received %s, expected the second event", requestId)
+	}
+
+	result := runtime.result(t)
+	if !result.isError || result.requestId != "1" || result.header.Get(ErrorTypeHeader) != "Test.Rejected" {
+		t.Fatalf("Runtime API received %+v, expected an invocation error", result)
+	}
+	if !strings.Contains(result.body, "rejected by first") {
+		t.Fatalf("error document %s does not contain the message of the middleware", result.body)
+	}
+}
+
+func TestHaltResponse(t *testing.T) {
+	log := &callLog{}
+	proxyUrl, runtime := newTestProxy(t,
+		&recordingMiddleware{name: "first", log: log},
+		&recordingMiddleware{name: "second", log: log, responseAction: Halt})
+
+	runtime.events <- testEvent{requestId: "1", body: "event"}
+	requestId, _ := getNext(t, proxyUrl)
+	postResponse(t, proxyUrl, requestId, "response")
+
+	result := runtime.result(t)
+	if result.isError || result.body != "response second" {
+		t.Fatalf("Runtime API received %+v, expected the response as halted", result)
+	}
+	if strings.Contains(log.String(), "first.OnResponse") {
+		t.Fatalf("hooks ran in order %s, expected the chain to stop at second", log)
+	}
+}
+
+func TestRejectResponse(t *testing.T) {
+	log := &callLog{}
+	proxyUrl, runtime := newTestProxy(t,
+		&recordingMiddleware{name: "first", log: log},
+		&recordingMiddleware{name: "second", log: log, responseAction: Reject})
+
+	runtime.events <- testEvent{requestId: "1", body: "event"}
+	requestId, _ := getNext(t, proxyUrl)
+	postResponse(t, proxyUrl, requestId, "response")
+
+	result := runtime.result(t)
+	if !result.isError || result.header.Get(ErrorTypeHeader) != "Test.Rejected" {
+		t.Fatalf("Runtime API received %+v, expected an invocation error", result)
+	}
+	if !strings.HasSuffix(log.String(), "second.OnResponse,first.OnComplete:false,second.OnComplete:false") {
+		t.Fatalf("hooks ran in order %s, expected the chain to stop at second and complete with an error", log)
+	}
+}
+
+func TestResponseNotAcceptedIsNotComplete(t *testing.T) {
+	log := &callLog{}
+	proxyUrl, runtime := newTestProxy(t, &recordingMiddleware{name: "first", log: log})
+	runtime.status = http.StatusRequestEntityTooLarge
+
+	runtime.events <- testEvent{requestId: "1", body: "event"}
+	requestId, _ := getNext(t, proxyUrl)
+	if resp, _ := postTestResult(t, proxyUrl, requestId, "response", nil, "response"); resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("response returned %s, expected the status of the Runtime API", resp.Status)
+	}
+	runtime.result(t)
+	if !strings.HasSuffix(log.String(), "first.OnComplete:false") {
+		t.Fatalf("hooks ran in order %s, expected the invocation to complete with an error", log)
+	}
+}
+
+func TestRespondFromNextNotAcceptedIsNotComplete(t *testing.T) {
+	log := &callLog{}
+	proxyUrl, runtime := newTestProxy(t, &recordingMiddleware{name: "first", log: log, answer: "duplicate", nextAction: Respond})
+	runtime.status = http.StatusInternalServerError
+
+	runtime.events <- testEvent{requestId: "1", body: "duplicate"}
+	runtime.events <- testEvent{requestId: "2", body: "event"}
+	getNext(t, proxyUrl)
+	runtime.result(t)
+	if expected := "first.OnNext,first.OnComplete:false,first.OnNext"; log.String() != expected {
+		t.Fatalf("hooks ran in order %s, expected %s", log, expected)
+	}
+}
+
+func TestStreamingResponseWithTrailers(t *testing.T) {
+	recorder := &streamRecorder{}
+	proxyUrl, runtime := newTestProxy(t, recorder)
+
+	reader, writer := io.Pipe()
+	req, err := http.NewRequest("POST", proxyUrl+"/2018-06-01/runtime/invocation/1/response", reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(ResponseModeHeader, StreamingResponseMode)
+	req.ContentLength = -1
+	req.Trailer = http.Header{ErrorTypeHeader: nil, ErrorBodyTrailer: nil}
+	go func() {
+		io.WriteString(writer, "first chunk,")
+		io.WriteString(writer, "second chunk")
+		// Trailers are sent once the body is over
+		req.Trailer.Set(ErrorTypeHeader, "Function.StreamFailed")
+		req.Trailer.Set(ErrorBodyTrailer, "eyJlcnJvciI6dHJ1ZX0=")
+		writer.Close()
+	}()
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("streamed response returned %s", resp.Status)
+	}
+
+	result := runtime.result(t)
+	if result.isError || result.body != "first chunk,second chunk" {
+		t.Fatalf("Runtime API received %+v, expected the streamed body", result)
+	}
+	if result.header.Get(ResponseModeHeader) != StreamingResponseMode {
+		t.Fatalf("Runtime API received headers %v, expected the response mode", result.header)
+	}
+	if result.trailer.Get(ErrorTypeHeader) != "Function.StreamFailed" || result.trailer.Get(ErrorBodyTrailer) != "eyJlcnJvciI6dHJ1ZX0=" {
+		t.Fatalf("Runtime API received trailers %v, expected the trailers of the runtime", result.trailer)
+	}
+
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	if strings.Join(recorder.chunks, "") != "first chunk,second chunk" {
+		t.Fatalf("observer saw chunks %q", recorder.chunks)
+	}
+	if recorder.trailer.Get(ErrorTypeHeader) != "Function.StreamFailed" {
+		t.Fatalf("observer saw trailers %v", recorder.trailer)
+	}
+}
+
+// Posts the body as the response or the error of the invocation, returns the status and the body
+// of the reply
+func postTestResult(t *testing.T, proxyUrl string, requestId string, result string, header http.Header, body string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest("POST", proxyUrl+"/2018-06-01/runtime/invocation/"+requestId+"/"+result, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	return resp, string(reply)
+}
+
+func TestNextStatusIsForwarded(t *testing.T) {
+	for _, status := range []int{http.StatusForbidden, http.StatusInternalServerError} {
+		proxyUrl, runtime := newTestProxy(t, &recordingMiddleware{name: "first", log: &callLog{}})
+		runtime.events <- testEvent{requestId: "1", body: `{"errorType": "Runtime.Failed"}`, status: status}
+
+		resp, err := http.Get(proxyUrl + "/2018-06-01/runtime/invocation/next")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != status || string(body) != `{"errorType": "Runtime.Failed"}` {
+			t.Fatalf("next returned %s %s, expected the error of the Runtime API unchanged", resp.Status, body)
+		}
+	}
+}
+
+func TestResultStatusIsForwarded(t *testing.T) {
+	for _, test := range []struct {
+		result string
+		status int
+	}{
+		{"response", http.StatusBadRequest},
+		{"response", http.StatusRequestEntityTooLarge},
+		{"response", http.StatusInternalServerError},
+		{"error", http.StatusBadRequest},
+		{"error", http.StatusInternalServerError},
+	} {
+		proxyUrl, runtime := newTestProxy(t)
+		runtime.status = test.status
+		runtime.header.Set("X-Runtime-Reply", "rejected")
+		runtime.events <- testEvent{requestId: "1", body: "event"}
+		getNext(t, proxyUrl)
+
+		resp, body := postTestResult(t, proxyUrl, "1", test.result, nil, "result")
+		if resp.StatusCode != test.status || body != `{"status":"OK"}` || resp.Header.Get("X-Runtime-Reply") != "rejected" {
+			t.Fatalf("%s returned %s %v %s, expected the reply of the Runtime API unchanged", test.result, resp.Status, resp.Header, body)
+		}
+		runtime.result(t)
+	}
+}
+
+func TestHeadersAreForwarded(t *testing.T) {
+	proxyUrl, runtime := newTestProxy(t)
+	runtime.events <- testEvent{requestId: "1", body: "event", header: http.Header{
+		DeadlineHeader:                  {"1700000000000"},
+		TraceIdHeader:                   {"Root=1-5759e988-bd862e3fe1be46a994272793"},
+		"Lambda-Runtime-Client-Context": {"eyJjdXN0b20iOnt9fQ=="},
+		"Keep-Alive":                    {"timeout=5"},
+		"Proxy-Authenticate":            {"Basic"},
+	}}
+
+	resp, err := http.Get(proxyUrl + "/2018-06-01/runtime/invocation/next")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	expected := map[string]string{
+		RequestIdHeader:                 "1",
+		DeadlineHeader:                  "1700000000000",
+		TraceIdHeader:                   "Root=1-5759e988-bd862e3fe1be46a994272793",
+		"Lambda-Runtime-Client-Context": "eyJjdXN0b20iOnt9fQ==",
+	}
+	for key, value := range expected {
+		if resp.Header.Get(key) != value {
+			t.Fatalf("runtime received %s=%q, expected %q", key, resp.Header.Get(key), value)
+		}
+	}
+	for _, key := range []string{"Keep-Alive", "Proxy-Authenticate"} {
+		if _, ok := resp.Header[key]; ok {
+			t.Fatalf("runtime received the hop-by-hop header %s", key)
+		}
+	}
+
+	postTestResult(t, proxyUrl, "1", "response", http.Header{
+		"X-Custom":            {"value"},
+		"Proxy-Authorization": {"Basic dXNlcjpwYXNz"},
+		"Keep-Alive":          {"timeout=5"},
+	}, "response")
+	result := runtime.result(t)
+	if result.header.Get("X-Custom") != "value" || result.header.Get("Proxy-Authorization") != "" || result.header.Get("Keep-Alive") != "" {
+		t.Fatalf("Runtime API received headers %v, expected the end-to-end headers only", result.header)
+	}
+}
+
+func TestCopyHeaders(t *testing.T) {
+	target := http.Header{"X-Old": {"old"}, "X-Custom": {"old"}}
+	copyHeaders(http.Header{
+		"lambda-runtime-trace-id": {"Root=1"},
+		"x-custom":                {"first", "second"},
+		"connection":              {"close"},
+		"Transfer-Encoding":       {"chunked"},
+		"Content-Length":          {"10"},
+	}, target)
+
+	expected := http.Header{
+		TraceIdHeader: {"Root=1"},
+		"X-Custom":    {"first", "second"},
+		"X-Old":       {"old"},
+	}
+	if !reflect.DeepEqual(target, expected) {
+		t.Fatalf("copied headers %v, expected %v", target, expected)
+	}
+}
+
+func TestBodiesArePreserved(t *testing.T) {
+	proxyUrl, runtime := newTestProxy(t)
+	var binary strings.Builder
+	for idx := 0; idx < 1024*1024; idx++ {
+		binary.WriteByte(byte(idx))
+	}
+	for _, body := range []string{"", `{"unicode": "caf\u00e9 ☕", "number": 1e400}`, binary.String()} {
+		runtime.events <- testEvent{requestId: "1", body: body}
+		if _, event := getNext(t, proxyUrl); event != body {
+			t.Fatalf("runtime received an event of %d bytes, expected %d bytes unchanged", len(event), len(body))
+		}
+		postResponse(t, proxyUrl, "1", body)
+		if result := runtime.result(t); result.body != body {
+			t.Fatalf("Runtime API received a response of %d bytes, expected %d bytes unchanged", len(result.body), len(body))
+		}
+	}
+}
+
+func TestUpstreamError(t *testing.T) {
+	proxyUrl, runtime := newTestProxy(t)
+	runtime.server.Close()
+
+	resp, err := http.Get(proxyUrl + "/2018-06-01/runtime/invocation/next")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	checkUpstreamError(t, resp, string(body))
+
+	resp, reply := postTestResult(t, proxyUrl, "1", "response", nil, "response")
+	checkUpstreamError(t, resp, reply)
+}
+
+func checkUpstreamError(t *testing.T, resp *http.Response, body string) {
+	t.Helper()
+	var document struct {
+		ErrorType    string `json:"errorType"`
+		ErrorMessage string `json:"errorMessage"`
+	}
+	if err := json.Unmarshal([]byte(body), &document); err != nil {
+		t.Fatalf("proxy returned %s, expected an error document", body)
+	}
+	if resp.StatusCode != http.StatusBadGateway || resp.Header.Get("Content-Type") != "application/json" ||
+		document.ErrorType != "Proxy.UpstreamError" || document.ErrorMessage == "" {
+		t.Fatalf("proxy returned %s %s, expected a 502 with the Proxy.UpstreamError document", resp.Status, body)
+	}
+}
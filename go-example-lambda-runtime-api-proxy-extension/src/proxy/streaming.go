@@ -0,0 +1,123 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+// Read about Lambda response streaming here
+// https://docs.aws.amazon.com/lambda/latest/dg/runtimes-custom.html#runtimes-custom-response-streaming
+
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	ResponseModeHeader    = "Lambda-Runtime-Function-Response-Mode"
+	StreamingResponseMode = "streaming"
+	ErrorBodyTrailer      = "Lambda-Runtime-Function-Error-Body"
+)
+
+// StreamObserver is implemented by middlewares that want to see streamed responses. OnResponse is
+// not called for streamed responses since their body is never buffered by the proxy
+type StreamObserver interface {
+	// OnResponseChunk is called with every chunk read from the runtime before it is forwarded.
+	// The chunk is only valid for the duration of the call
+	OnResponseChunk(ctx *InvocationContext, chunk []byte)
+	// OnResponseEnd is called once the whole stream has been forwarded, with the trailers sent
+	// by the runtime, ex: Lambda-Runtime-Function-Error-Type, and the error that ended the stream if any
+	OnResponseEnd(ctx *InvocationContext, trailer http.Header, err error)
+}
+
+// ResponseStream returns the invocation context and the middlewares observing streamed responses,
+// in the same reverse order as OnResponse
+func (c *Chain) ResponseStream(requestId string) (*InvocationContext, []StreamObserver) {
+	ctx, middlewares := c.invocation(requestId)
+	var observers []StreamObserver
+	for idx := len(middlewares) - 1; idx >= 0; idx-- {
+		if observer, ok := middlewares[idx].(StreamObserver); ok {
+			observers = append(observers, observer)
+		}
+	}
+	return ctx, observers
+}
+
+func isStreamingResponse(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get(ResponseModeHeader), StreamingResponseMode)
+}
+
+// Pipes a streamed response to the Runtime API chunk by chunk. The upstream request uses chunked
+// transfer encoding and declares the same trailers as the runtime, whose values are copied once
+// the runtime has finished sending the body
+func handleStreamingResponse(w http.ResponseWriter, r *http.Request, requestId string, receivedAt time.Time) {
+	println(printPrefix, "Handle Streaming Response for requestID:", requestId)
+	ctx, observers := pipeline.ResponseStream(requestId)
+	defer pipeline.Done(requestId)
+
+	body := &observedBody{body: r.Body, ctx: ctx, observers: observers}
+	upstream, err := http.NewRequest("POST", resultUrl(requestId, true), body)
+	if err != nil {
+		println(printPrefix, "Error creating http request")
+		upstreamError(w, err)
+		return
+	}
+	copyHeaders(r.Header, upstream.Header)
+	upstream.ContentLength = -1
+	upstream.Trailer = make(http.Header)
+	for key := range r.Trailer {
+		upstream.Trailer[key] = nil
+	}
+	body.onEOF = func() {
+		for key, values := range r.Trailer {
+			upstream.Trailer[key] = values
+		}
+	}
+
+	resp, err := client.Do(upstream)
+	for _, observer := range observers {
+		observer.OnResponseEnd(ctx, r.Trailer, err)
+	}
+	recordResult(ctx, receivedAt, 0, int(body.size), err != nil || r.Trailer.Get(ErrorTypeHeader) != "")
+	if err != nil {
+		println(printPrefix, "Error streaming response", err.Error())
+		upstreamError(w, err)
+		return
+	}
+
+	respBody, err := readBody(resp.Body)
+	if err != nil {
+		upstreamError(w, err)
+		return
+	}
+	finalizeResponse(w, resp.StatusCode, respBody, resp.Header)
+	println(printPrefix, "handleStreamingResponse posted")
+}
+
+// observedBody passes every chunk read from the runtime to the stream observers
+type observedBody struct {
+	body      io.ReadCloser
+	ctx       *InvocationContext
+	observers []StreamObserver
+	onEOF     func()
+	size      int64
+}
+
+func (b *observedBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	b.size += int64(n)
+	if n > 0 {
+		for _, observer := range b.observers {
+			observer.OnResponseChunk(b.ctx, p[:n])
+		}
+	}
+	if err == io.EOF && b.onEOF != nil {
+		b.onEOF()
+		b.onEOF = nil
+	}
+	return n, err
+}
+
+func (b *observedBody) Close() error {
+	return b.body.Close()
+}
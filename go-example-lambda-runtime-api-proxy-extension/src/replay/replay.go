@@ -0,0 +1,316 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+// Replays a capture file against a local handler through an emulated Runtime API
+
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"LAMBDA-RUNTIME-API-PROXY-EXTENSION-MAIN/golang-example-lambda-runtime-api-proxy-example/src/middleware"
+	"LAMBDA-RUNTIME-API-PROXY-EXTENSION-MAIN/golang-example-lambda-runtime-api-proxy-example/src/proxy"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	printPrefix = "[LRAP:Replay]"
+	maxDiffs    = 20
+)
+
+// result is what the handler posted for a replayed event
+type result struct {
+	requestId string
+	isError   bool
+	body      []byte
+}
+
+// runtimeApi emulates the Runtime API endpoints used by a runtime
+type runtimeApi struct {
+	events  chan *middleware.CaptureRecord
+	results chan result
+	timeout time.Duration
+}
+
+// Run replays the events of a capture file and diffs the responses of the handler with the
+// captured ones. Returns the process exit code: 0 when every response matched
+func Run(args []string) int {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	file := flags.String("file", "", "capture file written by the capture middleware (required)")
+	listen := flags.String("listen", "127.0.0.1:9001", "address of the emulated Runtime API")
+	timeout := flags.Duration("timeout", 30*time.Second, "maximum time to wait for each invocation")
+	ignore := flags.String("ignore", "", "comma separated JSON paths excluded from the diff, ex: $.timestamp,$.body.id")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: replay -file capture.ndjson [options] [-- handler command]")
+		fmt.Fprintln(flags.Output(), "Without a command, start your runtime with AWS_LAMBDA_RUNTIME_API set to the listen address")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *file == "" {
+		flags.Usage()
+		return 2
+	}
+
+	records, err := readCapture(*file)
+	if err != nil {
+		println(printPrefix, err.Error())
+		return 1
+	}
+	// The Marker runs before the capture on the response path, the raw handler never adds its key
+	ignored := map[string]bool{"$." + middleware.ResponseMarkerKey: true}
+	for _, path := range strings.Split(*ignore, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			ignored[path] = true
+		}
+	}
+
+	api := &runtimeApi{
+		events:  make(chan *middleware.CaptureRecord),
+		results: make(chan result, 1),
+		timeout: *timeout,
+	}
+	listener, err := net.Listen("tcp", *listen)
+	if err != nil {
+		println(printPrefix, "Cannot listen on", *listen, err.Error())
+		return 1
+	}
+	server := &http.Server{Handler: api.router()}
+	go server.Serve(listener)
+	defer server.Close()
+	println(printPrefix, "Emulated Runtime API listening on", listener.Addr().String(), "with", len(records), "events")
+
+	if command := flags.Args(); len(command) > 0 {
+		cmd := exec.Command(command[0], command[1:]...)
+		cmd.Env = append(os.Environ(), "AWS_LAMBDA_RUNTIME_API="+listener.Addr().String())
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Start(); err != nil {
+			println(printPrefix, "Cannot start handler:", err.Error())
+			return 1
+		}
+		defer cmd.Process.Kill()
+	}
+
+	failed := 0
+	for idx, record := range records {
+		diffs := api.replay(record, ignored)
+		if len(diffs) == 0 {
+			println(printPrefix, fmt.Sprintf("[%d/%d] %s matched", idx+1, len(records), record.RequestId))
+			continue
+		}
+		failed++
+		println(printPrefix, fmt.Sprintf("[%d/%d] %s differs:", idx+1, len(records), record.RequestId))
+		for _, diff := range diffs {
+			println(printPrefix, "   ", diff)
+		}
+	}
+	println(printPrefix, fmt.Sprintf("%d replayed, %d matched, %d differed", len(records), len(records)-failed, failed))
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// Delivers the event to the runtime and compares what it posts with the captured result
+func (api *runtimeApi) replay(record *middleware.CaptureRecord, ignored map[string]bool) []string {
+	select {
+	case api.events <- record:
+	case <-time.After(api.timeout):
+		return []string{"the runtime did not request the event"}
+	}
+
+	// Results posted late for a previous event are discarded
+	var actual result
+	deadline := time.After(api.timeout)
+	for actual.requestId != record.RequestId {
+		select {
+		case actual = <-api.results:
+		case <-deadline:
+			return []string{"no response or error posted before the timeout"}
+		}
+	}
+
+	expected := record.Response
+	if record.Error != nil {
+		expected = record.Error
+	}
+	switch {
+	case expected == nil:
+		return nil
+	case expected.Truncated:
+		println(printPrefix, "    captured response was truncated, skipping the diff")
+		return nil
+	case actual.isError && record.Error == nil:
+		return []string{"expected a response, got an error: " + string(actual.body)}
+	case !actual.isError && record.Error != nil:
+		return []string{"expected an error, got a response: " + string(actual.body)}
+	}
+	return diffBodies(expected.BodyBytes(), actual.body, ignored)
+}
+
+func (api *runtimeApi) router() http.Handler {
+	r := chi.NewRouter()
+	r.Get("/2018-06-01/runtime/invocation/next", api.handleNext)
+	r.Post("/2018-06-01/runtime/invocation/{requestId}/response", api.handleResult(false))
+	r.Post("/2018-06-01/runtime/invocation/{requestId}/error", api.handleResult(true))
+	r.Post("/2018-06-01/runtime/init/error", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		println(printPrefix, "Runtime init error:", string(body))
+		w.WriteHeader(http.StatusAccepted)
+	})
+	return r
+}
+
+// Blocks like the Runtime API until the next event is replayed
+func (api *runtimeApi) handleNext(w http.ResponseWriter, r *http.Request) {
+	var record *middleware.CaptureRecord
+	select {
+	case record = <-api.events:
+	case <-r.Context().Done():
+		return
+	}
+
+	for key, values := range record.Event.Header {
+		w.Header()[key] = values
+	}
+	w.Header().Del("Content-Length")
+	w.Header().Set(proxy.RequestIdHeader, record.RequestId)
+	// Keep the time budget of the captured invocation
+	budget := api.timeout
+	if record.DeadlineMs > 0 {
+		budget = time.Unix(0, record.DeadlineMs*int64(time.Millisecond)).Sub(record.ReceivedAt)
+	}
+	w.Header().Set(proxy.DeadlineHeader, strconv.FormatInt(time.Now().Add(budget).UnixNano()/int64(time.Millisecond), 10))
+	_, _ = w.Write(record.Event.BodyBytes())
+}
+
+func (api *runtimeApi) handleResult(isError bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		select {
+		case api.results <- result{requestId: chi.URLParam(r, "requestId"), isError: isError, body: body}:
+		default:
+			println(printPrefix, "Unexpected result for requestID:", chi.URLParam(r, "requestId"))
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// Reads a NDJSON capture file
+func readCapture(fileName string) ([]*middleware.CaptureRecord, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open capture file: %v", err)
+	}
+	defer file.Close()
+
+	var records []*middleware.CaptureRecord
+	reader := bufio.NewReader(file)
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(data)) > 0 {
+			record := &middleware.CaptureRecord{}
+			if err := json.Unmarshal(data, record); err != nil {
+				return nil, fmt.Errorf("invalid capture record on line %d: %v", line, err)
+			}
+			if record.Event != nil {
+				records = append(records, record)
+			}
+		}
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Compares two bodies, JSON bodies are compared value by value and the differing paths reported
+func diffBodies(expected []byte, actual []byte, ignored map[string]bool) []string {
+	var expectedJson, actualJson interface{}
+	if decode(expected, &expectedJson) != nil || decode(actual, &actualJson) != nil {
+		if bytes.Equal(expected, actual) {
+			return nil
+		}
+		return []string{fmt.Sprintf("expected %q, got %q", expected, actual)}
+	}
+
+	var diffs []string
+	diffJson("$", expectedJson, actualJson, ignored, &diffs)
+	if len(diffs) > maxDiffs {
+		diffs = append(diffs[:maxDiffs], fmt.Sprintf("... %d more", len(diffs)-maxDiffs))
+	}
+	return diffs
+}
+
+func diffJson(path string, expected interface{}, actual interface{}, ignored map[string]bool, diffs *[]string) {
+	if ignored[path] {
+		return
+	}
+	switch expectedValue := expected.(type) {
+	case map[string]interface{}:
+		actualValue, ok := actual.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make(map[string]bool)
+		for key := range expectedValue {
+			keys[key] = true
+		}
+		for key := range actualValue {
+			keys[key] = true
+		}
+		var sorted []string
+		for key := range keys {
+			sorted = append(sorted, key)
+		}
+		sort.Strings(sorted)
+		for _, key := range sorted {
+			diffJson(path+"."+key, expectedValue[key], actualValue[key], ignored, diffs)
+		}
+		return
+	case []interface{}:
+		actualValue, ok := actual.([]interface{})
+		if !ok || len(actualValue) != len(expectedValue) {
+			break
+		}
+		for idx := range expectedValue {
+			diffJson(fmt.Sprintf("%s[%d]", path, idx), expectedValue[idx], actualValue[idx], ignored, diffs)
+		}
+		return
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		*diffs = append(*diffs, fmt.Sprintf("%s: expected %s, got %s", path, toJson(expected), toJson(actual)))
+	}
+}
+
+func decode(body []byte, value *interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	return decoder.Decode(value)
+}
+
+func toJson(value interface{}) string {
+	if value == nil {
+		return "nothing"
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
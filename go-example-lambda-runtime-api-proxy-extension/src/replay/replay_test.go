@@ -0,0 +1,247 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+
+package replay
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"LAMBDA-RUNTIME-API-PROXY-EXTENSION-MAIN/golang-example-lambda-runtime-api-proxy-example/src/middleware"
+	"LAMBDA-RUNTIME-API-PROXY-EXTENSION-MAIN/golang-example-lambda-runtime-api-proxy-example/src/proxy"
+)
+
+// handler answers an event with a body, posted as an error when isError is set
+type handler func(event []byte) (body string, isError bool)
+
+// Runs a runtime against the Runtime API at address: fetches count events and posts what the
+// handler returns. The headers of the events are sent on headers
+func runRuntime(t *testing.T, address string, count int, handle handler, headers chan<- http.Header) {
+	t.Helper()
+	go func() {
+		for idx := 0; idx < count; idx++ {
+			var resp *http.Response
+			var err error
+			// The emulated Runtime API may not listen yet
+			for attempt := 0; attempt < 50; attempt++ {
+				if resp, err = http.Get("http://" + address + "/2018-06-01/runtime/invocation/next"); err == nil {
+					break
+				}
+				time.Sleep(20 * time.Millisecond)
+			}
+			if err != nil {
+				return
+			}
+			event, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if headers != nil {
+				headers <- resp.Header
+			}
+
+			body, isError := handle(event)
+			result := "response"
+			if isError {
+				result = "error"
+			}
+			requestId := resp.Header.Get(proxy.RequestIdHeader)
+			resp, err = http.Post("http://"+address+"/2018-06-01/runtime/invocation/"+requestId+"/"+result, "application/json", strings.NewReader(body))
+			if err != nil {
+				return
+			}
+			resp.Body.Close()
+		}
+	}()
+}
+
+func echo(event []byte) (string, bool) {
+	return string(event), false
+}
+
+func newTestRuntimeApi(t *testing.T) (*runtimeApi, string) {
+	api := &runtimeApi{
+		events:  make(chan *middleware.CaptureRecord),
+		results: make(chan result, 1),
+		timeout: 5 * time.Second,
+	}
+	server := httptest.NewServer(api.router())
+	t.Cleanup(server.Close)
+	return api, strings.TrimPrefix(server.URL, "http://")
+}
+
+func captured(requestId string, event string, response string) *middleware.CaptureRecord {
+	return &middleware.CaptureRecord{
+		RequestId:  requestId,
+		ReceivedAt: time.Now(),
+		Event:      &middleware.CapturedPayload{Header: make(http.Header), Body: json.RawMessage(event)},
+		Response:   &middleware.CapturedPayload{Body: json.RawMessage(response)},
+	}
+}
+
+func TestReplayComparesResults(t *testing.T) {
+	api, address := newTestRuntimeApi(t)
+	runRuntime(t, address, 3, func(event []byte) (string, bool) {
+		if strings.Contains(string(event), "fail") {
+			return `{"errorType": "Failed"}`, true
+		}
+		return strings.Replace(string(event), "1", "2", 1), false
+	}, nil)
+
+	if diffs := api.replay(captured("request-1", `{"total": 3}`, `{"total": 3}`), nil); len(diffs) != 0 {
+		t.Fatalf("identical response differs: %v", diffs)
+	}
+	if diffs := api.replay(captured("request-2", `{"total": 1}`, `{"total": 1}`), nil); !reflect.DeepEqual(diffs, []string{"$.total: expected 1, got 2"}) {
+		t.Fatalf("unexpected diffs %v", diffs)
+	}
+	record := captured("request-3", `{"fail": true}`, `{}`)
+	if diffs := api.replay(record, nil); len(diffs) != 1 || !strings.HasPrefix(diffs[0], "expected a response, got an error") {
+		t.Fatalf("unexpected diffs %v", diffs)
+	}
+}
+
+func TestReplayKeepsEventHeadersAndBudget(t *testing.T) {
+	api, address := newTestRuntimeApi(t)
+	headers := make(chan http.Header, 1)
+	runRuntime(t, address, 1, echo, headers)
+
+	record := captured("request-1", `{}`, `{}`)
+	record.Event.Header.Set(proxy.TraceIdHeader, "Root=1-5759e988-bd862e3fe1be46a994272793")
+	record.Event.Header.Set("Content-Length", "100")
+	record.DeadlineMs = record.ReceivedAt.Add(3*time.Second).UnixNano() / int64(time.Millisecond)
+	start := time.Now()
+	if diffs := api.replay(record, nil); len(diffs) != 0 {
+		t.Fatalf("unexpected diffs %v", diffs)
+	}
+
+	header := <-headers
+	if header.Get(proxy.RequestIdHeader) != "request-1" || header.Get(proxy.TraceIdHeader) != "Root=1-5759e988-bd862e3fe1be46a994272793" {
+		t.Fatalf("runtime received headers %v, expected the captured ones", header)
+	}
+	deadlineMs, _ := strconv.ParseInt(header.Get(proxy.DeadlineHeader), 10, 64)
+	budget := time.Unix(0, deadlineMs*int64(time.Millisecond)).Sub(start)
+	if budget < 2*time.Second || budget > 4*time.Second {
+		t.Fatalf("runtime received a time budget of %v, expected the captured 3s", budget)
+	}
+}
+
+func TestReplaySkipsTruncatedResponses(t *testing.T) {
+	api, address := newTestRuntimeApi(t)
+	runRuntime(t, address, 1, echo, nil)
+
+	record := captured("request-1", `{"total": 1}`, `{"total": 2}`)
+	record.Response.Truncated = true
+	if diffs := api.replay(record, nil); len(diffs) != 0 {
+		t.Fatalf("truncated response was compared: %v", diffs)
+	}
+}
+
+func TestReadCapture(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "capture.ndjson")
+	err := os.WriteFile(fileName, []byte(strings.Join([]string{
+		`{"requestId": "request-1", "event": {"body": {"orderId": 1}}, "response": {"body": {"total": 1}}}`,
+		``,
+		`{"requestId": "request-2"}`,
+		`{"requestId": "request-3", "event": {"bodyText": "text"}}`,
+	}, "\n")), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := readCapture(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].RequestId != "request-1" || records[1].RequestId != "request-3" {
+		t.Fatalf("read %+v, expected the records with an event", records)
+	}
+	if string(records[1].Event.BodyBytes()) != "text" {
+		t.Fatalf("read event %q", records[1].Event.BodyBytes())
+	}
+
+	os.WriteFile(fileName, []byte("{\"requestId\": \"request-1\", \"event\": {}}\nnot json\n"), 0600)
+	if _, err := readCapture(fileName); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Fatalf("read an invalid capture with error %v, expected the invalid line", err)
+	}
+}
+
+func TestDiffBodies(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		expected string
+		actual   string
+		ignored  []string
+		diffs    []string
+	}{
+		{"same json", `{"a": 1, "b": [1, 2]}`, `{"b": [1, 2], "a": 1}`, nil, nil},
+		{"changed value", `{"a": {"b": 1}}`, `{"a": {"b": "1"}}`, nil, []string{`$.a.b: expected 1, got "1"`}},
+		{"missing key", `{"a": 1, "b": 2}`, `{"a": 1}`, nil, []string{"$.b: expected 2, got nothing"}},
+		{"added key", `{"a": 1}`, `{"a": 1, "b": 2}`, nil, []string{"$.b: expected nothing, got 2"}},
+		{"array item", `[1, 2]`, `[1, 3]`, nil, []string{"$[1]: expected 2, got 3"}},
+		{"array length", `[1, 2]`, `[1]`, nil, []string{"$: expected [1,2], got [1]"}},
+		{"large numbers", `{"id": 12345678901234567890}`, `{"id": 12345678901234567891}`, nil, []string{"$.id: expected 12345678901234567890, got 12345678901234567891"}},
+		{"ignored paths", `{"a": 1, "b": {"c": 2}}`, `{"a": 2, "b": {"c": 3}}`, []string{"$.a", "$.b.c"}, nil},
+		{"same text", `hello`, `hello`, nil, nil},
+		{"changed text", `hello`, `world`, nil, []string{`expected "hello", got "world"`}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ignored := make(map[string]bool)
+			for _, path := range test.ignored {
+				ignored[path] = true
+			}
+			if diffs := diffBodies([]byte(test.expected), []byte(test.actual), ignored); !reflect.DeepEqual(diffs, test.diffs) {
+				t.Fatalf("diffs %q, expected %q", diffs, test.diffs)
+			}
+		})
+	}
+}
+
+func TestDiffBodiesIsCapped(t *testing.T) {
+	expected, _ := json.Marshal(make([]int, maxDiffs+5))
+	actual := strings.Replace(string(expected), "0", "1", -1)
+	diffs := diffBodies(expected, []byte(actual), nil)
+	if len(diffs) != maxDiffs+1 || diffs[maxDiffs] != "... 5 more" {
+		t.Fatalf("diffs %q, expected %d diffs and a summary", diffs, maxDiffs)
+	}
+}
+
+func TestRun(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "capture.ndjson")
+	var lines []string
+	for _, record := range []*middleware.CaptureRecord{
+		captured("request-1", `{"total": 1}`, `{"total": 1}`),
+		captured("request-2", `{"total": 2}`, `{"total": 2, "timestamp": 1}`),
+	} {
+		line, _ := json.Marshal(record)
+		lines = append(lines, string(line))
+	}
+	os.WriteFile(fileName, []byte(strings.Join(lines, "\n")), 0600)
+
+	for _, test := range []struct {
+		ignore string
+		code   int
+	}{
+		{"", 1},
+		{"$.timestamp", 0},
+	} {
+		// Reserves a free port for the emulated Runtime API
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		address := listener.Addr().String()
+		listener.Close()
+
+		runRuntime(t, address, 2, echo, nil)
+		if code := Run([]string{"-file", fileName, "-listen", address, "-timeout", "5s", "-ignore", test.ignore}); code != test.code {
+			t.Fatalf("replay ignoring %q exited with %d, expected %d", test.ignore, code, test.code)
+		}
+	}
+}
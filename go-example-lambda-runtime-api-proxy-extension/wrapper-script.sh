@@ -1,4 +1,4 @@
 #!/bin/bash
 args=("$@")
-export AWS_LAMBDA_RUNTIME_API="127.0.0.1:${LRAP_LISTENER_PORT:-9009}"
+export AWS_LAMBDA_RUNTIME_API="${LRAP_LISTENER_HOST:-127.0.0.1}:${LRAP_LISTENER_PORT:-9009}"
 exec "${args[@]}"
\ No newline at end of file